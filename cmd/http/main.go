@@ -14,7 +14,13 @@ import (
 func main() {
 	cfg := config.Load()
 
-	compiler := policy.NewCompiler()
+	registry := policy.NewRegistry(policy.WithStrictLint(cfg.StrictLint))
+	if cfg.PolicyDir != "" {
+		if err := registry.LoadDir(cfg.PolicyDir); err != nil {
+			log.Fatalf("load policy dir: %v", err)
+		}
+	}
+	compiler := policy.NewCompiler(policy.WithStrictLint(cfg.StrictLint), policy.WithPolicyResolver(registry))
 	latencyObserver := policy.NewAsyncNodeLatencyObserver(policy.NewNodeLatencyLogger(log.Default()), cfg.ObsBuffer)
 	defer latencyObserver.Close()
 	engine := policy.NewEngine(
@@ -29,6 +35,8 @@ func main() {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/infer", h.Infer)
+	mux.HandleFunc("/introspect", h.Introspect)
+	mux.HandleFunc("/counterfactual", h.Counterfactual)
 
 	addr := cfg.HTTPAddr
 	log.Printf("listening on %s", addr)
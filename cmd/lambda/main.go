@@ -15,7 +15,13 @@ import (
 func main() {
 	cfg := config.Load()
 
-	compiler := policy.NewCompiler()
+	registry := policy.NewRegistry(policy.WithStrictLint(cfg.StrictLint))
+	if cfg.PolicyDir != "" {
+		if err := registry.LoadDir(cfg.PolicyDir); err != nil {
+			log.Fatalf("load policy dir: %v", err)
+		}
+	}
+	compiler := policy.NewCompiler(policy.WithStrictLint(cfg.StrictLint), policy.WithPolicyResolver(registry))
 	latencyObserver := policy.NewAsyncNodeLatencyObserver(policy.NewNodeLatencyLogger(log.Default()), cfg.ObsBuffer)
 	defer latencyObserver.Close()
 	engine := policy.NewEngine(
@@ -28,5 +34,5 @@ func main() {
 	svc := app.NewService(compiler, engine, c)
 	h := lambdatransport.NewHandler(svc)
 
-	lambda.Start(h.Infer)
+	lambda.Start(h.Route)
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy"
+)
+
+func main() {
+	from := flag.String("from", "dot", "input format: dot or json")
+	to := flag.String("to", "json", "output format: dot or json")
+	in := flag.String("in", "-", "input file (- for stdin)")
+	policyDir := flag.String("policy-dir", os.Getenv("POLICY_DIR"), "directory with the policies referenced by call (default $POLICY_DIR)")
+	flag.Parse()
+
+	src, err := readInput(*in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read input: %v\n", err)
+		os.Exit(1)
+	}
+
+	registry := policy.NewRegistry()
+	if *policyDir != "" {
+		if err := registry.LoadDir(*policyDir); err != nil {
+			fmt.Fprintf(os.Stderr, "load policy dir: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	compiler := policy.NewCompiler(policy.WithPolicyResolver(registry))
+	var p *policy.Policy
+	switch *from {
+	case "dot":
+		p, err = compiler.Compile(src)
+	case "json":
+		p, err = compiler.CompileJSON(src)
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported -from %q\n", *from)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compile: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch *to {
+	case "dot":
+		fmt.Print(policy.ToDOT(p))
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(policy.ToDocument(p)); err != nil {
+			fmt.Fprintf(os.Stderr, "encode: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported -to %q\n", *to)
+		os.Exit(2)
+	}
+}
+
+func readInput(path string) (string, error) {
+	if path == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		return string(b), err
+	}
+	b, err := os.ReadFile(path)
+	return string(b), err
+}
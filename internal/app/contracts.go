@@ -1,6 +1,10 @@
 package app
 
+import "context"
+
 type InferService interface {
-	InferWithOptions(policyDOT string, input map[string]any, opts InferOptions) (map[string]any, *PolicyInfo, error)
-	InferWithTraceAndOptions(policyDOT string, input map[string]any, opts InferOptions) (map[string]any, *InferTrace, *PolicyInfo, error)
+	InferContext(ctx context.Context, policyDOT string, input map[string]any, opts InferOptions) (map[string]any, *PolicyInfo, error)
+	InferWithTraceContext(ctx context.Context, policyDOT string, input map[string]any, opts InferOptions) (map[string]any, *InferTrace, *PolicyInfo, error)
+	Introspect(policyDOT string, opts InferOptions) (*InputRequirements, *PolicyInfo, error)
+	Counterfactual(ctx context.Context, policyDOT string, input map[string]any, target CounterfactualTarget, opts InferOptions) (*CounterfactualResult, *PolicyInfo, error)
 }
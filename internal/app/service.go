@@ -1,9 +1,11 @@
 package app
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"time"
 
 	"github.com/awmpietro/golang-policy-inference-case/internal/policy"
 )
@@ -12,6 +14,16 @@ type Compiler interface {
 	Compile(dot string) (*policy.Policy, error)
 }
 
+// JSONCompiler é o front-end opcional pro formato JSON da policy (policy.Document).
+type JSONCompiler interface {
+	CompileJSON(src string) (*policy.Policy, error)
+}
+
+const (
+	PolicyFormatDOT  = "dot"
+	PolicyFormatJSON = "json"
+)
+
 type Engine interface {
 	Run(p *policy.Policy, vars map[string]any) error
 }
@@ -20,21 +32,59 @@ type TraceEngine interface {
 	RunWithTrace(p *policy.Policy, vars map[string]any) (*policy.ExecutionTrace, error)
 }
 
+// ContextEngine é a engine que respeita cancelamento/prazo do ctx (ver policy.Engine.RunContext).
+type ContextEngine interface {
+	RunContext(ctx context.Context, p *policy.Policy, vars map[string]any) error
+}
+
+type ContextTraceEngine interface {
+	RunWithTraceContext(ctx context.Context, p *policy.Policy, vars map[string]any) (*policy.ExecutionTrace, error)
+}
+
+// CounterfactualEngine é a engine que sabe procurar mudanças de input pra chegar num alvo (ver policy.Engine.Counterfactual).
+type CounterfactualEngine interface {
+	Counterfactual(ctx context.Context, p *policy.Policy, input map[string]any, target policy.CounterfactualTarget) (*policy.CounterfactualResult, error)
+}
+
 type Cache interface {
 	GetOrCompute(dot string, fn func() (*policy.Policy, error)) (*policy.Policy, error)
 }
 
 type InferTrace = policy.ExecutionTrace
 
+type CompileErrors = policy.CompileErrors
+
+type InputErrors = policy.InputErrors
+
+type OutputErrors = policy.OutputErrors
+
+type InputRequirements = policy.InputRequirements
+
+type CounterfactualTarget = policy.CounterfactualTarget
+
+type CounterfactualResult = policy.CounterfactualResult
+
 type InferOptions struct {
 	PolicyID      string
 	PolicyVersion string
+	Entry         string
+	// Format é o formato do texto da policy: "dot" (default) ou "json".
+	Format string
+	// Timeout é o orçamento de tempo da execução pedido no request (0 = só o do ctx/da policy).
+	Timeout time.Duration
+	// EvaluateAll avalia todas as arestas de cada nó visitado e marca decisão ambigua no trace
+	// (a execução continua seguindo a primeira que casa).
+	EvaluateAll bool
+	// Explain quebra a cond de cada aresta avaliada por comparação (valores e variaveis lidas) no trace.
+	Explain bool
 }
 
 type PolicyInfo struct {
-	ID      string `json:"id,omitempty"`
-	Version string `json:"version,omitempty"`
-	Hash    string `json:"hash"`
+	ID       string              `json:"id,omitempty"`
+	Version  string              `json:"version,omitempty"`
+	Hash     string              `json:"hash"`     // hash canonico da policy compilada (ver policy.Canonical)
+	RawHash  string              `json:"raw_hash"` // sha256 do texto recebido, pra auditoria
+	Warnings []policy.Diagnostic `json:"warnings,omitempty"`
 }
 
 type Service struct {
@@ -53,13 +103,21 @@ func (s *Service) Infer(policyDOT string, input map[string]any) (map[string]any,
 }
 
 func (s *Service) InferWithOptions(policyDOT string, input map[string]any, opts InferOptions) (map[string]any, *PolicyInfo, error) {
+	return s.InferContext(context.Background(), policyDOT, input, opts)
+}
+
+// InferContext é o InferWithOptions que para a execução quando o ctx é cancelado ou o prazo estoura
+// (o do ctx, o opts.Timeout ou o timeout da policy, o que vier primeiro).
+func (s *Service) InferContext(ctx context.Context, policyDOT string, input map[string]any, opts InferOptions) (map[string]any, *PolicyInfo, error) {
 	// Fluxo padrão: valida/prepara, roda engine e devolve output + metadado de policy (se tiver versionamento).
 	p, out, info, err := s.prepare(policyDOT, input, opts)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if err := s.engine.Run(p, out); err != nil {
+	ctx, cancel := runContext(ctx, opts)
+	defer cancel()
+	if err := s.run(ctx, p, out); err != nil {
 		return nil, info, err
 	}
 
@@ -72,21 +130,31 @@ func (s *Service) InferWithTrace(policyDOT string, input map[string]any) (map[st
 }
 
 func (s *Service) InferWithTraceAndOptions(policyDOT string, input map[string]any, opts InferOptions) (map[string]any, *InferTrace, *PolicyInfo, error) {
+	return s.InferWithTraceContext(context.Background(), policyDOT, input, opts)
+}
+
+// InferWithTraceContext é o InferContext com trace.
+func (s *Service) InferWithTraceContext(ctx context.Context, policyDOT string, input map[string]any, opts InferOptions) (map[string]any, *InferTrace, *PolicyInfo, error) {
 	// Mesmo fluxo do infer normal, só que com trilha de execução pra debug quando o engine suporta trace.
 	p, out, info, err := s.prepare(policyDOT, input, opts)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	traceEngine, ok := s.engine.(TraceEngine)
-	if !ok {
-		if err := s.engine.Run(p, out); err != nil {
-			return nil, nil, info, err
+	ctx, cancel := runContext(ctx, opts)
+	defer cancel()
+
+	var trace *InferTrace
+	switch eng := s.engine.(type) {
+	case ContextTraceEngine:
+		trace, err = eng.RunWithTraceContext(ctx, p, out)
+	case TraceEngine:
+		if err = ctx.Err(); err == nil {
+			trace, err = eng.RunWithTrace(p, out)
 		}
-		return out, nil, info, nil
+	default:
+		err = s.run(ctx, p, out)
 	}
-
-	trace, err := traceEngine.RunWithTrace(p, out)
 	if err != nil {
 		return nil, trace, info, err
 	}
@@ -94,37 +162,166 @@ func (s *Service) InferWithTraceAndOptions(policyDOT string, input map[string]an
 	return out, trace, info, nil
 }
 
+// run usa o RunContext quando a engine tem; senão só confere o ctx antes de rodar.
+func (s *Service) run(ctx context.Context, p *policy.Policy, vars map[string]any) error {
+	if eng, ok := s.engine.(ContextEngine); ok {
+		return eng.RunContext(ctx, p, vars)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.engine.Run(p, vars)
+}
+
+// runContext monta o ctx da execução a partir das opções do request (prazo, evaluate-all e explain).
+func runContext(ctx context.Context, opts InferOptions) (context.Context, context.CancelFunc) {
+	if opts.EvaluateAll {
+		ctx = policy.ContextWithEvaluateAll(ctx)
+	}
+	if opts.Explain {
+		ctx = policy.ContextWithExplain(ctx)
+	}
+	if opts.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, opts.Timeout)
+}
+
+// Introspect devolve as variaveis de input que a policy lê (a partir do entry pedido), sem rodar nada.
+func (s *Service) Introspect(policyDOT string, opts InferOptions) (*InputRequirements, *PolicyInfo, error) {
+	p, info, err := s.load(policyDOT, opts)
+	if err != nil {
+		return nil, info, err
+	}
+	req := p.RequiredInputs()
+	return &req, info, nil
+}
+
+// Counterfactual procura as menores mudanças no input que levam a execução até o alvo (nó ou output).
+// O input nao passa pelo schema aqui: ele costuma ser justamente o que foi recusado; cada alternativa
+// é conferida com o schema quando a engine roda o input mudado.
+func (s *Service) Counterfactual(ctx context.Context, policyDOT string, input map[string]any, target CounterfactualTarget, opts InferOptions) (*CounterfactualResult, *PolicyInfo, error) {
+	eng, ok := s.engine.(CounterfactualEngine)
+	if !ok {
+		return nil, nil, fmt.Errorf("counterfactual search is not supported by this engine")
+	}
+	p, info, err := s.load(policyDOT, opts)
+	if err != nil {
+		return nil, info, err
+	}
+
+	ctx, cancel := runContext(ctx, InferOptions{Timeout: opts.Timeout})
+	defer cancel()
+	res, err := eng.Counterfactual(ctx, p, cloneMap(input), target)
+	if err != nil {
+		return nil, info, err
+	}
+	return res, info, nil
+}
+
 func (s *Service) prepare(policyDOT string, input map[string]any, opts InferOptions) (*policy.Policy, map[string]any, *PolicyInfo, error) {
 	// Aqui a gente centraliza validação, cache-key/versionamento e clone defensivo do input.
-	if policyDOT == "" {
-		return nil, nil, nil, fmt.Errorf("policy_dot is required")
-	}
 	if input == nil {
 		input = map[string]any{}
 	}
+	p, info, err := s.load(policyDOT, opts)
+	if err != nil {
+		return nil, nil, info, err
+	}
+
+	// Schema declarado na policy (input_<name>) barra o request antes de rodar, com todos os campos ruins de uma vez.
+	if err := p.Inputs.Validate(input); err != nil {
+		return nil, nil, info, err
+	}
+
+	out := cloneMap(input)
+	return p, out, info, nil
+}
+
+// load valida o pedido, compila (ou pega do cache) e escolhe o entry.
+func (s *Service) load(policyDOT string, opts InferOptions) (*policy.Policy, *PolicyInfo, error) {
+	switch opts.Format {
+	case "", PolicyFormatDOT:
+		if policyDOT == "" {
+			return nil, nil, fmt.Errorf("policy_dot is required")
+		}
+	case PolicyFormatJSON:
+		if policyDOT == "" {
+			return nil, nil, fmt.Errorf("policy is required")
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported policy_format %q (expected dot or json)", opts.Format)
+	}
 	if (opts.PolicyID == "") != (opts.PolicyVersion == "") {
-		return nil, nil, nil, fmt.Errorf("policy_id and policy_version must be provided together")
+		return nil, nil, fmt.Errorf("policy_id and policy_version must be provided together")
+	}
+
+	// O cache é consultado duas vezes: pelo texto cru (hit sem recompilar) e pelo hash canonico,
+	// pra DOT só reformatado/reordenado cair na mesma policy compilada. Cada texto novo ocupa duas
+	// entradas (raw + canonica), entao POLICY_CACHE_MAX_ITEMS guarda metade disso em textos distintos.
+	// O formato entra na chave do texto cru: o mesmo texto como dot e como json sao policies diferentes.
+	format := opts.Format
+	if format == "" {
+		format = PolicyFormatDOT
+	}
+	rawHash := hash(policyDOT)
+	p, err := s.cache.GetOrCompute(cacheKey(opts, "raw:"+format+":"+rawHash), func() (*policy.Policy, error) {
+		compiled, err := s.compile(policyDOT, opts.Format)
+		if err != nil {
+			return nil, err
+		}
+		if compiled.Hash == "" {
+			compiled.Hash = policy.CanonicalHash(compiled)
+		}
+		shared, err := s.cache.GetOrCompute(cacheKey(opts, compiled.Hash), func() (*policy.Policy, error) {
+			return compiled, nil
+		})
+		if err != nil || shared == compiled || (len(shared.Diagnostics) == 0 && len(compiled.Diagnostics) == 0) {
+			return shared, err
+		}
+		// a compartilhada veio de outro texto: as posições dos diagnostics sao desse texto aqui
+		view := *shared
+		view.Diagnostics = compiled.Diagnostics
+		return &view, nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	policyHash := hash(policyDOT)
 	var info *PolicyInfo
 	if opts.PolicyID != "" {
 		info = &PolicyInfo{
 			ID:      opts.PolicyID,
 			Version: opts.PolicyVersion,
-			Hash:    policyHash,
+			Hash:    p.Hash,
+			RawHash: rawHash,
 		}
 	}
 
-	p, err := s.cache.GetOrCompute(cacheKey(opts, policyHash), func() (*policy.Policy, error) {
-		return s.compiler.Compile(policyDOT)
-	})
+	// Warnings do lint sobem no PolicyInfo mesmo sem versionamento, pra quem escreveu a policy enxergar.
+	if len(p.Diagnostics) > 0 {
+		if info == nil {
+			info = &PolicyInfo{Hash: p.Hash, RawHash: rawHash}
+		}
+		info.Warnings = p.Diagnostics
+	}
+
+	p, err = p.ForEntry(opts.Entry)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, info, err
 	}
+	return p, info, nil
+}
 
-	out := cloneMap(input)
-	return p, out, info, nil
+func (s *Service) compile(src, format string) (*policy.Policy, error) {
+	if format != PolicyFormatJSON {
+		return s.compiler.Compile(src)
+	}
+	jc, ok := s.compiler.(JSONCompiler)
+	if !ok {
+		return nil, fmt.Errorf("policy_format %q is not supported by this compiler", format)
+	}
+	return jc.CompileJSON(src)
 }
 
 func cloneMap(m map[string]any) map[string]any {
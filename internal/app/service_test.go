@@ -1,11 +1,16 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/awmpietro/golang-policy-inference-case/internal/policy"
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/cache"
 )
 
 type fakeCompiler struct {
@@ -215,3 +220,335 @@ func TestService_InferWithOptions_ReturnsPolicyInfoAndVersionedCacheKey(t *testi
 		t.Fatalf("expected cache key with version prefix, got %q", c.lastKey)
 	}
 }
+
+func TestService_InferWithOptions_UsesNamedEntry(t *testing.T) {
+	comp := &fakeCompiler{
+		p: &policy.Policy{
+			Start:   "start",
+			Entries: map[string]string{"final_approval": "final"},
+			Nodes: map[string]*policy.Node{
+				"start": {ID: "start"},
+				"final": {ID: "final"},
+			},
+		},
+	}
+	var gotStart string
+	eng := &fakeEngine{
+		fn: func(p *policy.Policy, vars map[string]any) error {
+			gotStart = p.Start
+			return nil
+		},
+	}
+	s := NewService(comp, eng, &fakeCache{})
+
+	if _, _, err := s.InferWithOptions("digraph {}", map[string]any{}, InferOptions{Entry: "final_approval"}); err != nil {
+		t.Fatal(err)
+	}
+	if gotStart != "final" {
+		t.Fatalf("expected engine to start at final, got %q", gotStart)
+	}
+
+	_, _, err := s.InferWithOptions("digraph {}", map[string]any{}, InferOptions{Entry: "unknown"})
+	if err == nil || !strings.Contains(err.Error(), `unknown entry "unknown"`) {
+		t.Fatalf("expected unknown entry error, got %v", err)
+	}
+}
+
+func TestService_InferWithOptions_ReturnsLintWarnings(t *testing.T) {
+	comp := &fakeCompiler{
+		p: &policy.Policy{
+			Start: "start",
+			Nodes: map[string]*policy.Node{"start": {ID: "start"}},
+			Diagnostics: []policy.Diagnostic{
+				{Severity: policy.SeverityWarning, Code: "unreachable_node", Node: "x", Message: "node x is not reachable from any entry"},
+			},
+		},
+	}
+	eng := &fakeEngine{
+		fn: func(p *policy.Policy, vars map[string]any) error {
+			return nil
+		},
+	}
+	s := NewService(comp, eng, &fakeCache{})
+
+	_, info, err := s.InferWithOptions("digraph {}", map[string]any{}, InferOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info == nil || len(info.Warnings) != 1 || info.Hash == "" {
+		t.Fatalf("expected policy info with warnings, got %#v", info)
+	}
+}
+
+type fakeJSONCompiler struct {
+	fakeCompiler
+	jsonCalls int
+}
+
+func (f *fakeJSONCompiler) CompileJSON(src string) (*policy.Policy, error) {
+	f.jsonCalls++
+	return f.p, f.err
+}
+
+func TestService_InferWithOptions_SelectsPolicyFormat(t *testing.T) {
+	comp := &fakeJSONCompiler{
+		fakeCompiler: fakeCompiler{
+			p: &policy.Policy{Start: "start", Nodes: map[string]*policy.Node{"start": {ID: "start"}}},
+		},
+	}
+	eng := &fakeEngine{
+		fn: func(p *policy.Policy, vars map[string]any) error {
+			return nil
+		},
+	}
+	s := NewService(comp, eng, &fakeCache{})
+
+	if _, _, err := s.InferWithOptions(`{"nodes":[]}`, map[string]any{}, InferOptions{Format: PolicyFormatJSON}); err != nil {
+		t.Fatal(err)
+	}
+	if comp.jsonCalls != 1 || comp.calls != 0 {
+		t.Fatalf("expected JSON front-end to be used, got json=%d dot=%d", comp.jsonCalls, comp.calls)
+	}
+
+	_, _, err := s.InferWithOptions("x", map[string]any{}, InferOptions{Format: "yaml"})
+	if err == nil || !strings.Contains(err.Error(), `unsupported policy_format "yaml"`) {
+		t.Fatalf("expected unsupported format error, got %v", err)
+	}
+
+	dotOnly := NewService(&fakeCompiler{}, eng, &fakeCache{})
+	_, _, err = dotOnly.InferWithOptions(`{"nodes":[]}`, map[string]any{}, InferOptions{Format: PolicyFormatJSON})
+	if err == nil || !strings.Contains(err.Error(), "not supported by this compiler") {
+		t.Fatalf("expected unsupported compiler error, got %v", err)
+	}
+}
+
+func TestService_InferWithOptions_RawCacheKeySeparatesFormats(t *testing.T) {
+	comp := &fakeJSONCompiler{
+		fakeCompiler: fakeCompiler{
+			p: &policy.Policy{Start: "start", Nodes: map[string]*policy.Node{"start": {ID: "start"}}},
+		},
+	}
+	eng := &fakeEngine{fn: func(p *policy.Policy, vars map[string]any) error { return nil }}
+	s := NewService(comp, eng, cache.NewInMemory(16))
+
+	src := `{"nodes":[]}`
+	for _, format := range []string{"", PolicyFormatJSON, PolicyFormatDOT, PolicyFormatJSON} {
+		if _, _, err := s.InferWithOptions(src, map[string]any{}, InferOptions{Format: format}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if comp.calls != 1 || comp.jsonCalls != 1 {
+		t.Fatalf("expected one compile per format, got dot=%d json=%d", comp.calls, comp.jsonCalls)
+	}
+}
+
+func TestService_InferWithOptions_ValidatesDeclaredInputs(t *testing.T) {
+	min := 300.0
+	comp := &fakeCompiler{
+		p: &policy.Policy{
+			Start: "start",
+			Nodes: map[string]*policy.Node{"start": {ID: "start"}},
+			Inputs: policy.InputSchema{
+				{Name: "score", Type: "number", Required: true, Min: &min},
+				{Name: "segment", Type: "string", Required: true},
+			},
+		},
+	}
+	eng := &fakeEngine{
+		fn: func(p *policy.Policy, vars map[string]any) error {
+			return nil
+		},
+	}
+	s := NewService(comp, eng, &fakeCache{})
+
+	_, _, err := s.InferWithOptions("digraph {}", map[string]any{"score": 100.0}, InferOptions{})
+	var inputErrs InputErrors
+	if !errors.As(err, &inputErrs) || len(inputErrs) != 2 {
+		t.Fatalf("expected 2 input errors, got %v", err)
+	}
+	if eng.calls != 0 {
+		t.Fatalf("engine should not run with invalid input")
+	}
+
+	if _, _, err := s.InferWithOptions("digraph {}", map[string]any{"score": 720.0, "segment": "prime"}, InferOptions{}); err != nil {
+		t.Fatalf("expected valid input, got %v", err)
+	}
+}
+
+func TestService_Introspect_UsesEntryWithoutRunning(t *testing.T) {
+	comp := &fakeCompiler{
+		p: &policy.Policy{
+			Start:   "start",
+			Entries: map[string]string{"renewal": "renew"},
+			Nodes: map[string]*policy.Node{
+				"start": {ID: "start", Outgoing: []policy.Edge{{To: "ok", Cond: "age >= 18"}}},
+				"renew": {ID: "renew", Outgoing: []policy.Edge{{To: "ok", Cond: "months > 12"}}},
+				"ok":    {ID: "ok"},
+			},
+		},
+	}
+	eng := &fakeEngine{fn: func(p *policy.Policy, vars map[string]any) error { return nil }}
+	s := NewService(comp, eng, &fakeCache{})
+
+	req, _, err := s.Introspect("digraph {}", InferOptions{Entry: "renewal"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(req.Always) != 1 || req.Always[0] != "months" {
+		t.Fatalf("expected months from renewal entry, got %+v", req)
+	}
+	if eng.calls != 0 {
+		t.Fatalf("introspect should not run the engine")
+	}
+
+	if _, _, err := s.Introspect("", InferOptions{}); err == nil {
+		t.Fatalf("expected error for empty policy")
+	}
+}
+
+type countingCompiler struct {
+	calls int
+	inner *policy.Compiler
+}
+
+func (c *countingCompiler) Compile(dot string) (*policy.Policy, error) {
+	c.calls++
+	return c.inner.Compile(dot)
+}
+
+func TestService_InferWithOptions_CanonicalHashSharesCompiledPolicy(t *testing.T) {
+	comp := &countingCompiler{inner: policy.NewCompiler()}
+	var seen []*policy.Policy
+	eng := &fakeEngine{fn: func(p *policy.Policy, vars map[string]any) error {
+		seen = append(seen, p)
+		return nil
+	}}
+	s := NewService(comp, eng, cache.NewInMemory(16))
+	opts := InferOptions{PolicyID: "credit", PolicyVersion: "v1"}
+
+	original := "digraph { start -> ok [cond=\"age>=18\"]; ok [result=\"approved=true\"]; }"
+	reformatted := "digraph Policy {\n  // comentario novo\n  ok [result=\"approved = true\"]\n  start -> ok [cond=\"age >= 18\"]\n}"
+
+	_, first, err := s.InferWithOptions(original, map[string]any{"age": 20.0}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := s.InferWithOptions(reformatted, map[string]any{"age": 20.0}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.InferWithOptions(original, map[string]any{"age": 20.0}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Hash == "" || first.Hash != second.Hash {
+		t.Fatalf("expected same canonical hash, got %q and %q", first.Hash, second.Hash)
+	}
+	if first.RawHash == second.RawHash || first.RawHash == first.Hash {
+		t.Fatalf("expected distinct raw hashes, got %+v and %+v", first, second)
+	}
+	// o texto reformatado ganha uma view com os proprios diagnostics, mas o grafo compilado é o mesmo
+	nodes := func(i int) uintptr { return reflect.ValueOf(seen[i].Nodes).Pointer() }
+	if nodes(0) != nodes(1) || seen[0] != seen[2] {
+		t.Fatalf("expected reformatted policy to reuse the cached compiled policy")
+	}
+	if comp.calls != 2 {
+		t.Fatalf("expected raw text cache hit on third call, compiler ran %d times", comp.calls)
+	}
+}
+
+func TestService_InferWithOptions_CanonicalHitKeepsWarningPositionsOfRequestText(t *testing.T) {
+	s := NewService(policy.NewCompiler(), policy.NewEngine(policy.ExprEvaluator{}), cache.NewInMemory(16))
+
+	original := "digraph {\n start -> ok;\n ok [result=\"approved=true\"];\n orphan [result=\"x=1\"];\n}"
+	reformatted := "digraph {\n\n\n  // linhas a mais\n  orphan [result=\"x=1\"];\n  start -> ok;\n  ok [result=\"approved=true\"];\n}"
+
+	_, first, err := s.InferWithOptions(original, map[string]any{}, InferOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := s.InferWithOptions(reformatted, map[string]any{}, InferOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Hash != second.Hash || len(first.Warnings) != 1 || len(second.Warnings) != 1 {
+		t.Fatalf("expected shared policy with one warning each, got %+v and %+v", first, second)
+	}
+	if first.Warnings[0].Line != 4 || second.Warnings[0].Line != 5 {
+		t.Fatalf("warnings must point into the request text, got lines %d and %d", first.Warnings[0].Line, second.Warnings[0].Line)
+	}
+}
+
+func TestService_InferContext_AppliesRequestTimeout(t *testing.T) {
+	comp := &fakeCompiler{
+		p: &policy.Policy{Start: "start", Nodes: map[string]*policy.Node{"start": {ID: "start"}}},
+	}
+	s := NewService(comp, policy.NewEngine(policy.ExprEvaluator{}), &fakeCache{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, trace, _, err := s.InferWithTraceContext(ctx, "digraph {}", map[string]any{}, InferOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if trace == nil || trace.Terminated != "error_canceled" {
+		t.Fatalf("expected error_canceled trace, got %+v", trace)
+	}
+
+	eng := &fakeEngine{fn: func(p *policy.Policy, vars map[string]any) error {
+		t.Fatalf("engine without context support should not run with a cancelled context")
+		return nil
+	}}
+	if _, _, err := NewService(comp, eng, &fakeCache{}).InferContext(ctx, "digraph {}", map[string]any{}, InferOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	ctxEng := &fakeContextEngine{}
+	if _, _, err := NewService(comp, ctxEng, &fakeCache{}).InferContext(context.Background(), "digraph {}", map[string]any{}, InferOptions{Timeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if !ctxEng.hasDeadline {
+		t.Fatalf("expected request timeout to become a context deadline")
+	}
+}
+
+type fakeContextEngine struct {
+	hasDeadline bool
+}
+
+func (f *fakeContextEngine) Run(p *policy.Policy, vars map[string]any) error { return nil }
+
+func (f *fakeContextEngine) RunContext(ctx context.Context, p *policy.Policy, vars map[string]any) error {
+	_, f.hasDeadline = ctx.Deadline()
+	return nil
+}
+
+func TestService_Counterfactual_UsesEntryAndRequiresSupportingEngine(t *testing.T) {
+	dot := `digraph {
+	entry_renewal="renew";
+	start -> approved [cond="score > 700"];
+	start -> rejected [default=true];
+	renew -> approved [cond="months >= 12"];
+	renew -> rejected [default=true];
+	approved [result="approved=true"];
+	rejected [result="approved=false"];
+}`
+	s := NewService(policy.NewCompiler(), policy.NewEngine(policy.ExprEvaluator{}), cache.NewInMemory(16))
+
+	input := map[string]any{"score": 800.0, "months": 3.0}
+	res, _, err := s.Counterfactual(context.Background(), dot, input, CounterfactualTarget{Node: "approved"}, InferOptions{Entry: "renewal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.AlreadyReached || len(res.Options) != 1 || res.Options[0].Changes[0].Var != "months" || res.Options[0].Changes[0].Suggested != 12.0 {
+		t.Fatalf("expected months change from renewal entry, got %+v", res)
+	}
+	if input["months"] != 3.0 {
+		t.Fatalf("input must not be mutated")
+	}
+
+	plain := NewService(policy.NewCompiler(), &fakeEngine{fn: func(p *policy.Policy, vars map[string]any) error { return nil }}, &fakeCache{})
+	if _, _, err := plain.Counterfactual(context.Background(), dot, input, CounterfactualTarget{Node: "approved"}, InferOptions{}); err == nil {
+		t.Fatalf("expected error for engine without counterfactual support")
+	}
+}
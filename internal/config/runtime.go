@@ -10,6 +10,9 @@ type Runtime struct {
 	CacheMaxItems  int
 	PolicyMaxSteps int
 	ObsBuffer      int
+	StrictLint     bool
+	// PolicyDir é o diretorio com as policies chamaveis via call=... (arquivo kyc@v3.dot vira "kyc@v3").
+	PolicyDir string
 }
 
 func Load() Runtime {
@@ -18,6 +21,8 @@ func Load() Runtime {
 		CacheMaxItems:  getenvInt("POLICY_CACHE_MAX_ITEMS", 1024, 1),
 		PolicyMaxSteps: getenvInt("POLICY_MAX_STEPS", 10_000, 1),
 		ObsBuffer:      getenvInt("POLICY_OBS_BUFFER", 4096, 1),
+		StrictLint:     getenvBool("POLICY_STRICT_LINT", false),
+		PolicyDir:      getenv("POLICY_DIR", ""),
 	}
 }
 
@@ -39,3 +44,15 @@ func getenvInt(key string, fallback, min int) int {
 	}
 	return v
 }
+
+func getenvBool(key string, fallback bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fallback
+	}
+	return v
+}
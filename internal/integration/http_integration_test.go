@@ -264,6 +264,34 @@ func TestHTTPInfer_PolicyVersioningValidAndInvalid(t *testing.T) {
 	})
 }
 
+func TestHTTPInfer_JSONPolicyFormat(t *testing.T) {
+	srv := newInferServer()
+	defer srv.Close()
+
+	status, out, body := postInfer(t, srv, `{
+		"policy_format": "json",
+		"policy": {
+			"nodes": [
+				{"id": "start"},
+				{"id": "approved", "result": {"approved": true, "segment": "prime"}},
+				{"id": "rejected", "result": {"approved": false}}
+			],
+			"edges": [
+				{"from": "start", "to": "approved", "cond": "score>700", "priority": 1},
+				{"from": "start", "to": "rejected", "default": true}
+			]
+		},
+		"input": {"score": 720}
+	}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", status, body)
+	}
+	output := out["output"].(map[string]any)
+	if output["approved"] != true || output["segment"] != "prime" {
+		t.Fatalf("unexpected output: %#v", output)
+	}
+}
+
 func TestHTTPInfer_RejectsCycleDOT(t *testing.T) {
 	srv := newInferServer()
 	defer srv.Close()
@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+)
+
+// Canonical serializa a policy compilada num texto que só depende da semantica:
+// nós em ordem de ID, arestas na ordem efetiva (priority já aplicada, entao o numero nao entra),
+// conds e $(...) reescritas pela AST do expr e valores do result no formato do FormatValue.
+// Espaço, comentario, ordem de declaração no DOT, posição e diagnostics do lint ficam de fora.
+func Canonical(p *Policy) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "start %s\n", p.Start)
+
+	names := make([]string, 0, len(p.Entries))
+	for name := range p.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "entry %s %s\n", name, p.Entries[name])
+	}
+	if p.Timeout > 0 {
+		fmt.Fprintf(&b, "timeout %s\n", p.Timeout)
+	}
+	for _, f := range p.Inputs {
+		fmt.Fprintf(&b, "input %s %s\n", f.Name, formatInputField(f))
+	}
+	for _, f := range p.Outputs {
+		fmt.Fprintf(&b, "output %s %s\n", f.Name, formatInputField(f))
+	}
+	consts := make([]string, 0, len(p.Constants))
+	for name := range p.Constants {
+		consts = append(consts, name)
+	}
+	sort.Strings(consts)
+	for _, name := range consts {
+		kind := "const"
+		if _, isList := p.Constants[name].([]any); isList {
+			kind = "list"
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", kind, name, formatConstValue(p.Constants[name]))
+	}
+	for _, d := range p.Derived {
+		fmt.Fprintf(&b, "derived %s %s\n", d.Name, canonicalExpr(d.Expr.Source()))
+	}
+
+	for _, id := range sortedNodeIDs(p) {
+		node := p.Nodes[id]
+		fmt.Fprintf(&b, "node %s\n", id)
+		if node.Call != nil {
+			sub := ""
+			if node.Call.Policy != nil {
+				sub = CanonicalHash(node.Call.Policy)
+			}
+			fmt.Fprintf(&b, "  call %s %s\n", node.Call.Ref, sub)
+		}
+		if node.Fanout != "" {
+			fmt.Fprintf(&b, "  fanout %s\n", node.Fanout)
+		}
+		if node.Join != "" {
+			fmt.Fprintf(&b, "  join %s\n", node.Join)
+		}
+		for _, a := range node.Result {
+			fmt.Fprintf(&b, "  result %s\n", canonicalAssignment(a))
+		}
+		for _, edge := range node.Outgoing {
+			fmt.Fprintf(&b, "  edge %s", edge.To)
+			if edge.Default {
+				b.WriteString(" default")
+			}
+			if edge.Cond != "" {
+				fmt.Fprintf(&b, " cond %s", canonicalExpr(edge.Cond))
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// CanonicalHash é o sha256 (hex) do Canonical. Policy que saiu do compiler já traz o valor em Hash.
+func CanonicalHash(p *Policy) string {
+	if p.Hash != "" {
+		return p.Hash
+	}
+	sum := sha256.Sum256([]byte(Canonical(p)))
+	return hex.EncodeToString(sum[:])
+}
+
+func canonicalAssignment(a Assignment) string {
+	switch {
+	case a.Op == OpUnset:
+		return "-" + a.Key
+	case a.Expr != nil:
+		return a.Key + " " + a.Op.String() + " $(" + canonicalExpr(a.Expr.Source()) + ")"
+	}
+	return a.Key + " " + a.Op.String() + " " + FormatValue(a.Value)
+}
+
+// canonicalExpr cai no texto cru se o parse falhar; policy compilada nunca chega aqui com expressão invalida.
+func canonicalExpr(src string) string {
+	out, err := eval.Canonical(src)
+	if err != nil {
+		return strings.TrimSpace(src)
+	}
+	return out
+}
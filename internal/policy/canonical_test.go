@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCanonicalHash_IgnoresFormattingAndDeclarationOrder(t *testing.T) {
+	a := mustCompile(t, `digraph {
+	start [result=""];
+	start -> approved [cond="age>=18 && score > 700"];
+	start -> rejected [cond="age<18"];
+	approved [result="approved=true,limit=$(income*3)"];
+	rejected [result="approved=false"];
+}`)
+	b := mustCompile(t, `digraph Policy {
+	// mesma policy, outra cara
+	rejected [result="approved=false"]
+	approved [result="approved = true, limit = $( income * 3 )"]
+	start -> rejected [cond="( age < 18 )", priority=2]
+	start -> approved [cond="age >= 18 && (score > 700)", priority=1]
+}`)
+
+	if a.Hash == "" || a.Hash != b.Hash {
+		t.Fatalf("expected same canonical hash, got %q and %q\n%s\n%s", a.Hash, b.Hash, Canonical(a), Canonical(b))
+	}
+}
+
+func TestCanonicalHash_ChangesWithSemantics(t *testing.T) {
+	base := `digraph {
+	start -> approved [cond="age >= 18"];
+	start -> rejected [cond="age < 18"];
+	approved [result="approved=true"];
+	rejected [result="approved=false"];
+}`
+	variants := map[string]string{
+		"threshold": `digraph {
+	start -> approved [cond="age >= 21"];
+	start -> rejected [cond="age < 21"];
+	approved [result="approved=true"];
+	rejected [result="approved=false"];
+}`,
+		"edge order": `digraph {
+	start -> rejected [cond="age < 18"];
+	start -> approved [cond="age >= 18"];
+	approved [result="approved=true"];
+	rejected [result="approved=false"];
+}`,
+		"result value": `digraph {
+	start -> approved [cond="age >= 18"];
+	start -> rejected [cond="age < 18"];
+	approved [result="approved='yes'"];
+	rejected [result="approved=false"];
+}`,
+		"constant": `digraph {
+	const_min_age=18;
+	start -> approved [cond="age >= 18"];
+	start -> rejected [cond="age < 18"];
+	approved [result="approved=true"];
+	rejected [result="approved=false"];
+}`,
+	}
+
+	want := mustCompile(t, base).Hash
+	for name, src := range variants {
+		if got := mustCompile(t, src).Hash; got == want {
+			t.Fatalf("%s: expected different hash", name)
+		}
+	}
+}
+
+func TestCanonicalHash_SameForDOTAndJSON(t *testing.T) {
+	dot, err := os.ReadFile("testdata/complex.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromDOT := mustCompile(t, string(dot))
+	fromJSON, err := NewCompiler().CompileJSON(complexPolicyJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromDOT.Hash != fromJSON.Hash {
+		t.Fatalf("expected same hash\n%s\n%s", Canonical(fromDOT), Canonical(fromJSON))
+	}
+}
+
+func mustCompile(t *testing.T, dot string) *Policy {
+	t.Helper()
+	p, err := NewCompiler().Compile(dot)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	return p
+}
@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/awalterschulze/gographviz/ast"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+)
+
+// clusterScope sao os atributos de um subgraph/cluster que o compiler aplica no que está dentro dele:
+//
+//	subgraph cluster_kyc {
+//	  namespace="kyc";                  // nós declarados aqui viram kyc.<id>
+//	  result_prefix="checks.kyc";       // result dos nós daqui grava em checks.kyc.<chave>
+//	  guard="country == \"BR\"";        // AND em toda aresta (nao default) escrita aqui
+//	  ...
+//	}
+//
+// Subgraph aninhado compõe com o de fora (namespace e prefixo concatenam, guards viram AND).
+type clusterScope struct {
+	namespace string          // namespace completo (já com o dos clusters de fora)
+	local     map[string]bool // IDs declarados como nó dentro do namespace
+	prefix    []string
+	guard     string
+}
+
+// enterSubgraph lê os atributos do subgraph e empilha o escopo. Atributo desconhecido (label, color...)
+// continua só cosmético.
+func (b *builder) enterSubgraph(sg *ast.SubGraph) {
+	name := string(sg.ID)
+	loc := b.src.subgraph(b.subgraphStmts, name)
+	b.subgraphStmts++
+	attrs := graphAttrs(sg.StmtList)
+	scope := clusterScope{}
+	if len(b.scopes) > 0 {
+		outer := b.scopes[len(b.scopes)-1]
+		scope.namespace = outer.namespace
+		scope.local = outer.local
+		scope.prefix = outer.prefix
+		scope.guard = outer.guard
+	}
+	attrErr := func(attr, format string, args ...any) {
+		b.errs.add(loc.attr(attr), CompileError{Attr: attr, Message: fmt.Sprintf("subgraph %s %s", name, fmt.Sprintf(format, args...))})
+	}
+
+	if ns, ok := attrs["namespace"]; ok {
+		ns = strings.TrimSpace(ns)
+		if !constNameRe.MatchString(ns) {
+			attrErr("namespace", "invalid namespace %q (expected identifier)", ns)
+		} else {
+			if scope.namespace != "" {
+				ns = scope.namespace + "." + ns
+			}
+			scope.namespace = ns
+			scope.local = map[string]bool{}
+			for _, id := range declaredNodes(sg.StmtList) {
+				scope.local[id] = true
+			}
+		}
+	}
+
+	if raw, ok := attrs["result_prefix"]; ok {
+		raw = strings.TrimSpace(raw)
+		path := strings.Split(raw, ".")
+		if !isResultIdent(raw) || containsEmpty(path) {
+			attrErr("result_prefix", "invalid result_prefix %q", raw)
+		} else {
+			scope.prefix = append(scope.prefix[:len(scope.prefix):len(scope.prefix)], path...)
+		}
+	}
+
+	if guard := strings.TrimSpace(attrs["guard"]); guard != "" {
+		if _, err := eval.Compile(guard); err != nil {
+			attrErr("guard", "invalid guard: %v", err)
+		} else {
+			scope.guard = andConds(scope.guard, guard)
+		}
+	}
+
+	b.scopes = append(b.scopes, scope)
+	b.walkStmtList(sg.StmtList)
+	b.scopes = b.scopes[:len(b.scopes)-1]
+}
+
+// resolveID aplica o namespace: ID declarado como nó no cluster ganha o prefixo (o cluster mais de dentro
+// ganha); o resto é do escopo de fora. Referencia qualificada vem entre aspas no DOT ("kyc.check")
+// e perde as aspas pra bater com o ID namespaced, mas só quando o que vem antes do último ponto é um
+// namespace declarado na policy; qualquer outro ID entre aspas continua literal.
+func (b *builder) resolveID(id string) string {
+	for i := len(b.scopes) - 1; i >= 0; i-- {
+		if b.scopes[i].local[id] {
+			return b.scopes[i].namespace + "." + id
+		}
+	}
+	if !strings.HasPrefix(id, `"`) {
+		return id
+	}
+	name := unquote(id)
+	if i := strings.LastIndex(name, "."); i > 0 && b.namespaces[name[:i]] {
+		return name
+	}
+	return id
+}
+
+// declaredNamespaces junta os namespaces completos (kyc, kyc.inner) de todos os subgraphs, pra referencia
+// qualificada escrita antes do cluster também resolver.
+func declaredNamespaces(stmts ast.StmtList, outer string, out map[string]bool) {
+	for _, st := range stmts {
+		sg, ok := st.(*ast.SubGraph)
+		if !ok {
+			continue
+		}
+		ns := outer
+		if name, ok := graphAttrs(sg.StmtList)["namespace"]; ok && constNameRe.MatchString(strings.TrimSpace(name)) {
+			ns = strings.TrimSpace(name)
+			if outer != "" {
+				ns = outer + "." + ns
+			}
+			out[ns] = true
+		}
+		declaredNamespaces(sg.StmtList, ns, out)
+	}
+}
+
+func (b *builder) scope() clusterScope {
+	if len(b.scopes) == 0 {
+		return clusterScope{}
+	}
+	return b.scopes[len(b.scopes)-1]
+}
+
+// prefixResult move os assignments pra baixo do result_prefix do cluster.
+func prefixResult(assignments []Assignment, prefix []string) {
+	if len(prefix) == 0 {
+		return
+	}
+	for i, a := range assignments {
+		path := append(append([]string{}, prefix...), a.path()...)
+		assignments[i].Path = path
+		assignments[i].Key = strings.Join(path, ".")
+	}
+}
+
+func containsEmpty(parts []string) bool {
+	for _, p := range parts {
+		if p == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// andConds junta guard e cond; cond vazia (sempre true) vira só o guard.
+func andConds(guard, cond string) string {
+	switch {
+	case guard == "":
+		return cond
+	case cond == "":
+		return guard
+	}
+	return "(" + guard + ") && (" + cond + ")"
+}
+
+// declaredNodes lista os nós declarados (node stmt) no subgraph, descendo em subgraph aninhado
+// que nao abre namespace próprio.
+func declaredNodes(stmts ast.StmtList) []string {
+	var out []string
+	for _, st := range stmts {
+		switch s := st.(type) {
+		case *ast.NodeStmt:
+			out = append(out, string(s.NodeID.GetID()))
+		case ast.NodeStmt:
+			out = append(out, string(s.NodeID.GetID()))
+		case *ast.SubGraph:
+			if _, ok := graphAttrs(s.StmtList)["namespace"]; !ok {
+				out = append(out, declaredNodes(s.StmtList)...)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package policy
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompiler_ClusterNamespaceGuardAndResultPrefix(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	start -> "kyc.check";
+	subgraph cluster_kyc {
+		namespace="kyc";
+		result_prefix="checks.kyc";
+		guard="country == \"BR\"";
+		check [result="started=true"];
+		ok [result="passed=true"];
+		fail [result="passed=false"];
+		check -> ok [cond="document_ok"];
+		check -> fail [default=true];
+		subgraph cluster_inner {
+			namespace="inner";
+			guard="age >= 18";
+			check [result="adult=true"];
+			check -> done;
+		}
+	}
+	done [result="finished=true"];
+}`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	for _, id := range []string{"kyc.check", "kyc.ok", "kyc.fail", "kyc.inner.check", "done"} {
+		if p.Nodes[id] == nil {
+			t.Fatalf("expected node %s, got %v", id, sortedNodeIDs(p))
+		}
+	}
+	if p.Nodes["check"] != nil || p.Nodes["ok"] != nil {
+		t.Fatalf("namespaced nodes should not leak raw ids: %v", sortedNodeIDs(p))
+	}
+
+	edges := p.Nodes["kyc.check"].Outgoing
+	if edges[0].To != "kyc.ok" || edges[0].Cond != `(country == "BR") && (document_ok)` {
+		t.Fatalf("unexpected guarded edge: %+v", edges[0])
+	}
+	if edges[1].To != "kyc.fail" || edges[1].Cond != "" || !edges[1].Default {
+		t.Fatalf("default edge should stay unguarded: %+v", edges[1])
+	}
+	inner := p.Nodes["kyc.inner.check"].Outgoing[0]
+	if inner.To != "done" || inner.Cond != `(country == "BR") && (age >= 18)` {
+		t.Fatalf("unexpected nested edge: %+v", inner)
+	}
+
+	if a := p.Nodes["kyc.ok"].Result[0]; a.Key != "checks.kyc.passed" || !reflect.DeepEqual(a.Path, []string{"checks", "kyc", "passed"}) {
+		t.Fatalf("unexpected prefixed result: %+v", a)
+	}
+	if a := p.Nodes["done"].Result[0]; a.Key != "finished" {
+		t.Fatalf("result outside the cluster should not be prefixed: %+v", a)
+	}
+
+	vars := map[string]any{"country": "BR", "document_ok": true}
+	if err := NewEngine(ExprEvaluator{}).Run(p, vars); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	checks := vars["checks"].(map[string]any)["kyc"].(map[string]any)
+	if checks["started"] != true || checks["passed"] != true {
+		t.Fatalf("unexpected output: %v", vars)
+	}
+
+	// a policy achatada continua a mesma depois do ToDOT
+	again, err := NewCompiler().Compile(ToDOT(p))
+	if err != nil {
+		t.Fatalf("recompile: %v\n%s", err, ToDOT(p))
+	}
+	if !reflect.DeepEqual(summarize(again), summarize(p)) {
+		t.Fatalf("round trip differs")
+	}
+}
+
+func TestCompiler_InvalidClusterAttributes(t *testing.T) {
+	cases := map[string]string{
+		`namespace="a b"`:       `subgraph cluster_x invalid namespace "a b"`,
+		`result_prefix="a..b"`:  `subgraph cluster_x invalid result_prefix "a..b"`,
+		`guard="score + 1 > 2"`: `subgraph cluster_x invalid guard: arithmetic operator "+" is not allowed`,
+	}
+	for attr, want := range cases {
+		_, err := NewCompiler().Compile("digraph {\n{ a b }\nsubgraph cluster_x {\n  " + attr + ";\nstart [result=\"ok=true\"];\n}\n}")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected %q, got %v", attr, want, err)
+		}
+		var errs CompileErrors
+		if !errors.As(err, &errs) || errs[0].Line != 4 || errs[0].Column != 3 {
+			t.Fatalf("%s: expected error at the attribute (4:3), got %+v", attr, errs)
+		}
+	}
+}
+
+func TestCompiler_QuotedDottedIDOnlyResolvesDeclaredNamespace(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	start -> "kyc.check";
+	start -> "v1.2";
+	subgraph cluster_kyc {
+		namespace="kyc";
+		check [result="ok=true"];
+	}
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Nodes["kyc.check"] == nil || p.Nodes[`"v1.2"`] == nil || p.Nodes["v1.2"] != nil {
+		t.Fatalf("only the declared namespace should be unquoted, got %v", sortedNodeIDs(p))
+	}
+}
@@ -3,6 +3,7 @@ package policy
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/awalterschulze/gographviz"
@@ -11,107 +12,233 @@ import (
 	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
 )
 
-type Compiler struct{}
+type Compiler struct {
+	strict   bool
+	resolver PolicyResolver
+}
+
+type CompilerOption func(*Compiler)
+
+// WithStrictLint faz warnings do Lint virarem erro de compile.
+func WithStrictLint(strict bool) CompilerOption {
+	return func(c *Compiler) {
+		c.strict = strict
+	}
+}
+
+// WithPolicyResolver liga os nós call="kyc@v3" (normalmente um *Registry).
+// Sem resolver, policy com call é erro de compile.
+func WithPolicyResolver(r PolicyResolver) CompilerOption {
+	return func(c *Compiler) {
+		c.resolver = r
+	}
+}
 
-func NewCompiler() *Compiler { return &Compiler{} }
+func NewCompiler(opts ...CompilerOption) *Compiler {
+	c := &Compiler{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
 
 // Compile pega o DOT cru, monta a Policy em memoria e já valida ciclo.
 // Se a policy tiver ruim (parse ou semantica), da um failfast aqui pra nao estourar no runtime.
+// Os erros voltam todos juntos como CompileErrors, com linha/coluna do DOT.
+// Diagnosticos do Lint ficam em Policy.Diagnostics (warnings viram erro no modo strict).
 func (c *Compiler) Compile(dot string) (*Policy, error) {
 	g, err := gographviz.ParseString(dot)
 	if err != nil {
-		return nil, fmt.Errorf("parse DOT: %w", err)
+		var errs CompileErrors
+		errs.add(parseErrorPos(err), CompileError{Message: fmt.Sprintf("parse DOT: %v", err)})
+		return nil, errs
 	}
 
-	p := &Policy{
-		Start: "start",
-		Nodes: map[string]*Node{},
+	b := &builder{
+		p: &Policy{
+			Start: defaultStart,
+			Nodes: map[string]*Node{},
+		},
+		src:        indexSource(dot),
+		namespaces: map[string]bool{},
 	}
+	declaredNamespaces(g.StmtList, "", b.namespaces)
+	b.walkStmtList(g.StmtList)
 
-	if err := walkStmtList(p, g.StmtList); err != nil {
-		return nil, err
+	return c.finish(b.p, graphAttrs(g.StmtList), b.src, b.errs)
+}
+
+// finish roda as etapas comuns depois do grafo montado: ordem das arestas, entries, DAG e lint.
+func (c *Compiler) finish(p *Policy, attrs map[string]string, src *sourceIndex, errs CompileErrors) (*Policy, error) {
+	orderEdges(p, &errs)
+	applyEntries(p, attrs, src, &errs)
+	applySchemas(p, attrs, src, &errs)
+	applyTimeout(p, attrs, src, &errs)
+	applyConstants(p, attrs, src, &errs)
+	applyDerived(p, attrs, src, &errs)
+	resolveCalls(p, c.resolver, &errs)
+	typeCheckConds(p, &errs)
+	validateResultPaths(p, &errs)
+	validateAcyclic(p, &errs)
+	if len(errs) == 0 {
+		validateFanouts(p, &errs)
+	}
+	if len(errs) == 0 {
+		validateOutputContract(p, &errs)
+	}
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
-	ensureNode(p, p.Start)
-	if err := validateAcyclic(p); err != nil {
-		return nil, err
+	p.Diagnostics = Lint(p)
+	if HasSeverity(p.Diagnostics, SeverityError) || (c.strict && HasSeverity(p.Diagnostics, SeverityWarning)) {
+		return nil, lintErrors(p.Diagnostics)
 	}
 
+	p.Hash = CanonicalHash(p)
 	return p, nil
 }
 
-func walkStmtList(p *Policy, stmts ast.StmtList) error {
+func lintErrors(diags []Diagnostic) CompileErrors {
+	var errs CompileErrors
+	for _, d := range diags {
+		if d.Severity == SeverityInfo {
+			continue
+		}
+		errs.add(Pos{Line: d.Line, Column: d.Column}, CompileError{
+			Node:    d.Node,
+			Edge:    d.Edge,
+			Message: "lint " + d.String(),
+		})
+	}
+	return errs
+}
+
+// builder carrega o estado de um compile de DOT: policy em construção, indice de posições e erros acumulados.
+// nodeStmts/edgeStmts/subgraphStmts andam junto com o sourceIndex pra achar a posição de cada stmt.
+type builder struct {
+	p             *Policy
+	src           *sourceIndex
+	errs          CompileErrors
+	nodeStmts     int
+	edgeStmts     int
+	subgraphStmts int
+	scopes        []clusterScope  // subgraphs abertos, do de fora pro de dentro
+	namespaces    map[string]bool // todos os namespaces declarados (ver declaredNamespaces)
+}
+
+func (b *builder) walkStmtList(stmts ast.StmtList) {
 	for _, st := range stmts {
 		switch s := st.(type) {
 
 		case *ast.NodeStmt:
-			if err := applyNodeStmt(p, s); err != nil {
-				return err
-			}
+			b.applyNodeStmt(s)
 
 		case ast.NodeStmt:
 			tmp := s
-			if err := applyNodeStmt(p, &tmp); err != nil {
-				return err
-			}
+			b.applyNodeStmt(&tmp)
 
 		case *ast.EdgeStmt:
-			if err := applyEdgeStmt(p, s); err != nil {
-				return err
-			}
+			b.applyEdgeStmt(s)
 
 		case ast.EdgeStmt:
 			tmp := s
-			if err := applyEdgeStmt(p, &tmp); err != nil {
-				return err
-			}
+			b.applyEdgeStmt(&tmp)
 
 		case *ast.SubGraph:
-			if err := walkStmtList(p, s.StmtList); err != nil {
-				return err
-			}
+			b.enterSubgraph(s)
 		}
 	}
-	return nil
 }
 
-// applyNodeStmt lê o result do nó (ex: approved=true,segment=prime) e guarda no modelo.
-func applyNodeStmt(p *Policy, ns *ast.NodeStmt) error {
+// applyNodeStmt lê o result do nó (ex: approved=true,segment=prime), o call (sub-policy) e o fanout/join
+// e guarda no modelo.
+func (b *builder) applyNodeStmt(ns *ast.NodeStmt) {
 	if ns == nil || ns.NodeID == nil {
-		return nil
+		return
 	}
+	rawID := string(ns.NodeID.GetID())
+	loc := b.src.node(b.nodeStmts, rawID)
+	b.nodeStmts++
 
-	id := string(ns.NodeID.GetID())
-	node := ensureNode(p, id)
+	id := b.resolveID(rawID)
+	node := b.touchNode(id, loc.pos)
 
 	attrs := ns.Attrs.GetMap()
-	raw := strings.TrimSpace(unquote(attrs["result"]))
+	if ref := strings.TrimSpace(unquote(attrs["call"])); ref != "" {
+		node.Call = &PolicyCall{Ref: ref}
+	}
+	if join := strings.TrimSpace(unquote(attrs["fanout"])); join != "" {
+		node.Fanout = b.resolveID(join)
+	}
+	if strategy, ok := attrs["join"]; ok {
+		node.Join = MergeStrategy(strings.TrimSpace(unquote(strategy)))
+	}
+	raw := strings.TrimSpace(unquoteValue(attrs["result"]))
 
 	assignments, err := ParseResult(raw)
 	if err != nil {
-		return fmt.Errorf("node %s invalid result: %w", id, err)
+		b.errs.add(loc.attr("result"), CompileError{
+			Node:    id,
+			Attr:    "result",
+			Message: fmt.Sprintf("node %s invalid result: %v", id, err),
+		})
+		return
 	}
 
+	prefixResult(assignments, b.scope().prefix)
 	node.Result = assignments
-	return nil
 }
 
 // applyEdgeStmt liga os nós e prepara a cond da aresta.
-// A primeira aresta da chain recebe cond; as proximas ficam sem cond (sempre true).
-func applyEdgeStmt(p *Policy, es *ast.EdgeStmt) error {
+// A primeira aresta da chain recebe cond/default/priority; as proximas ficam sem cond (sempre true).
+func (b *builder) applyEdgeStmt(es *ast.EdgeStmt) {
 	if es == nil {
-		return nil
+		return
 	}
+	rawFrom := string(es.Source.GetID())
+	loc := b.src.edge(b.edgeStmts, rawFrom)
+	b.edgeStmts++
 
-	from := string(es.Source.GetID())
-	ensureNode(p, from)
+	from := b.resolveID(rawFrom)
+	b.touchNode(from, loc.pos)
+
+	first := &EdgeRef{From: from}
+	if len(es.EdgeRHS) > 0 && es.EdgeRHS[0] != nil {
+		first.To = b.resolveID(string(es.EdgeRHS[0].Destination.GetID()))
+	}
+	guard := b.scope().guard
+	attrErr := func(attr, format string, args ...any) {
+		b.errs.add(loc.attr(attr), CompileError{
+			Node:    from,
+			Edge:    first,
+			Attr:    attr,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
 
 	attrs := es.Attrs.GetMap()
-	cond := strings.TrimSpace(unquote(attrs["cond"]))
+	cond := strings.TrimSpace(unquoteValue(attrs["cond"]))
 
 	compiledCond, err := eval.Compile(cond)
 	if err != nil {
-		return fmt.Errorf("edge %s invalid cond: %w", from, err)
+		attrErr("cond", "edge %s invalid cond: %v", from, err)
+	}
+
+	isDefault, err := parseBoolAttr(attrs["default"])
+	if err != nil {
+		attrErr("default", "edge %s invalid default: %v", from, err)
+	}
+	if isDefault && cond != "" {
+		attrErr("default", "edge %s: default edge cannot have cond", from)
+	}
+
+	priority, err := parsePriorityAttr(attrs["priority"])
+	if err != nil {
+		attrErr("priority", "edge %s invalid priority: %v", from, err)
+	}
+	if isDefault && priority != nil {
+		attrErr("priority", "edge %s: default edge cannot have priority", from)
 	}
 
 	prev := from
@@ -120,26 +247,193 @@ func applyEdgeStmt(p *Policy, es *ast.EdgeStmt) error {
 			continue
 		}
 
-		to := string(rh.Destination.GetID())
-		ensureNode(p, to)
+		to := b.resolveID(string(rh.Destination.GetID()))
+		b.touchNode(to, loc.hop(i+1))
 
 		edgeCond := ""
 		var edgeCompiled *eval.Compiled
+		edgeDefault := false
+		var edgePriority *int
 		if i == 0 {
 			edgeCond = cond
 			edgeCompiled = compiledCond
+			edgeDefault = isDefault
+			edgePriority = priority
+		}
+
+		if guard != "" && !edgeDefault {
+			edgeCond = andConds(guard, edgeCond)
+			edgeCompiled, err = eval.Compile(edgeCond)
+			if err != nil {
+				edgeCompiled = nil // o erro da cond já foi reportado acima
+			}
 		}
 
-		p.Nodes[prev].Outgoing = append(p.Nodes[prev].Outgoing, Edge{
+		b.p.Nodes[prev].Outgoing = append(b.p.Nodes[prev].Outgoing, Edge{
 			To:           to,
 			Cond:         edgeCond,
 			CompiledCond: edgeCompiled,
+			Default:      edgeDefault,
+			Priority:     edgePriority,
+			Pos:          loc.hop(i),
 		})
 
 		prev = to
 	}
+}
 
-	return nil
+// touchNode garante o nó e guarda a posição da primeira vez que ele aparece no DOT.
+func (b *builder) touchNode(id string, pos Pos) *Node {
+	n := ensureNode(b.p, id)
+	if !n.Pos.IsValid() {
+		n.Pos = pos
+	}
+	return n
+}
+
+// graphAttrs junta os atributos de grafo do nivel raiz (entry="x" solto ou graph [entry="x"]).
+func graphAttrs(stmts ast.StmtList) map[string]string {
+	attrs := map[string]string{}
+	for _, st := range stmts {
+		switch s := st.(type) {
+		case *ast.Attr:
+			attrs[unquote(s.Field.String())] = unquoteValue(s.Value.String())
+		case ast.GraphAttrs:
+			for k, v := range ast.AttrList(s).GetMap() {
+				attrs[unquote(k)] = unquoteValue(v)
+			}
+		}
+	}
+	return attrs
+}
+
+// applyEntries resolve o entry default (entry=...) e os entries nomeados (entry_<nome>=...).
+// Entry declarado tem que existir no grafo; só o "start" implicito é criado vazio pra manter compat.
+func applyEntries(p *Policy, attrs map[string]string, src *sourceIndex, errs *CompileErrors) {
+	if entry, ok := attrs["entry"]; ok {
+		entry = strings.TrimSpace(entry)
+		if _, exists := p.Nodes[entry]; exists {
+			p.Start = entry
+		} else {
+			errs.add(src.graphAttr("entry"), CompileError{
+				Node:    entry,
+				Attr:    "entry",
+				Message: fmt.Sprintf("entry node %q does not exist", entry),
+			})
+		}
+	} else {
+		ensureNode(p, p.Start)
+	}
+
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name, ok := strings.CutPrefix(key, "entry_")
+		if !ok {
+			continue
+		}
+		if name == "" {
+			errs.add(src.graphAttr(key), CompileError{
+				Attr:    key,
+				Message: fmt.Sprintf("entry attribute %q has empty name", key),
+			})
+			continue
+		}
+
+		id := strings.TrimSpace(attrs[key])
+		if _, exists := p.Nodes[id]; !exists {
+			errs.add(src.graphAttr(key), CompileError{
+				Node:    id,
+				Attr:    key,
+				Message: fmt.Sprintf("entry %q points to unknown node %q", name, id),
+			})
+			continue
+		}
+		if p.Entries == nil {
+			p.Entries = map[string]string{}
+		}
+		p.Entries[name] = id
+	}
+}
+
+// orderEdges monta a ordem efetiva de avaliação de cada nó, pra nao depender da ordem do DOT:
+// primeiro as arestas com priority (menor valor primeiro), depois as sem priority na ordem declarada
+// e por fim a default (no maximo uma por nó).
+func orderEdges(p *Policy, errs *CompileErrors) {
+	for _, id := range sortedNodeIDs(p) {
+		node := p.Nodes[id]
+
+		defaults := 0
+		var prioritized, plain []Edge
+		var fallback Edge
+		seen := map[int]string{}
+		for _, edge := range node.Outgoing {
+			switch {
+			case edge.Default:
+				defaults++
+				fallback = edge
+			case edge.Priority != nil:
+				if other, dup := seen[*edge.Priority]; dup {
+					errs.add(edge.Pos, CompileError{
+						Node:    id,
+						Edge:    &EdgeRef{From: id, To: edge.To},
+						Attr:    "priority",
+						Message: fmt.Sprintf("node %s has duplicate edge priority %d (-> %s and -> %s)", id, *edge.Priority, other, edge.To),
+					})
+					continue
+				}
+				seen[*edge.Priority] = edge.To
+				prioritized = append(prioritized, edge)
+			default:
+				plain = append(plain, edge)
+			}
+		}
+
+		if defaults > 1 {
+			errs.add(fallback.Pos, CompileError{
+				Node:    id,
+				Edge:    &EdgeRef{From: id, To: fallback.To},
+				Attr:    "default",
+				Message: fmt.Sprintf("node %s has %d default edges (at most one allowed)", id, defaults),
+			})
+		}
+
+		sort.SliceStable(prioritized, func(i, j int) bool {
+			return *prioritized[i].Priority < *prioritized[j].Priority
+		})
+
+		ordered := make([]Edge, 0, len(node.Outgoing))
+		ordered = append(ordered, prioritized...)
+		ordered = append(ordered, plain...)
+		if defaults > 0 {
+			ordered = append(ordered, fallback)
+		}
+		node.Outgoing = ordered
+	}
+}
+
+func parsePriorityAttr(raw string) (*int, error) {
+	raw = strings.TrimSpace(unquote(raw))
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func parseBoolAttr(raw string) (bool, error) {
+	raw = strings.TrimSpace(unquote(raw))
+	if raw == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(raw)
 }
 
 func ensureNode(p *Policy, id string) *Node {
@@ -152,6 +446,7 @@ func ensureNode(p *Policy, id string) *Node {
 	return n
 }
 
+// unquote tira as aspas de fora do ID do DOT (nó, nome de atributo, ref de call/fanout). Conteudo fica literal.
 func unquote(s string) string {
 	s = strings.TrimSpace(s)
 
@@ -165,9 +460,67 @@ func unquote(s string) string {
 	return s
 }
 
+// unquoteValue é o unquote dos valores que carregam expressão ou literal (cond, result e atributos de grafo
+// como derived_/const_/input_): em string com aspas duplas, o unico escape do DOT é \" (ex: cond="segment==\"prime\"").
+func unquoteValue(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `\"`, `"`)
+	}
+	return unquote(s)
+}
+
+// validateResultPaths garante que nenhum caminho pontuado do result passa por uma chave
+// que outro nó (ou o mesmo) grava como escalar. Ex: risk=high num nó e risk.score=10 em outro.
+// Object literal no meio do caminho é ok, ele só é mesclado.
+func validateResultPaths(p *Policy, errs *CompileErrors) {
+	type setter struct {
+		node string
+		a    Assignment
+	}
+
+	var all []setter
+	for _, id := range sortedNodeIDs(p) {
+		for _, a := range p.Nodes[id].Result {
+			if a.Op == OpUnset {
+				continue // remover nunca conflita
+			}
+			all = append(all, setter{node: id, a: a})
+		}
+	}
+
+	for _, nested := range all {
+		path := nested.a.path()
+		for _, scalar := range all {
+			if _, isMap := scalar.a.Value.(map[string]any); isMap {
+				continue
+			}
+			prefix := scalar.a.path()
+			if len(prefix) >= len(path) || !hasPathPrefix(path, prefix) {
+				continue
+			}
+			errs.add(p.Nodes[nested.node].Pos, CompileError{
+				Node: nested.node,
+				Attr: "result",
+				Message: fmt.Sprintf("node %s result path %q conflicts with scalar %q set in node %s",
+					nested.node, nested.a.Key, scalar.a.Key, scalar.node),
+			})
+		}
+	}
+}
+
+func hasPathPrefix(path, prefix []string) bool {
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // validateAcyclic roda DFS simples com marcação de cor.
-// Se achar back-edge, já devolve um erro mostrando o caminho do ciclo.
-func validateAcyclic(p *Policy) error {
+// Se achar back-edge, já devolve um erro mostrando o caminho do ciclo (na posição da aresta que fecha ele).
+func validateAcyclic(p *Policy, errs *CompileErrors) {
 	const (
 		unseen = iota
 		visiting
@@ -178,8 +531,8 @@ func validateAcyclic(p *Policy) error {
 	stack := make([]string, 0, len(p.Nodes))
 	pos := make(map[string]int, len(p.Nodes))
 
-	var dfs func(string) error
-	dfs = func(id string) error {
+	var dfs func(string) *CompileError
+	dfs = func(id string) *CompileError {
 		colors[id] = visiting
 		pos[id] = len(stack)
 		stack = append(stack, id)
@@ -195,7 +548,13 @@ func validateAcyclic(p *Policy) error {
 				start := pos[next]
 				cycle := append([]string{}, stack[start:]...)
 				cycle = append(cycle, next)
-				return fmt.Errorf("policy graph contains cycle: %s", strings.Join(cycle, " -> "))
+				return &CompileError{
+					Line:    edge.Pos.Line,
+					Column:  edge.Pos.Column,
+					Node:    id,
+					Edge:    &EdgeRef{From: id, To: next},
+					Message: fmt.Sprintf("policy graph contains cycle: %s", strings.Join(cycle, " -> ")),
+				}
 			}
 		}
 
@@ -205,20 +564,13 @@ func validateAcyclic(p *Policy) error {
 		return nil
 	}
 
-	ids := make([]string, 0, len(p.Nodes))
-	for id := range p.Nodes {
-		ids = append(ids, id)
-	}
-	sort.Strings(ids)
-
-	for _, id := range ids {
+	for _, id := range sortedNodeIDs(p) {
 		if colors[id] != unseen {
 			continue
 		}
 		if err := dfs(id); err != nil {
-			return err
+			*errs = append(*errs, err)
+			return
 		}
 	}
-
-	return nil
 }
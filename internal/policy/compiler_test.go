@@ -1,7 +1,9 @@
 package policy
 
 import (
+	"errors"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -47,3 +49,286 @@ func TestCompiler_RejectsCycle(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestCompiler_EntryAttributeSetsStart(t *testing.T) {
+	compiler := NewCompiler()
+	p, err := compiler.Compile(`digraph {
+		entry="intake";
+		intake -> ok [cond="age>=18"];
+		ok [result="approved=true"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Start != "intake" {
+		t.Fatalf("expected start intake, got %q", p.Start)
+	}
+	if _, ok := p.Nodes["start"]; ok {
+		t.Fatalf("expected no implicit start node when entry is declared")
+	}
+}
+
+func TestCompiler_NamedEntries(t *testing.T) {
+	compiler := NewCompiler()
+	p, err := compiler.Compile(`digraph {
+		graph [entry_pre_approval="pre", entry_final_approval="final"];
+		start -> pre [cond="x==1"];
+		pre -> final [cond="y==1"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Entries["pre_approval"] != "pre" || p.Entries["final_approval"] != "final" {
+		t.Fatalf("unexpected entries: %#v", p.Entries)
+	}
+
+	view, err := p.ForEntry("final_approval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if view.Start != "final" || p.Start != "start" {
+		t.Fatalf("expected view start final and original untouched, got %q / %q", view.Start, p.Start)
+	}
+
+	if _, err := p.ForEntry("nope"); err == nil {
+		t.Fatalf("expected unknown entry error")
+	}
+}
+
+func TestCompiler_RejectsUnknownEntry(t *testing.T) {
+	compiler := NewCompiler()
+	_, err := compiler.Compile(`digraph {
+		entry="intake";
+		start -> ok [cond="age>=18"];
+	}`)
+	if err == nil || !strings.Contains(err.Error(), `entry node "intake" does not exist`) {
+		t.Fatalf("expected unknown entry error, got %v", err)
+	}
+
+	_, err = compiler.Compile(`digraph {
+		entry_final="missing";
+		start -> ok [cond="age>=18"];
+	}`)
+	if err == nil || !strings.Contains(err.Error(), `unknown node "missing"`) {
+		t.Fatalf("expected unknown named entry error, got %v", err)
+	}
+}
+
+func TestCompiler_DefaultEdgeIsEvaluatedLast(t *testing.T) {
+	compiler := NewCompiler()
+	p, err := compiler.Compile(`digraph {
+		start -> review [default=true];
+		start -> approved [cond="score>700"];
+		start -> rejected [cond="score<300"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := p.Nodes["start"].Outgoing
+	if len(out) != 3 || out[2].To != "review" || !out[2].Default {
+		t.Fatalf("expected default edge last, got %#v", out)
+	}
+	for _, d := range p.Diagnostics {
+		if d.Code == "input_gap" {
+			t.Fatalf("expected default edge to close input gap, got %#v", d)
+		}
+	}
+}
+
+func TestCompiler_RejectsInvalidDefaultEdges(t *testing.T) {
+	compiler := NewCompiler()
+	_, err := compiler.Compile(`digraph {
+		start -> a [default=true];
+		start -> b [default=true];
+	}`)
+	if err == nil || !strings.Contains(err.Error(), "at most one allowed") {
+		t.Fatalf("expected multiple default error, got %v", err)
+	}
+
+	_, err = compiler.Compile(`digraph {
+		start -> a [default=true, cond="x==1"];
+	}`)
+	if err == nil || !strings.Contains(err.Error(), "default edge cannot have cond") {
+		t.Fatalf("expected default with cond error, got %v", err)
+	}
+}
+
+func TestCompiler_PrioritySortsOutgoingEdges(t *testing.T) {
+	compiler := NewCompiler()
+	p, err := compiler.Compile(`digraph {
+		start -> review [default=true];
+		start -> legacy [cond="score<100"];
+		start -> adult [cond="age>=18", priority=20];
+		start -> prime [cond="age>=18 && score>700", priority=10];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, edge := range p.Nodes["start"].Outgoing {
+		order = append(order, edge.To)
+	}
+	if strings.Join(order, ",") != "prime,adult,legacy,review" {
+		t.Fatalf("unexpected effective order: %v", order)
+	}
+}
+
+func TestCompiler_RejectsDuplicatePriority(t *testing.T) {
+	compiler := NewCompiler()
+	_, err := compiler.Compile(`digraph {
+		start -> a [cond="x==1", priority=1];
+		start -> b [cond="x==2", priority=1];
+	}`)
+	if err == nil || !strings.Contains(err.Error(), "duplicate edge priority 1") {
+		t.Fatalf("expected duplicate priority error, got %v", err)
+	}
+
+	_, err = compiler.Compile(`digraph {
+		start -> a [cond="x==1", priority=high];
+	}`)
+	if err == nil || !strings.Contains(err.Error(), "invalid priority") {
+		t.Fatalf("expected invalid priority error, got %v", err)
+	}
+}
+
+func TestCompiler_ReturnsAllErrorsWithPositions(t *testing.T) {
+	compiler := NewCompiler()
+	_, err := compiler.Compile(`digraph {
+  start -> ok [cond="age>=18"];
+  ok [result="invalid"];
+  start -> no [cond="x+1>2"];
+}`)
+	if err == nil {
+		t.Fatalf("expected compile errors")
+	}
+
+	var errs CompileErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected CompileErrors, got %T (%v)", err, err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(errs), err)
+	}
+
+	result := errs[0]
+	if result.Node != "ok" || result.Attr != "result" || result.Line != 3 || result.Column != 7 {
+		t.Fatalf("unexpected result error: %#v", result)
+	}
+
+	cond := errs[1]
+	if cond.Edge == nil || cond.Edge.From != "start" || cond.Edge.To != "no" || cond.Attr != "cond" || cond.Line != 4 || cond.Column != 16 {
+		t.Fatalf("unexpected cond error: %#v", cond)
+	}
+	if !strings.HasPrefix(cond.Error(), "4:16: edge start invalid cond") {
+		t.Fatalf("unexpected error text: %q", cond.Error())
+	}
+}
+
+func TestCompiler_ScannerDesyncDropsPositionsInsteadOfMisattributing(t *testing.T) {
+	// o gographviz lê "1.2.3" como dois IDs ("1.2" e ".3"); o scanner de posições lê um só
+	p, err := NewCompiler().Compile(`digraph {
+  1.2.3 -> b
+  x [result="invalid"];
+  y
+}`)
+	var errs CompileErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("expected single CompileError, got %v (%v)", err, p)
+	}
+	if errs[0].Node != "x" || errs[0].Line != 0 || errs[0].Column != 0 {
+		t.Fatalf("expected error without position, got %#v", errs[0])
+	}
+
+	p, err = NewCompiler().Compile(`digraph {
+  1.2.3 -> b
+  x
+}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, id := range []string{"1.2", ".3", "x"} {
+		if n := p.Nodes[id]; n == nil || n.Pos.IsValid() {
+			t.Fatalf("expected node %s without position, got %#v", id, n)
+		}
+	}
+}
+
+func TestCompiler_ParseErrorHasPosition(t *testing.T) {
+	_, err := NewCompiler().Compile("digraph {\n  start -> \n}")
+	var errs CompileErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("expected single CompileError, got %v", err)
+	}
+	if errs[0].Line != 3 || !strings.Contains(errs[0].Message, "parse DOT") {
+		t.Fatalf("unexpected parse error: %#v", errs[0])
+	}
+}
+
+func TestCompiler_CycleErrorPointsToBackEdge(t *testing.T) {
+	_, err := NewCompiler().Compile(`digraph {
+		start -> a [cond="x==1"];
+		a -> b [cond="y==2"];
+		b -> a [cond="z==3"];
+	}`)
+	var errs CompileErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("expected single CompileError, got %v", err)
+	}
+	if errs[0].Edge == nil || errs[0].Edge.From != "b" || errs[0].Edge.To != "a" || errs[0].Line != 4 {
+		t.Fatalf("unexpected cycle error: %#v", errs[0])
+	}
+}
+
+func TestCompiler_NestedResultPathsMergeIntoOutput(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+		start [result="decision.stage=intake"];
+		start -> ok [cond="age>=18"];
+		ok [result="decision.approved=true,decision.segment=prime,decision.limits={daily: 500}"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := map[string]any{"age": 20, "decision": map[string]any{"source": "input"}}
+	vars := map[string]any{"age": 20, "decision": input["decision"]}
+	if err := NewEngine(ExprEvaluator{}).Run(p, vars); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"source":   "input",
+		"stage":    "intake",
+		"approved": true,
+		"segment":  "prime",
+		"limits":   map[string]any{"daily": 500},
+	}
+	if !reflect.DeepEqual(vars["decision"], want) {
+		t.Fatalf("unexpected decision: %#v", vars["decision"])
+	}
+	if len(input["decision"].(map[string]any)) != 1 {
+		t.Fatalf("input map was mutated: %#v", input["decision"])
+	}
+}
+
+func TestCompiler_RejectsResultPathConflicts(t *testing.T) {
+	_, err := NewCompiler().Compile(`digraph {
+		start -> a [cond="x>1"];
+		start -> b [default=true];
+		a [result="risk=high"];
+		b [result="risk.score=10,decision={approved: false},decision.reason=manual"];
+	}`)
+	var errs CompileErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("expected 1 compile error, got %v", err)
+	}
+	if errs[0].Node != "b" || errs[0].Attr != "result" || !strings.Contains(errs[0].Message, `"risk.score" conflicts with scalar "risk" set in node a`) {
+		t.Fatalf("unexpected error: %#v", errs[0])
+	}
+
+	_, err = NewCompiler().Compile(`digraph { start [result="decision..approved=true"]; }`)
+	if err == nil || !strings.Contains(err.Error(), "empty path segment") {
+		t.Fatalf("expected empty segment error, got %v", err)
+	}
+}
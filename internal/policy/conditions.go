@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+)
+
+// analyzeConditions faz a analise estatica das conds de cada nó na ordem efetiva de avaliação.
+// Como a engine segue a primeira aresta true, uma aresta só dispara quando as anteriores deram false:
+// - unsatisfiable_edge: a cond sozinha nunca é true
+// - shadowed_edge: as arestas anteriores já cobrem tudo que ela cobre
+// - overlapping_edges: duas conds aceitam a mesma entrada (a primeira ganha)
+// - input_gap: existe entrada em que nenhuma aresta casa (vira no_edge_matched em runtime)
+// Nó com cond fora do subconjunto analisavel (ex: var comparada com var) é pulado, e nó de fan-out também
+// (lá toda aresta que casa vira branch, sobreposição é o esperado).
+func analyzeConditions(p *Policy) []Diagnostic {
+	var out []Diagnostic
+	for _, id := range sortedNodeIDs(p) {
+		out = append(out, analyzeNodeConditions(id, p.Nodes[id], p.Constants)...)
+	}
+	return out
+}
+
+func analyzeNodeConditions(id string, node *Node, consts map[string]any) []Diagnostic {
+	if len(node.Outgoing) == 0 || node.Fanout != "" {
+		return nil
+	}
+
+	conds := make([]eval.DNF, len(node.Outgoing))
+	for i, edge := range node.Outgoing {
+		dnf, err := eval.Constraints(edge.Cond, eval.WithConstants(consts))
+		if err != nil {
+			return nil
+		}
+		conds[i] = dnf
+	}
+
+	var out []Diagnostic
+	// remaining = entradas que ainda nao casaram com nenhuma aresta anterior.
+	remaining := eval.DNF{eval.Term{}}
+
+	for i, edge := range node.Outgoing {
+		ref := &EdgeRef{From: id, To: edge.To}
+
+		if !conds[i].Satisfiable() {
+			out = append(out, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     "unsatisfiable_edge",
+				Node:     id,
+				Edge:     ref,
+				Message:  fmt.Sprintf("edge %s -> %s can never fire: cond %q is unsatisfiable", id, edge.To, edge.Cond),
+			}.at(edge.Pos))
+			continue
+		}
+
+		reach, err := remaining.And(conds[i])
+		if err != nil {
+			return out
+		}
+		if !reach.Satisfiable() {
+			out = append(out, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     "shadowed_edge",
+				Node:     id,
+				Edge:     ref,
+				Message:  fmt.Sprintf("edge %s -> %s can never fire: cond %q is fully covered by earlier edges", id, edge.To, edge.Cond),
+			}.at(edge.Pos))
+		} else if !edge.Default {
+			// default sempre "sobrepõe" tudo por definição, entao nao entra no relatorio de overlap.
+			for j := 0; j < i; j++ {
+				overlap, err := conds[j].And(conds[i])
+				if err != nil {
+					return out
+				}
+				if !overlap.Satisfiable() {
+					continue
+				}
+				prev := node.Outgoing[j]
+				out = append(out, Diagnostic{
+					Severity: SeverityInfo,
+					Code:     "overlapping_edges",
+					Node:     id,
+					Edge:     ref,
+					Message: fmt.Sprintf("edges %s -> %s and %s -> %s overlap (e.g. %s); the first one wins",
+						id, prev.To, id, edge.To, overlap[0]),
+				}.at(edge.Pos))
+			}
+		}
+
+		notCond, err := conds[i].Not()
+		if err != nil {
+			return out
+		}
+		remaining, err = remaining.And(notCond)
+		if err != nil {
+			return out
+		}
+	}
+
+	if remaining.Satisfiable() {
+		out = append(out, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     "input_gap",
+			Node:     id,
+			Message:  fmt.Sprintf("node %s has inputs where no edge matches (e.g. %s)", id, remaining[0]),
+		}.at(node.Pos))
+	}
+
+	return out
+}
@@ -0,0 +1,204 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Constantes da policy, declaradas em atributo de grafo e inlined nas conds no compile:
+//
+//	const_min_score=700
+//	const_segment="'prime'"
+//	list_blocked_states="NY,CA"
+//
+// cond="score > min_score && !(state in blocked_states)"
+//
+// const_ aceita um valor escalar na sintaxe do result (aspas, numero, bool); list_ é uma lista separada por virgula.
+var constNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var reservedConstNames = map[string]struct{}{
+	"true": {}, "false": {}, "nil": {}, "and": {}, "or": {}, "not": {}, "in": {},
+}
+
+// applyConstants lê os atributos const_<name>/list_<name> do grafo pra Policy.Constants.
+// O front-end JSON já preenche direto, por isso aqui só acrescenta.
+func applyConstants(p *Policy, attrs map[string]string, src *sourceIndex, errs *CompileErrors) {
+	keys := make([]string, 0)
+	for k := range attrs {
+		if strings.HasPrefix(k, "const_") || strings.HasPrefix(k, "list_") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		kind, name, _ := strings.Cut(k, "_")
+		if err := validateConstName(name); err != nil {
+			errs.add(src.graphAttr(k), CompileError{Attr: k, Message: fmt.Sprintf("%s attribute %q: %v", kind, k, err)})
+			continue
+		}
+		if _, dup := p.Constants[name]; dup {
+			errs.add(src.graphAttr(k), CompileError{Attr: k, Message: fmt.Sprintf("constant %s declared more than once", name)})
+			continue
+		}
+
+		var (
+			v   any
+			err error
+		)
+		if kind == "list" {
+			v, err = parseListValue(attrs[k])
+		} else {
+			v, err = parseConstValue(attrs[k])
+		}
+		if err != nil {
+			errs.add(src.graphAttr(k), CompileError{Attr: k, Message: fmt.Sprintf("%s %s: %v", kind, name, err)})
+			continue
+		}
+		if p.Constants == nil {
+			p.Constants = map[string]any{}
+		}
+		p.Constants[name] = v
+	}
+}
+
+func validateConstName(name string) error {
+	if !constNameRe.MatchString(name) {
+		return fmt.Errorf("invalid name %q (expected identifier)", name)
+	}
+	if _, ok := reservedConstNames[name]; ok {
+		return fmt.Errorf("name %q is reserved", name)
+	}
+	return nil
+}
+
+// parseConstValue lê o valor de um const_<name>: um escalar só.
+func parseConstValue(raw string) (any, error) {
+	rp := &resultParser{src: raw}
+	rp.skipSpaces()
+	if rp.eof() {
+		return nil, fmt.Errorf("value is required")
+	}
+	v, err := rp.value("")
+	if err != nil {
+		return nil, err
+	}
+	if !rp.eof() {
+		return nil, rp.errorf("unexpected %q after value", rp.src[rp.pos:])
+	}
+	if _, isList := v.([]any); isList {
+		return nil, fmt.Errorf("lists must be declared with list_<name>")
+	}
+	return v, validateConstValue(v)
+}
+
+// parseListValue lê o valor de um list_<name>: itens escalares separados por virgula.
+func parseListValue(raw string) ([]any, error) {
+	rp := &resultParser{src: raw}
+	out := []any{}
+	rp.skipSpaces()
+	for !rp.eof() {
+		v, err := rp.value(",")
+		if err != nil {
+			return nil, err
+		}
+		if _, isList := v.([]any); isList {
+			return nil, fmt.Errorf("list items must be scalar values")
+		}
+		if err := validateConstValue(v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+
+		rp.skipSpaces()
+		if rp.eof() {
+			break
+		}
+		if rp.peek() != ',' {
+			return nil, rp.errorf("expected ',' between list items")
+		}
+		rp.pos++
+		rp.skipSpaces()
+	}
+	return out, nil
+}
+
+// validateConstValue aceita o que vira literal no expr: string, numero, bool ou lista desses.
+func validateConstValue(v any) error {
+	switch val := v.(type) {
+	case string, bool, int, float64:
+		return nil
+	case []any:
+		for _, it := range val {
+			if _, nested := it.([]any); nested {
+				return fmt.Errorf("list items must be scalar values")
+			}
+			if err := validateConstValue(it); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("constant must be a string, number, bool or list of those (got %s)", inputTypeName(v))
+}
+
+// formatConstValue é o inverso do parseConstValue/parseListValue, usado no ToDOT.
+func formatConstValue(v any) string {
+	items, ok := v.([]any)
+	if !ok {
+		return FormatValue(v)
+	}
+	parts := make([]string, 0, len(items))
+	for _, it := range items {
+		parts = append(parts, FormatValue(it))
+	}
+	return strings.Join(parts, ",")
+}
+
+// constantCollisions é a checagem do lint: constante com o mesmo nome de uma variavel de input
+// (declarada no schema ou gravada por result) faria a cond ler a constante sem ninguém perceber.
+func constantCollisions(p *Policy) []Diagnostic {
+	if len(p.Constants) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(p.Constants))
+	for name := range p.Constants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	inputs := map[string]bool{}
+	for _, f := range p.Inputs {
+		root, _, _ := strings.Cut(f.Name, ".")
+		inputs[root] = true
+	}
+
+	var out []Diagnostic
+	for _, name := range names {
+		if inputs[name] {
+			out = append(out, Diagnostic{
+				Severity: SeverityError,
+				Code:     "constant_shadows_input",
+				Message:  fmt.Sprintf("constant %s collides with declared input %s", name, name),
+			})
+		}
+		for _, id := range sortedNodeIDs(p) {
+			node := p.Nodes[id]
+			for _, a := range node.Result {
+				if a.path()[0] != name || a.Op == OpUnset {
+					continue
+				}
+				out = append(out, Diagnostic{
+					Severity: SeverityError,
+					Code:     "constant_shadows_input",
+					Node:     id,
+					Message:  fmt.Sprintf("constant %s collides with variable %s set by node %s", name, a.Key, id),
+				}.at(node.Pos))
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompiler_ConstantsAreInlinedIntoConds(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	const_min_score=700;
+	list_blocked_states="NY, 'CA'";
+	start -> blocked [cond="state in blocked_states"];
+	start -> prime [cond="score > min_score"];
+	start -> standard [default=true];
+	blocked [result="approved=false"];
+	prime [result="approved=true"];
+	standard [result="approved=review"];
+}`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if want := map[string]any{"min_score": 700, "blocked_states": []any{"NY", "CA"}}; !reflect.DeepEqual(p.Constants, want) {
+		t.Fatalf("constants = %#v", p.Constants)
+	}
+	if vars := p.Nodes["start"].Outgoing[1].CompiledCond.Vars(); !reflect.DeepEqual(vars, []string{"score"}) {
+		t.Fatalf("constant leaked into cond vars: %v", vars)
+	}
+
+	eng := NewEngine(ExprEvaluator{})
+	for _, tc := range []struct {
+		input map[string]any
+		want  any
+	}{
+		{map[string]any{"state": "NY", "score": 800.0}, false},
+		{map[string]any{"state": "TX", "score": 800.0}, true},
+		{map[string]any{"state": "TX", "score": 650.0}, "review"},
+	} {
+		if err := eng.Run(p, tc.input); err != nil {
+			t.Fatalf("run %v: %v", tc.input, err)
+		}
+		if tc.input["approved"] != tc.want {
+			t.Fatalf("input %v: approved=%v, want %v", tc.input, tc.input["approved"], tc.want)
+		}
+	}
+}
+
+func TestCompiler_ConstantsFeedStaticAnalysis(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	const_min_score=700;
+	start -> a [cond="score > min_score"];
+	start -> b [cond="score > 800"];
+	a [result="x=1"];
+	b [result="x=2"];
+}`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	for _, d := range p.Diagnostics {
+		if d.Code == "shadowed_edge" && d.Edge != nil && d.Edge.To == "b" {
+			return
+		}
+	}
+	t.Fatalf("expected shadowed_edge for start -> b, got %v", p.Diagnostics)
+}
+
+func TestCompiler_ConstantCollidingWithInputIsLintError(t *testing.T) {
+	_, err := NewCompiler().Compile(`digraph {
+	input_min_score="number";
+	const_min_score=700;
+	const_approved=true;
+	start -> ok [cond="score > min_score"];
+	ok [result="approved=true"];
+}`)
+	var errs CompileErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected lint errors, got %v", err)
+	}
+	var got []string
+	for _, ce := range errs {
+		if strings.HasPrefix(ce.Message, "lint error:") {
+			got = append(got, ce.Message)
+		}
+	}
+	want := []string{
+		"lint error: constant approved collides with variable approved set by node ok",
+		"lint error: constant min_score collides with declared input min_score",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected lint errors: %v", err)
+	}
+}
+
+func TestCompiler_InvalidConstants(t *testing.T) {
+	cases := map[string]string{
+		`const_x="[1, 2]"`: "lists must be declared with list_<name>",
+		`const_x=""`:       "value is required",
+		`const_x="null"`:   "constant must be a string, number, bool or list of those",
+		`list_x="a, [1]"`:  "list items must be scalar values",
+		`"const_in"=1`:     `name "in" is reserved`,
+		`"const_a-b"=1`:    `invalid name "a-b"`,
+		`list_x="'a' 'b'"`: "expected ',' between list items",
+		`const_x="1 2"`:    "",
+	}
+	for attr, want := range cases {
+		_, err := NewCompiler().Compile("digraph {\n" + attr + ";\nstart [result=\"ok=true\"];\n}")
+		if want == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", attr, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected %q, got %v", attr, want, err)
+		}
+	}
+
+	_, err := NewCompiler().Compile(`digraph { const_x=1; list_x="1"; start [result="ok=true"]; }`)
+	if err == nil || !strings.Contains(err.Error(), "constant x declared more than once") {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OutputErrors é a violação do contrato de saida (output_<key>) no fim da execução.
+type OutputErrors []*InputError
+
+func (e OutputErrors) Error() string {
+	parts := make([]string, 0, len(e))
+	for _, fe := range e {
+		parts = append(parts, fe.Field+": "+fe.Message)
+	}
+	return "output contract violated: " + strings.Join(parts, "; ")
+}
+
+// validateOutput confere o output final contra o contrato. Nil se nao tem contrato ou se está ok.
+func (s InputSchema) validateOutput(vars map[string]any) error {
+	if errs := s.fieldErrors(vars, lookupDotted); len(errs) > 0 {
+		return OutputErrors(errs)
+	}
+	return nil
+}
+
+// validateOutputContract checa o contrato no compile:
+//   - valor literal gravado numa chave do contrato precisa bater com tipo/enum/range
+//   - todo caminho de um entry até uma folha precisa gravar as chaves obrigatorias
+//
+// O segundo é um dataflow de "chaves garantidas" (interseção entre os caminhos que chegam no nó; no join
+// de fan-out depende da estratégia, ver joinGuarantees), entao nao explode com o numero de caminhos. Input obrigatorio do schema conta como já garantido.
+// Precisa de DAG, entao roda depois do validateAcyclic.
+func validateOutputContract(p *Policy, errs *CompileErrors) {
+	if len(p.Outputs) == 0 {
+		return
+	}
+
+	fields := make(map[string]InputField, len(p.Outputs))
+	var required []string
+	for _, f := range p.Outputs {
+		fields[f.Name] = f
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+
+	for _, id := range sortedNodeIDs(p) {
+		for _, a := range p.Nodes[id].Result {
+			f, ok := fields[a.Key]
+			if !ok || a.Op != OpSet || a.Expr != nil {
+				continue
+			}
+			if a.Value == nil {
+				if f.Required {
+					errs.add(p.Nodes[id].Pos, CompileError{Node: id, Attr: "result", Message: fmt.Sprintf("node %s sets required output %s to null", id, a.Key)})
+				}
+				continue
+			}
+			if msg := f.check(a.Value); msg != "" {
+				errs.add(p.Nodes[id].Pos, CompileError{Node: id, Attr: "result", Message: fmt.Sprintf("node %s output %s %s", id, a.Key, msg)})
+			}
+		}
+	}
+
+	if len(required) == 0 {
+		return
+	}
+
+	// input é lido pela chave literal; "a.b" do input nao é o caminho a.b do output
+	initial := map[string]bool{}
+	for _, f := range p.Inputs {
+		if f.Required && !strings.Contains(f.Name, ".") {
+			initial[f.Name] = true
+		}
+	}
+
+	reported := map[string]bool{}
+	for _, entry := range entryNodes(p) {
+		for _, miss := range missingOutputsAtLeaves(p, entry, required, initial) {
+			key := miss.leaf + "\x00" + miss.output
+			if reported[key] {
+				continue
+			}
+			reported[key] = true
+			errs.add(p.Nodes[miss.leaf].Pos, CompileError{
+				Node:    miss.leaf,
+				Attr:    "result",
+				Message: fmt.Sprintf("leaf %s can be reached from entry %s without setting required output %s", miss.leaf, entry, miss.output),
+			})
+		}
+	}
+}
+
+type missingOutput struct {
+	leaf   string
+	output string
+}
+
+func missingOutputsAtLeaves(p *Policy, entry string, required []string, initial map[string]bool) []missingOutput {
+	var out []missingOutput
+	guaranteedFlow(p, entry, "", initial, required, func(id string, set map[string]bool) {
+		for _, key := range required {
+			if !set[key] {
+				out = append(out, missingOutput{leaf: id, output: key})
+			}
+		}
+	})
+	return out
+}
+
+// guaranteedFlow propaga as chaves obrigatorias garantidas a partir de from, em ordem topologica
+// (interseção onde caminhos se encontram), e devolve o conjunto que chega em stopAt (nil se nenhum
+// caminho chega). leaf recebe cada folha com o conjunto dela. O join de um fan-out nao recebe a
+// interseção das arestas dos branches, e sim o joinGuarantees do nó de fan-out.
+func guaranteedFlow(p *Policy, from, stopAt string, start map[string]bool, required []string, leaf func(id string, set map[string]bool)) map[string]bool {
+	before := map[string]map[string]bool{from: copySet(start)}
+	merge := func(to string, set map[string]bool) {
+		prev, seen := before[to]
+		if !seen {
+			before[to] = copySet(set)
+			return
+		}
+		for k := range prev {
+			if !set[k] {
+				delete(prev, k)
+			}
+		}
+	}
+	branchOf := map[string]map[string]bool{} // nó de branch -> joins que ele nao alimenta direto
+
+	for _, id := range topoOrderFrom(p, from) {
+		in, reached := before[id]
+		if !reached {
+			continue
+		}
+		if id == stopAt {
+			return in
+		}
+		node := p.Nodes[id]
+		after := copySet(in)
+		if node.Call != nil && node.Call.Policy != nil {
+			// o contrato de saida da sub-policy garante as chaves obrigatorias dela
+			for _, f := range node.Call.Policy.Outputs {
+				if f.Required {
+					after[f.Name] = true
+				}
+			}
+		}
+		for _, a := range node.Result {
+			applyGuaranteed(after, a, required)
+		}
+
+		if len(node.Outgoing) == 0 {
+			if leaf != nil {
+				leaf(id, after)
+			}
+			continue
+		}
+
+		if node.Fanout != "" {
+			merge(node.Fanout, joinGuarantees(p, node, after, required))
+			for n := range fanoutRegion(p, node) {
+				if branchOf[n] == nil {
+					branchOf[n] = map[string]bool{}
+				}
+				branchOf[n][node.Fanout] = true
+			}
+		}
+		for _, edge := range node.Outgoing {
+			if edge.To == node.Fanout || branchOf[id][edge.To] {
+				continue
+			}
+			merge(edge.To, after)
+		}
+	}
+	return nil
+}
+
+// joinGuarantees é o que chega no join do fan-out. Com all/conflict-error o join junta todos os branches
+// que rodaram: aresta sem cond sempre vira branch (a união delas vale sempre) e a interseção de todos cobre
+// qualquer outra combinação. Com any/first pode ter sobrado um branch só, entao é a interseção.
+func joinGuarantees(p *Policy, node *Node, start map[string]bool, required []string) map[string]bool {
+	var common map[string]bool
+	always := map[string]bool{}
+	for _, edge := range node.Outgoing {
+		got := guaranteedFlow(p, edge.To, node.Fanout, start, required, nil)
+		if got == nil {
+			continue // branch que nunca chega no join só falha
+		}
+		if common == nil {
+			common = copySet(got)
+		} else {
+			intersect(common, got)
+		}
+		if edge.Cond == "" && !edge.Default {
+			for k := range got {
+				always[k] = true
+			}
+		}
+	}
+	if common == nil {
+		return copySet(start)
+	}
+	if join := p.Nodes[node.Fanout]; join != nil && (join.Join == MergeAll || join.Join == MergeConflictError) {
+		for k := range always {
+			common[k] = true
+		}
+	}
+	return common
+}
+
+// fanoutRegion sao os nós dos branches: alcançaveis pelas arestas do fan-out sem passar pelo join.
+func fanoutRegion(p *Policy, node *Node) map[string]bool {
+	region := map[string]bool{}
+	var visit func(id string)
+	visit = func(id string) {
+		if id == node.Fanout || region[id] {
+			return
+		}
+		region[id] = true
+		if n := p.Nodes[id]; n != nil {
+			for _, edge := range n.Outgoing {
+				visit(edge.To)
+			}
+		}
+	}
+	for _, edge := range node.Outgoing {
+		visit(edge.To)
+	}
+	return region
+}
+
+// applyGuaranteed atualiza o conjunto de chaves obrigatorias garantidas depois de um assignment.
+func applyGuaranteed(set map[string]bool, a Assignment, required []string) {
+	path := a.path()
+	for _, key := range required {
+		target := strings.Split(key, ".")
+		switch {
+		case a.Op == OpUnset && len(path) <= len(target) && hasPathPrefix(target, path):
+			delete(set, key)
+		case a.Op == OpUnset:
+		case len(path) == len(target) && hasPathPrefix(target, path):
+			if a.Op == OpAdd || a.Expr != nil || a.Value != nil {
+				set[key] = true
+			} else {
+				delete(set, key) // setar null nao conta
+			}
+		case len(path) < len(target) && hasPathPrefix(target, path) && a.Op == OpSet:
+			// objeto inteiro sobrescrito no prefixo: só garante se o literal tiver a chave
+			if v, ok := a.Value.(map[string]any); ok && a.Expr == nil {
+				if inner, found := lookupPath(v, target[len(path):]); found && inner != nil {
+					set[key] = true
+					continue
+				}
+			}
+			delete(set, key)
+		}
+	}
+}
+
+// topoOrderFrom devolve os nós alcançaveis a partir do entry em ordem topologica.
+func topoOrderFrom(p *Policy, entry string) []string {
+	visited := map[string]bool{}
+	var post []string
+	var visit func(id string)
+	visit = func(id string) {
+		if visited[id] {
+			return
+		}
+		visited[id] = true
+		node := p.Nodes[id]
+		if node == nil {
+			return
+		}
+		for _, edge := range node.Outgoing {
+			visit(edge.To)
+		}
+		post = append(post, id)
+	}
+	visit(entry)
+
+	for i, j := 0, len(post)-1; i < j; i, j = i+1, j-1 {
+		post[i], post[j] = post[j], post[i]
+	}
+	return post
+}
+
+// entryNodes devolve os nós de entrada (Start + entries nomeados), sem repetir.
+func entryNodes(p *Policy) []string {
+	seen := map[string]bool{p.Start: true}
+	out := []string{p.Start}
+	names := make([]string, 0, len(p.Entries))
+	for name := range p.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		id := p.Entries[name]
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func copySet(s map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(s))
+	for k, v := range s {
+		if v {
+			out[k] = true
+		}
+	}
+	return out
+}
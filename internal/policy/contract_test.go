@@ -0,0 +1,126 @@
+package policy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompiler_OutputContractChecksEveryLeafPath(t *testing.T) {
+	_, err := NewCompiler().Compile(`digraph {
+	output_approved="bool";
+	output_segment="string, enum=prime|standard";
+	output_note="string, optional";
+	start -> prime [cond="score>700"];
+	start -> review [cond="score>500"];
+	start -> rejected [default=true];
+	prime [result="approved=true,segment=prime"];
+	review -> manual [default=true];
+	review [result="segment=standard"];
+	manual [result="note=check"];
+	rejected [result="approved=false,decision={reason: low}"];
+}`)
+	var errs CompileErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected 2 compile errors, got %v", err)
+	}
+	byNode := map[string]*CompileError{}
+	for _, ce := range errs {
+		byNode[ce.Node] = ce
+	}
+	if ce := byNode["manual"]; ce == nil || ce.Line != 9 ||
+		ce.Message != "leaf manual can be reached from entry start without setting required output approved" {
+		t.Fatalf("unexpected manual error: %v", err)
+	}
+	if ce := byNode["rejected"]; ce == nil ||
+		ce.Message != "leaf rejected can be reached from entry start without setting required output segment" {
+		t.Fatalf("unexpected rejected error: %v", err)
+	}
+}
+
+func TestCompiler_OutputContractAcceptsGuaranteedKeys(t *testing.T) {
+	_, err := NewCompiler().Compile(`digraph {
+	input_segment="string";
+	output_segment="string";
+	"output_decision.approved"="bool";
+	output_reasons="list";
+	start [result="decision={approved: false},reasons+=START"];
+	start -> ok [cond="segment==\"prime\""];
+	start -> no [default=true];
+	ok [result="decision.approved=true"];
+}`)
+	if err != nil {
+		t.Fatalf("expected contract to hold, got %v", err)
+	}
+
+	_, err = NewCompiler().Compile(`digraph {
+	output_approved="bool";
+	start [result="approved=yes"];
+}`)
+	if err == nil || !strings.Contains(err.Error(), "node start output approved expected bool, got string") {
+		t.Fatalf("expected literal type error, got %v", err)
+	}
+}
+
+func TestCompiler_OutputContractJoinsFanoutBranchesByStrategy(t *testing.T) {
+	fanout := func(join, velocityCond string) string {
+		return `digraph {
+	output_device_ok="bool";
+	output_velocity_ok="bool";
+	start [fanout="done"];
+	start -> device;
+	start -> velocity` + velocityCond + `;
+	device [result="device_ok=true"];
+	velocity [result="velocity_ok=true"];
+	device -> done;
+	velocity -> done;
+	done [join="` + join + `"];
+}`
+	}
+
+	// all/conflict-error: o join recebe a união dos branches que sempre rodam
+	for _, join := range []string{"all", "conflict-error"} {
+		if _, err := NewCompiler().Compile(fanout(join, "")); err != nil {
+			t.Fatalf("join=%s: expected union of branches to satisfy the contract, got %v", join, err)
+		}
+	}
+
+	// any/first: pode ter sobrado um branch só
+	for _, join := range []string{"any", "first"} {
+		_, err := NewCompiler().Compile(fanout(join, ""))
+		if err == nil || !strings.Contains(err.Error(), "leaf done can be reached from entry start without setting required output") {
+			t.Fatalf("join=%s: expected intersection to miss outputs, got %v", join, err)
+		}
+	}
+
+	// branch com cond pode nao rodar: o que só ele grava nao é garantido
+	_, err := NewCompiler().Compile(fanout("all", ` [cond="amount > 1000"]`))
+	if err == nil || !strings.Contains(err.Error(), "without setting required output velocity_ok") ||
+		strings.Contains(err.Error(), "required output device_ok") {
+		t.Fatalf("expected only velocity_ok missing, got %v", err)
+	}
+}
+
+func TestEngine_RunEnforcesOutputContract(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	output_limit="number, max=1000";
+	start [result="limit=$(income*3)"];
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]any{"income": 100}
+	if _, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, vars); err != nil {
+		t.Fatalf("expected contract to hold, got %v", err)
+	}
+
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, map[string]any{"income": 500})
+	var outErrs OutputErrors
+	if !errors.As(err, &outErrs) || len(outErrs) != 1 || outErrs[0].Field != "limit" {
+		t.Fatalf("expected output contract error, got %v", err)
+	}
+	if trace.Terminated != "error_output_contract" {
+		t.Fatalf("expected error_output_contract, got %q", trace.Terminated)
+	}
+}
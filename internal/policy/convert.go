@@ -0,0 +1,224 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ToDocument converte uma policy compilada pro formato JSON (Document).
+// Arestas saem na ordem efetiva de avaliação de cada nó.
+func ToDocument(p *Policy) Document {
+	doc := Document{Entries: p.Entries}
+	if p.Start != defaultStart {
+		doc.Entry = p.Start
+	}
+	doc.Inputs = documentFields(p.Inputs)
+	doc.Outputs = documentFields(p.Outputs)
+	doc.Constants = p.Constants
+	if p.Timeout > 0 {
+		doc.Timeout = p.Timeout.String()
+	}
+	if len(p.Derived) > 0 {
+		doc.Derived = make(map[string]string, len(p.Derived))
+		for _, d := range p.Derived {
+			doc.Derived[d.Name] = d.Expr.Source()
+		}
+	}
+
+	ids := sortedNodeIDs(p)
+	for _, id := range ids {
+		node := p.Nodes[id]
+		dn := DocumentNode{ID: id}
+		if node.Call != nil {
+			dn.Call = node.Call.Ref
+		}
+		dn.Fanout = node.Fanout
+		dn.Join = string(node.Join)
+		if len(node.Result) > 0 {
+			dn.Result = make(map[string]any, len(node.Result))
+			for _, a := range node.Result {
+				key := documentResultKeyFor(a)
+				if a.Expr != nil {
+					dn.Result[key] = "$(" + a.Expr.Source() + ")"
+					continue
+				}
+				dn.Result[key] = a.Value
+			}
+		}
+		doc.Nodes = append(doc.Nodes, dn)
+	}
+
+	for _, id := range ids {
+		for _, edge := range p.Nodes[id].Outgoing {
+			doc.Edges = append(doc.Edges, DocumentEdge{
+				From:     id,
+				To:       edge.To,
+				Cond:     edge.Cond,
+				Priority: edge.Priority,
+				Default:  edge.Default,
+			})
+		}
+	}
+
+	return doc
+}
+
+func documentFields(s InputSchema) map[string]DocumentInput {
+	if len(s) == 0 {
+		return nil
+	}
+	out := make(map[string]DocumentInput, len(s))
+	for _, f := range s {
+		out[f.Name] = DocumentInput{Type: f.Type, Optional: !f.Required, Enum: f.Enum, Min: f.Min, Max: f.Max}
+	}
+	return out
+}
+
+// ToDOT converte uma policy compilada pro formato DOT.
+// Recompilar a saida gera a mesma policy (nós, results, arestas, priority/default e entries).
+func ToDOT(p *Policy) string {
+	var b strings.Builder
+	b.WriteString("digraph Policy {\n")
+
+	if p.Start != defaultStart {
+		fmt.Fprintf(&b, "  entry=%s\n", dotQuote(p.Start))
+	}
+	names := make([]string, 0, len(p.Entries))
+	for name := range p.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %s=%s\n", dotID("entry_"+name), dotQuote(p.Entries[name]))
+	}
+	if p.Timeout > 0 {
+		fmt.Fprintf(&b, "  timeout=%s\n", dotQuote(p.Timeout.String()))
+	}
+	for _, f := range p.Inputs {
+		fmt.Fprintf(&b, "  %s=%s\n", dotID("input_"+f.Name), dotQuote(formatInputField(f)))
+	}
+	for _, f := range p.Outputs {
+		fmt.Fprintf(&b, "  %s=%s\n", dotID("output_"+f.Name), dotQuote(formatInputField(f)))
+	}
+	consts := make([]string, 0, len(p.Constants))
+	for name := range p.Constants {
+		consts = append(consts, name)
+	}
+	sort.Strings(consts)
+	for _, name := range consts {
+		prefix := "const_"
+		if _, isList := p.Constants[name].([]any); isList {
+			prefix = "list_"
+		}
+		fmt.Fprintf(&b, "  %s=%s\n", dotID(prefix+name), dotQuote(formatConstValue(p.Constants[name])))
+	}
+	for _, d := range p.Derived {
+		fmt.Fprintf(&b, "  %s=%s\n", dotID("derived_"+d.Name), dotQuote(d.Expr.Source()))
+	}
+
+	ids := sortedNodeIDs(p)
+	writeNamespaces(&b, ids)
+	for _, id := range ids {
+		node := p.Nodes[id]
+		var attrs []string
+		if node.Call != nil {
+			attrs = append(attrs, "call="+dotQuote(node.Call.Ref))
+		}
+		if node.Fanout != "" {
+			attrs = append(attrs, "fanout="+dotQuote(node.Fanout))
+		}
+		if node.Join != "" {
+			attrs = append(attrs, "join="+dotQuote(string(node.Join)))
+		}
+		attrs = append(attrs, "result="+dotQuote(FormatResult(node.Result)))
+		fmt.Fprintf(&b, "  %s [%s]\n", dotID(id), strings.Join(attrs, ", "))
+	}
+
+	for _, id := range ids {
+		for _, edge := range p.Nodes[id].Outgoing {
+			var attrs []string
+			if edge.Cond != "" {
+				attrs = append(attrs, "cond="+dotQuote(edge.Cond))
+			}
+			if edge.Priority != nil {
+				attrs = append(attrs, "priority="+strconv.Itoa(*edge.Priority))
+			}
+			if edge.Default {
+				attrs = append(attrs, "default=true")
+			}
+
+			fmt.Fprintf(&b, "  %s -> %s", dotID(id), dotID(edge.To))
+			if len(attrs) > 0 {
+				fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotID deixa o ID cru quando ele já é um ID valido do DOT, senao coloca aspas.
+// writeNamespaces declara, em subgraphs vazios, os namespaces dos IDs qualificados (kyc.check) pra que
+// o "kyc.check" escrito depois resolva pro mesmo ID no recompile (ver resolveID).
+func writeNamespaces(b *strings.Builder, ids []string) {
+	tree := map[string][]string{} // namespace -> filhos diretos
+	seen := map[string]bool{}
+	for _, id := range ids {
+		parts := strings.Split(id, ".")
+		parent := ""
+		for i := 0; i < len(parts)-1 && constNameRe.MatchString(parts[i]); i++ {
+			ns := strings.Join(parts[:i+1], ".")
+			if !seen[ns] {
+				seen[ns] = true
+				tree[parent] = append(tree[parent], ns)
+			}
+			parent = ns
+		}
+	}
+
+	var write func(parent, indent string)
+	write = func(parent, indent string) {
+		for _, ns := range tree[parent] {
+			fmt.Fprintf(b, "%ssubgraph { namespace=%s", indent, dotQuote(ns[strings.LastIndex(ns, ".")+1:]))
+			if len(tree[ns]) == 0 {
+				b.WriteString(" }\n")
+				continue
+			}
+			b.WriteString("\n")
+			write(ns, indent+"  ")
+			fmt.Fprintf(b, "%s}\n", indent)
+		}
+	}
+	write("", "  ")
+}
+
+func dotID(id string) string {
+	if len(id) >= 2 && id[0] == '"' && id[len(id)-1] == '"' {
+		return id
+	}
+	for i, r := range id {
+		if !(r == '_' || r > 127 || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')) {
+			return dotQuote(id)
+		}
+	}
+	if id == "" || isDOTKeyword(id) {
+		return dotQuote(id)
+	}
+	return id
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func isDOTKeyword(s string) bool {
+	switch strings.ToLower(s) {
+	case "node", "edge", "graph", "digraph", "subgraph", "strict":
+		return true
+	}
+	return false
+}
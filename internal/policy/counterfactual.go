@@ -0,0 +1,507 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+)
+
+const (
+	// maxCounterfactualPaths limita a enumeração de caminhos até o alvo (o numero cresce exponencial com os ifs).
+	maxCounterfactualPaths = 1000
+	// maxCounterfactualOptions é quantas alternativas voltam; só essas sao conferidas rodando a engine.
+	maxCounterfactualOptions = 5
+)
+
+// CounterfactualTarget é onde se quer chegar: um nó visitado ou um output final (todas as chaves batendo).
+//
+//	{"node": "approved"}
+//	{"output": {"approved": true}}
+type CounterfactualTarget struct {
+	Node   string         `json:"node,omitempty"`
+	Output map[string]any `json:"output,omitempty"`
+}
+
+// InputChange é uma variavel de input que precisa mudar: Constraint é o que o caminho exige dela
+// e Suggested o valor aceito mais perto do atual (ausente quando nao tem um valor concreto, ex: != "x").
+type InputChange struct {
+	Var        string `json:"var"`
+	Current    any    `json:"current"`
+	Suggested  any    `json:"suggested,omitempty"`
+	Constraint string `json:"constraint"`
+}
+
+// Counterfactual é uma alternativa: o caminho até o alvo e as mudanças de input que levam por ele.
+// Verified diz que a engine rodou com o input mudado e chegou mesmo no alvo.
+type Counterfactual struct {
+	Path     []string      `json:"path"`
+	Changes  []InputChange `json:"changes"`
+	Verified bool          `json:"verified"`
+}
+
+// CounterfactualResult traz as alternativas em ordem: verificadas primeiro, depois menos variaveis mudadas
+// e menor distancia. UnanalyzablePaths conta caminhos com cond/valor fora do que a analise estatica entende.
+type CounterfactualResult struct {
+	Target            CounterfactualTarget `json:"target"`
+	AlreadyReached    bool                 `json:"already_reached"`
+	Options           []Counterfactual     `json:"options"`
+	UnanalyzablePaths int                  `json:"unanalyzable_paths,omitempty"`
+	Truncated         bool                 `json:"truncated,omitempty"`
+}
+
+// Counterfactual procura as menores mudanças no input que fazem a execução chegar no alvo.
+// Enumera os caminhos do start até o alvo (ou até folhas que terminam com o output pedido), junta as conds
+// de cada passo em DNF (aresta escolhida e nenhuma anterior, igual à engine) e, pra cada termo, compara
+// com o input atual: variavel fora do dominio vira InputChange com o valor mais perto. Variavel gravada
+// por um nó antes do passo entra com o valor gravado; derivada, $(...) e saida de sub-policy nao dá pra
+// prever, entao o caminho conta como nao analisavel. As melhores alternativas sao conferidas rodando a engine.
+func (e *Engine) Counterfactual(ctx context.Context, p *Policy, input map[string]any, target CounterfactualTarget) (*CounterfactualResult, error) {
+	if p == nil || p.Nodes == nil {
+		return nil, fmt.Errorf("policy is nil")
+	}
+	switch {
+	case target.Node == "" && len(target.Output) == 0:
+		return nil, fmt.Errorf("counterfactual target requires node or output")
+	case target.Node != "" && len(target.Output) > 0:
+		return nil, fmt.Errorf("counterfactual target accepts node or output, not both")
+	case target.Node != "" && p.Nodes[target.Node] == nil:
+		return nil, fmt.Errorf("unknown target node %q", target.Node)
+	}
+	if input == nil {
+		input = map[string]any{}
+	}
+
+	res := &CounterfactualResult{Target: target, Options: []Counterfactual{}}
+	reached, err := e.reachesTarget(ctx, p, input, target)
+	if isContextErr(err) {
+		return nil, err
+	}
+	res.AlreadyReached = reached
+
+	paths, truncated := targetPaths(p, target)
+	res.Truncated = truncated
+
+	var candidates []counterfactualCandidate
+	seen := map[string]bool{}
+	for _, path := range paths {
+		dnf, err := pathConstraints(p, path, target)
+		if errors.Is(err, eval.ErrNotAnalyzable) {
+			res.UnanalyzablePaths++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, term := range dnf {
+			c := changesFor(path, term, input)
+			if key := c.signature(); !seen[key] {
+				seen[key] = true
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if len(a.opt.Changes) != len(b.opt.Changes) {
+			return len(a.opt.Changes) < len(b.opt.Changes)
+		}
+		return a.distance < b.distance
+	})
+
+	// confere na engine até achar maxCounterfactualOptions verificadas (ou acabar a lista)
+	var verified, unverified []Counterfactual
+	for _, c := range candidates {
+		if len(verified) >= maxCounterfactualOptions {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c.opt.Verified = e.verifyCounterfactual(ctx, p, input, c.opt, target)
+		if c.opt.Verified {
+			verified = append(verified, c.opt)
+		} else {
+			unverified = append(unverified, c.opt)
+		}
+	}
+	res.Options = append(res.Options, verified...)
+	for _, opt := range unverified {
+		if len(res.Options) >= maxCounterfactualOptions {
+			break
+		}
+		res.Options = append(res.Options, opt)
+	}
+	return res, nil
+}
+
+// hop é um passo do caminho: sai de From pela aresta Outgoing[Edge].
+type hop struct {
+	From string
+	Edge int
+}
+
+type counterfactualPath struct {
+	nodes []string
+	hops  []hop
+}
+
+// targetPaths enumera os caminhos do start: até o nó alvo, ou até as folhas quando o alvo é output.
+// A policy compilada é DAG, entao o DFS termina; o limite segura policy com muitos caminhos.
+func targetPaths(p *Policy, target CounterfactualTarget) ([]counterfactualPath, bool) {
+	start := p.Start
+	if start == "" {
+		start = defaultStart
+	}
+
+	var (
+		out       []counterfactualPath
+		truncated bool
+		nodes     []string
+		hops      []hop
+	)
+	var visit func(id string)
+	visit = func(id string) {
+		if truncated {
+			return
+		}
+		node := p.Nodes[id]
+		if node == nil {
+			return
+		}
+		nodes = append(nodes, id)
+		defer func() { nodes = nodes[:len(nodes)-1] }()
+
+		if id == target.Node || (target.Node == "" && len(node.Outgoing) == 0) {
+			if len(out) >= maxCounterfactualPaths {
+				truncated = true
+				return
+			}
+			out = append(out, counterfactualPath{
+				nodes: append([]string(nil), nodes...),
+				hops:  append([]hop(nil), hops...),
+			})
+			return
+		}
+		for i, edge := range node.Outgoing {
+			hops = append(hops, hop{From: id, Edge: i})
+			visit(edge.To)
+			hops = hops[:len(hops)-1]
+		}
+	}
+	visit(start)
+	return out, truncated
+}
+
+// pathConstraints monta a DNF (só com variaveis de input) que faz a engine seguir o caminho.
+// Devolve DNF vazia quando o caminho é impossivel (ou nao termina com o output pedido).
+func pathConstraints(p *Policy, path counterfactualPath, target CounterfactualTarget) (eval.DNF, error) {
+	fixed := map[string]any{}
+	opaque := map[string]bool{}
+	for _, d := range p.Derived {
+		opaque[d.Name] = true
+	}
+	acc := eval.DNF{eval.Term{}}
+
+	for i, id := range path.nodes {
+		node := p.Nodes[id]
+		if node.Call != nil && node.Call.Policy != nil {
+			for key := range writtenKeys(node.Call.Policy) {
+				opaque[key] = true
+				delete(fixed, key)
+			}
+		}
+		for _, a := range node.Result {
+			key := a.path()[0]
+			if a.Op == OpSet && a.Expr == nil && len(a.path()) == 1 {
+				fixed[key] = a.Value
+				delete(opaque, key)
+				continue
+			}
+			if a.Op == OpUnset && len(a.path()) == 1 {
+				delete(fixed, key) // removida: cond que ler dá missing, entao fica como input
+				opaque[key] = true
+				continue
+			}
+			opaque[key] = true
+			delete(fixed, key)
+		}
+		if i == len(path.hops) {
+			break
+		}
+
+		step, err := hopConstraints(p, path.hops[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range dnfVars(step) {
+			if opaque[name] {
+				return nil, eval.ErrNotAnalyzable
+			}
+			if value, ok := fixed[name]; ok {
+				step = step.Fix(name, value)
+			}
+		}
+		if acc, err = acc.And(step); err != nil {
+			return nil, err
+		}
+		if !acc.Satisfiable() {
+			return acc, nil
+		}
+	}
+
+	if len(target.Output) > 0 {
+		ok, err := outputMatches(p, path.nodes, target.Output)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return eval.DNF{}, nil
+		}
+	}
+	return acc, nil
+}
+
+// hopConstraints é a cond de seguir uma aresta: ela casa e nenhuma anterior casou (a engine pega a primeira).
+// No fan-out toda aresta que casa vira branch, entao basta ela casar (a default, quando nenhuma outra casa).
+func hopConstraints(p *Policy, h hop) (eval.DNF, error) {
+	node := p.Nodes[h.From]
+	edge := node.Outgoing[h.Edge]
+	opts := eval.WithConstants(p.Constants)
+
+	out, err := eval.Constraints(edge.Cond, opts)
+	if err != nil {
+		return nil, err
+	}
+	for j, prev := range node.Outgoing {
+		switch {
+		case j == h.Edge || prev.Default:
+			continue
+		case node.Fanout == "" && j > h.Edge:
+			continue // só as anteriores competem
+		case node.Fanout != "" && !edge.Default:
+			continue // branch de fan-out: basta ela casar
+		}
+		prevDNF, err := eval.Constraints(prev.Cond, opts)
+		if err != nil {
+			return nil, err
+		}
+		notPrev, err := prevDNF.Not()
+		if err != nil {
+			return nil, err
+		}
+		if out, err = out.And(notPrev); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// outputMatches confere que, no caminho, a ultima gravação de cada chave do alvo é o literal pedido.
+// Gravação calculada ($(...), +=) ou vinda de sub-policy nao dá pra prever.
+func outputMatches(p *Policy, nodes []string, want map[string]any) (bool, error) {
+	for key, value := range want {
+		target := strings.Split(key, ".")
+		var (
+			last    any
+			written bool
+		)
+		for _, id := range nodes {
+			node := p.Nodes[id]
+			if node.Call != nil && node.Call.Policy != nil && writtenKeys(node.Call.Policy)[target[0]] {
+				return false, eval.ErrNotAnalyzable
+			}
+			for _, a := range node.Result {
+				path := a.path()
+				if !pathsOverlap(path, target) {
+					continue
+				}
+				switch {
+				case a.Op == OpUnset:
+					written, last = false, nil
+				case a.Op != OpSet || a.Expr != nil:
+					return false, eval.ErrNotAnalyzable
+				case len(path) == len(target):
+					written, last = true, a.Value
+				case len(path) < len(target):
+					// objeto inteiro gravado no prefixo: vale o que tiver dentro dele
+					m, ok := a.Value.(map[string]any)
+					if !ok {
+						written, last = false, nil
+						continue
+					}
+					last, written = lookupPath(m, target[len(path):])
+				default:
+					return false, eval.ErrNotAnalyzable // gravou dentro da chave: o valor final é um objeto montado
+				}
+			}
+		}
+		if !written || !sameValue(last, value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// writtenKeys sao as chaves de topo que um call pra policy pode devolver pro chamador (ver mergeCallOutput):
+// as do output_ declarado ou, sem contrato, as que os results (e os calls aninhados) gravam ou removem.
+// Derivada nao entra: ela é calculada e fica dentro da sub-policy.
+func writtenKeys(p *Policy) map[string]bool {
+	out := map[string]bool{}
+	if len(p.Outputs) > 0 {
+		for _, f := range p.Outputs {
+			out[strings.Split(f.Name, ".")[0]] = true
+		}
+		return out
+	}
+	for _, node := range p.Nodes {
+		for _, a := range node.Result {
+			out[a.path()[0]] = true
+		}
+		if node.Call != nil && node.Call.Policy != nil {
+			for k := range writtenKeys(node.Call.Policy) {
+				out[k] = true
+			}
+		}
+	}
+	return out
+}
+
+func dnfVars(d eval.DNF) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, t := range d {
+		for name := range t {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+type counterfactualCandidate struct {
+	opt      Counterfactual
+	distance float64
+}
+
+// signature identifica a alternativa pelas mudanças em si: termos diferentes da DNF (ou caminhos diferentes)
+// que pedem a mesma mudança no input viram uma só.
+func (c counterfactualCandidate) signature() string {
+	parts := make([]string, 0, len(c.opt.Changes))
+	for _, ch := range c.opt.Changes {
+		if ch.Suggested == nil {
+			parts = append(parts, ch.Constraint)
+			continue
+		}
+		parts = append(parts, ch.Var+"="+FormatValue(ch.Suggested))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// changesFor compara o termo com o input: cada variavel fora do dominio vira um InputChange.
+// distance é a soma das mudanças numericas relativas ao valor atual (desempate entre alternativas).
+func changesFor(path counterfactualPath, term eval.Term, input map[string]any) counterfactualCandidate {
+	names := make([]string, 0, len(term))
+	for name := range term {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c := counterfactualCandidate{opt: Counterfactual{Path: path.nodes, Changes: []InputChange{}}}
+	for _, name := range names {
+		dom := term[name]
+		current, has := input[name]
+		if has && dom.Contains(current) {
+			continue
+		}
+		change := InputChange{Var: name, Current: current, Constraint: eval.Term{name: dom}.String()}
+		if suggested, ok := dom.Closest(current); ok {
+			change.Suggested = suggested
+			if from, isNum := eval.Number(current); isNum {
+				to, _ := eval.Number(suggested)
+				c.distance += math.Abs(to-from) / math.Max(1, math.Abs(from))
+			} else {
+				c.distance++
+			}
+		} else {
+			c.distance++
+		}
+		c.opt.Changes = append(c.opt.Changes, change)
+	}
+	return c
+}
+
+// verifyCounterfactual roda a engine com o input mudado (e o schema de input da policy) e confere o alvo.
+func (e *Engine) verifyCounterfactual(ctx context.Context, p *Policy, input map[string]any, opt Counterfactual, target CounterfactualTarget) bool {
+	vars := copyMap(input)
+	for _, ch := range opt.Changes {
+		if ch.Suggested == nil {
+			return false
+		}
+		vars[ch.Var] = ch.Suggested
+	}
+	if err := p.Inputs.Validate(vars); err != nil {
+		return false
+	}
+	ok, _ := e.reachesTarget(ctx, p, vars, target)
+	return ok
+}
+
+// reachesTarget roda a policy numa cópia do input: nó alvo visitado (inclusive dentro de branch de fan-out)
+// ou execução sem erro terminando com o output pedido.
+func (e *Engine) reachesTarget(ctx context.Context, p *Policy, input map[string]any, target CounterfactualTarget) (bool, error) {
+	vars := copyMap(input)
+	trace, err := e.RunWithTraceContext(ctx, p, vars)
+	if target.Node != "" {
+		return traceVisits(trace, target.Node), err
+	}
+	if err != nil {
+		return false, err
+	}
+	for key, want := range target.Output {
+		got, ok := lookupPath(vars, strings.Split(key, "."))
+		if !ok || !sameValue(got, want) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func traceVisits(trace *ExecutionTrace, id string) bool {
+	if trace == nil {
+		return false
+	}
+	for _, v := range trace.VisitedPath {
+		if v == id {
+			return true
+		}
+	}
+	for _, step := range trace.Steps {
+		if step.Fanout == nil {
+			continue
+		}
+		for _, b := range step.Fanout.Branches {
+			if traceVisits(b.Trace, id) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameValue compara valores de output; numero compara pelo valor (1 == 1.0, input JSON vem float64).
+func sameValue(a, b any) bool {
+	if af, ok := eval.Number(a); ok {
+		bf, ok := eval.Number(b)
+		return ok && af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
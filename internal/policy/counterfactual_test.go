@@ -0,0 +1,153 @@
+package policy
+
+import (
+	"context"
+	"testing"
+)
+
+const creditPolicy = `digraph {
+	start -> approved [cond="age >= 18 && score > 700"];
+	start -> review [cond="age >= 18 && score > 600 && segment == \"prime\""];
+	start -> rejected [default=true];
+	approved [result="approved=true,tier='gold'"];
+	review [result="stage='review'"];
+	review -> approved_review [cond="income >= 5000"];
+	review -> rejected [default=true];
+	approved_review [result="approved=true,tier='silver'"];
+	rejected [result="approved=false"];
+}`
+
+func TestCounterfactual_NodeTargetReturnsSmallestChange(t *testing.T) {
+	p, err := NewCompiler().Compile(creditPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := map[string]any{"age": 30.0, "score": 650.0, "segment": "retail", "income": 3000.0}
+	res, err := NewEngine(ExprEvaluator{}).Counterfactual(context.Background(), p, input, CounterfactualTarget{Node: "approved"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.AlreadyReached || len(res.Options) == 0 {
+		t.Fatalf("expected options to reach approved, got %+v", res)
+	}
+	best := res.Options[0]
+	if !best.Verified || len(best.Changes) != 1 {
+		t.Fatalf("expected single verified change, got %+v", best)
+	}
+	ch := best.Changes[0]
+	if ch.Var != "score" || ch.Current != 650.0 || ch.Suggested != 701.0 || ch.Constraint != "score > 700" {
+		t.Fatalf("unexpected change: %+v", ch)
+	}
+	if input["score"] != 650.0 {
+		t.Fatalf("input must not be mutated")
+	}
+}
+
+func TestCounterfactual_OutputTargetConsidersEveryPathSettingIt(t *testing.T) {
+	p, err := NewCompiler().Compile(creditPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// score 650 já passa do review; prime + income viram 2 mudanças, contra 1 (score) no caminho direto
+	input := map[string]any{"age": 30.0, "score": 650.0, "segment": "retail", "income": 3000.0}
+	res, err := NewEngine(ExprEvaluator{}).Counterfactual(context.Background(), p, input, CounterfactualTarget{Output: map[string]any{"approved": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Options) < 2 {
+		t.Fatalf("expected alternatives via approved and approved_review, got %+v", res.Options)
+	}
+	if got := res.Options[0].Path; len(got) != 2 || got[1] != "approved" {
+		t.Fatalf("expected direct path first, got %v", got)
+	}
+	second := res.Options[1]
+	if !second.Verified || len(second.Changes) != 2 || second.Path[len(second.Path)-1] != "approved_review" {
+		t.Fatalf("expected review path with two changes, got %+v", second)
+	}
+	if second.Changes[0].Var != "income" || second.Changes[0].Suggested != 5000.0 || second.Changes[1].Suggested != "prime" {
+		t.Fatalf("unexpected review changes: %+v", second.Changes)
+	}
+
+	// sem income no input: a variavel aparece com current null
+	delete(input, "income")
+	input["segment"] = "prime"
+	res, err = NewEngine(ExprEvaluator{}).Counterfactual(context.Background(), p, input, CounterfactualTarget{Output: map[string]any{"tier": "silver"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Options) != 1 || res.Options[0].Changes[0].Var != "income" || res.Options[0].Changes[0].Current != nil {
+		t.Fatalf("expected missing income reported, got %+v", res.Options)
+	}
+}
+
+func TestCounterfactual_AlreadyReachedAndUnanalyzable(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	derived_ratio="debt / income";
+	start -> approved [cond="ratio < 1"];
+	start -> rejected [default=true];
+	approved [result="approved=true"];
+	rejected [result="approved=false"];
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eng := NewEngine(ExprEvaluator{})
+	res, err := eng.Counterfactual(context.Background(), p, map[string]any{"debt": 100.0, "income": 1000.0}, CounterfactualTarget{Node: "approved"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.AlreadyReached {
+		t.Fatalf("expected already reached, got %+v", res)
+	}
+	if res.UnanalyzablePaths != 1 || len(res.Options) != 0 {
+		t.Fatalf("cond over derived var must be reported as unanalyzable, got %+v", res)
+	}
+}
+
+func TestCounterfactual_ValuesWrittenOnPathAreFixed(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	start [result="risk='high'"];
+	start -> approved [cond="risk == \"low\" && score > 700"];
+	start -> manual [cond="risk == \"high\" && score > 500"];
+	start -> rejected [default=true];
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := NewEngine(ExprEvaluator{}).Counterfactual(context.Background(), p, map[string]any{"score": 400.0}, CounterfactualTarget{Node: "approved"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Options) != 0 {
+		t.Fatalf("approved is unreachable once start sets risk=high, got %+v", res.Options)
+	}
+
+	res, err = NewEngine(ExprEvaluator{}).Counterfactual(context.Background(), p, map[string]any{"score": 400.0}, CounterfactualTarget{Node: "manual"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Options) != 1 || len(res.Options[0].Changes) != 1 || res.Options[0].Changes[0].Var != "score" {
+		t.Fatalf("expected only score to change (risk comes from the policy), got %+v", res.Options)
+	}
+}
+
+func TestCounterfactual_InvalidTarget(t *testing.T) {
+	p, err := NewCompiler().Compile(creditPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng := NewEngine(ExprEvaluator{})
+	for _, target := range []CounterfactualTarget{
+		{},
+		{Node: "nope"},
+		{Node: "approved", Output: map[string]any{"approved": true}},
+	} {
+		if _, err := eng.Counterfactual(context.Background(), p, nil, target); err == nil {
+			t.Fatalf("expected error for target %+v", target)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// applyTimeout lê o atributo timeout do grafo (timeout="50ms"): orçamento de tempo de cada execução
+// da policy. A engine para entre nós/arestas quando ele estoura, igual a um ctx com deadline.
+func applyTimeout(p *Policy, attrs map[string]string, src *sourceIndex, errs *CompileErrors) {
+	raw, ok := attrs["timeout"]
+	if !ok {
+		return
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(raw))
+	if err != nil || d <= 0 {
+		errs.add(src.graphAttr("timeout"), CompileError{Attr: "timeout", Message: fmt.Sprintf("invalid timeout %q (expected positive duration like 50ms)", raw)})
+		return
+	}
+	p.Timeout = d
+}
@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngine_RunContext_StopsWhenCancelled(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	start -> ok [cond="age >= 18"];
+	ok [result="approved=true"];
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	vars := map[string]any{"age": 20}
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTraceContext(ctx, p, vars)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if trace.Terminated != "error_canceled" || len(trace.VisitedPath) != 0 {
+		t.Fatalf("unexpected trace: %+v", trace)
+	}
+	if _, ok := vars["approved"]; ok {
+		t.Fatalf("no result should be applied after cancellation")
+	}
+}
+
+func TestEngine_RunContext_StopsBetweenEdges(t *testing.T) {
+	p := &Policy{
+		Start: "start",
+		Nodes: map[string]*Node{
+			"start": {ID: "start", Outgoing: []Edge{{To: "a", Cond: "slow"}, {To: "b", Cond: "fast"}}},
+			"a":     {ID: "a"},
+			"b":     {ID: "b"},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ev := fakeEval{fn: func(cond string, vars map[string]any) (bool, error) {
+		cancel() // a primeira cond "demora" e o request vai embora
+		return false, nil
+	}}
+
+	trace, err := NewEngine(ev).RunWithTraceContext(ctx, p, map[string]any{})
+	if err == nil || !strings.Contains(err.Error(), `before edge start -> b`) {
+		t.Fatalf("expected stop before second edge, got %v", err)
+	}
+	if trace.Terminated != "error_canceled" {
+		t.Fatalf("expected error_canceled, got %q", trace.Terminated)
+	}
+	if len(trace.Steps) != 1 || len(trace.Steps[0].Edges) != 1 {
+		t.Fatalf("expected only the first edge in the trace, got %+v", trace.Steps)
+	}
+}
+
+func TestEngine_PolicyTimeoutAppliesToSubPolicy(t *testing.T) {
+	sub := &Policy{
+		Start: "start",
+		Nodes: map[string]*Node{
+			"start": {ID: "start", Outgoing: []Edge{{To: "done", Cond: "slow"}, {To: "done", Cond: "other"}}},
+			"done":  {ID: "done"},
+		},
+		Timeout: time.Millisecond,
+	}
+	p := &Policy{
+		Start: "start",
+		Nodes: map[string]*Node{
+			"start": {ID: "start", Call: &PolicyCall{Ref: "slow@v1", Policy: sub}, Outgoing: []Edge{{To: "done"}}},
+			"done":  {ID: "done"},
+		},
+	}
+	ev := fakeEval{fn: func(cond string, vars map[string]any) (bool, error) {
+		time.Sleep(20 * time.Millisecond)
+		return false, nil
+	}}
+	trace, err := NewEngine(ev).RunWithTraceContext(context.Background(), p, map[string]any{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if trace.Terminated != "error_deadline_exceeded" {
+		t.Fatalf("expected error_deadline_exceeded, got %q", trace.Terminated)
+	}
+	if call := trace.Steps[0].Call; call == nil || call.Trace.Terminated != "error_deadline_exceeded" {
+		t.Fatalf("expected sub-policy trace with deadline termination, got %+v", call)
+	}
+}
+
+func TestCompiler_Timeout(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph { timeout="250ms"; start [result="ok=true"]; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Timeout != 250*time.Millisecond {
+		t.Fatalf("expected 250ms, got %v", p.Timeout)
+	}
+	again, err := NewCompiler().Compile(ToDOT(p))
+	if err != nil || again.Timeout != p.Timeout {
+		t.Fatalf("timeout lost in round trip: %v %v", again, err)
+	}
+
+	_, err = NewCompiler().Compile(`digraph { timeout="soon"; start [result="ok=true"]; }`)
+	if err == nil || !strings.Contains(err.Error(), `invalid timeout "soon"`) {
+		t.Fatalf("expected invalid timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+)
+
+// DerivedVar é uma variavel calculada a partir do input antes de sair do nó inicial:
+//
+//	derived_dti="debt / income"
+//	derived_is_adult="age >= 18"
+//
+// A expressão segue as regras do $(...) do result e pode usar outras derivadas e as constantes da policy.
+type DerivedVar struct {
+	Name string
+	Expr *eval.CompiledExpr
+}
+
+// DerivedTrace é o valor calculado de uma derivada; Missing lista o input que faltou (e a derivada ficou de fora).
+type DerivedTrace struct {
+	Name    string   `json:"name"`
+	Expr    string   `json:"expr"`
+	Value   any      `json:"value,omitempty"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// applyDerived lê os atributos derived_<name>, compila com os tipos do schema e as constantes
+// e guarda em Policy.Derived na ordem de dependencia. Ciclo entre derivadas e nome que sombreia
+// input declarado ou constante sao erro de compile.
+func applyDerived(p *Policy, attrs map[string]string, src *sourceIndex, errs *CompileErrors) {
+	keys := make([]string, 0)
+	for k := range attrs {
+		if strings.HasPrefix(k, "derived_") {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+
+	inputs := map[string]bool{}
+	for _, f := range p.Inputs {
+		root, _, _ := strings.Cut(f.Name, ".")
+		inputs[root] = true
+	}
+	opts := []eval.CompileOption{eval.WithConstants(p.Constants)}
+	if len(p.Inputs) > 0 {
+		opts = append(opts, eval.WithVarTypes(p.Inputs.varTypes()))
+	}
+
+	byName := map[string]DerivedVar{}
+	for _, k := range keys {
+		name := strings.TrimPrefix(k, "derived_")
+		fail := func(format string, args ...any) {
+			errs.add(src.graphAttr(k), CompileError{Attr: k, Message: fmt.Sprintf(format, args...)})
+		}
+		if err := validateConstName(name); err != nil {
+			fail("derived attribute %q: %v", k, err)
+			continue
+		}
+		if inputs[name] {
+			fail("derived %s shadows declared input %s", name, name)
+			continue
+		}
+		if _, ok := p.Constants[name]; ok {
+			fail("derived %s collides with constant %s", name, name)
+			continue
+		}
+		compiled, err := eval.CompileExpr(attrs[k], opts...)
+		if err != nil {
+			fail("derived %s invalid expression: %v", name, err)
+			continue
+		}
+		byName[name] = DerivedVar{Name: name, Expr: compiled}
+	}
+
+	order, cycle := derivedOrder(byName)
+	if len(cycle) > 0 {
+		errs.add(src.graphAttr("derived_"+cycle[0]), CompileError{
+			Attr:    "derived_" + cycle[0],
+			Message: fmt.Sprintf("derived variables form a cycle: %s", strings.Join(cycle, " -> ")),
+		})
+		return
+	}
+	p.Derived = order
+}
+
+// derivedOrder ordena as derivadas por dependencia (desempate por nome). Com ciclo devolve o caminho dele.
+func derivedOrder(byName map[string]DerivedVar) ([]DerivedVar, []string) {
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var (
+		order []DerivedVar
+		stack []string
+		cycle []string
+	)
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		switch state[name] {
+		case done:
+			return true
+		case visiting:
+			for i, s := range stack {
+				if s == name {
+					cycle = append(append([]string{}, stack[i:]...), name)
+				}
+			}
+			return false
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range byName[name].Expr.Vars() {
+			if _, ok := byName[dep]; ok && !visit(dep) {
+				return false
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+		order = append(order, byName[name])
+		return true
+	}
+	for _, name := range names {
+		if !visit(name) {
+			return nil, cycle
+		}
+	}
+	return order, nil
+}
+
+// evalDerived calcula as derivadas em ordem e grava em vars antes da travessia.
+// Input faltando deixa a derivada de fora (a cond que usar ela cai no missing vars de sempre);
+// qualquer outro erro encerra a execução. Input trazendo chave com nome de derivada também é erro, com ou
+// sem schema: a derivada nao sobrescreve o valor do cliente nem deixa ele se passar pela derivada.
+func evalDerived(p *Policy, vars map[string]any, trace *ExecutionTrace) error {
+	for _, d := range p.Derived {
+		if _, ok := vars[d.Name]; ok {
+			return fmt.Errorf("derived %s: input already has key %s", d.Name, d.Name)
+		}
+	}
+	for _, d := range p.Derived {
+		value, err := d.Expr.Run(vars)
+		var mvErr *eval.MissingVariablesError
+		if errors.As(err, &mvErr) {
+			if trace != nil {
+				trace.Derived = append(trace.Derived, DerivedTrace{Name: d.Name, Expr: d.Expr.Source(), Missing: mvErr.Vars})
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("derived %s: %w", d.Name, err)
+		}
+		vars[d.Name] = value
+		if trace != nil {
+			trace.Derived = append(trace.Derived, DerivedTrace{Name: d.Name, Expr: d.Expr.Source(), Value: value})
+		}
+	}
+	return nil
+}
+
+// derivedInputs devolve, pra cada derivada, as variaveis de input que ela lê (direto ou via outra derivada).
+func derivedInputs(p *Policy) map[string][]string {
+	if len(p.Derived) == 0 {
+		return nil
+	}
+	out := make(map[string][]string, len(p.Derived))
+	for _, d := range p.Derived { // ordem de dependencia: as que ela usa já estão no mapa
+		set := map[string]bool{}
+		for _, v := range d.Expr.Vars() {
+			if deps, ok := out[v]; ok {
+				for _, dep := range deps {
+					set[dep] = true
+				}
+				continue
+			}
+			set[v] = true
+		}
+		out[d.Name] = sortedSet(set)
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEngine_DerivedVarsComputedBeforeTraversal(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	const_max_dti=0.4;
+	derived_risky="dti > max_dti";
+	derived_dti="debt / income";
+	derived_is_adult="age >= 18";
+	start -> rejected [cond="!is_adult || risky"];
+	start -> approved [cond="is_adult && !risky"];
+	rejected [result="approved=false"];
+	approved [result="approved=true"];
+}`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	var names []string
+	for _, d := range p.Derived {
+		names = append(names, d.Name)
+	}
+	if want := []string{"dti", "is_adult", "risky"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("derived order = %v, want %v", names, want)
+	}
+
+	vars := map[string]any{"age": 30.0, "debt": 100.0, "income": 1000.0}
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, vars)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if vars["approved"] != true || vars["dti"] != 0.1 || vars["risky"] != false {
+		t.Fatalf("unexpected vars: %v", vars)
+	}
+	if len(trace.Derived) != 3 || trace.Derived[0].Name != "dti" || trace.Derived[0].Value != 0.1 || trace.Derived[0].Expr != "debt / income" {
+		t.Fatalf("unexpected derived trace: %+v", trace.Derived)
+	}
+
+	// input faltando deixa a derivada de fora; as que dependem dela também
+	vars = map[string]any{"age": 30.0}
+	trace, err = NewEngine(ExprEvaluator{}).RunWithTrace(p, vars)
+	if err == nil || trace.Terminated != "error_no_edge_matched_missing_vars" {
+		t.Fatalf("expected missing vars termination, got %v (%s)", err, trace.Terminated)
+	}
+	if _, ok := vars["dti"]; ok {
+		t.Fatalf("dti should not be set without input")
+	}
+	if got := trace.Derived[2].Missing; !reflect.DeepEqual(got, []string{"dti"}) {
+		t.Fatalf("risky missing = %v", got)
+	}
+
+	vars = map[string]any{"age": 30.0, "debt": 1.0, "income": 0.0}
+	trace, err = NewEngine(ExprEvaluator{}).RunWithTrace(p, vars)
+	if err == nil || trace.Terminated != "error_derived" || !strings.Contains(err.Error(), "derived dti") {
+		t.Fatalf("expected error_derived, got %v (%s)", err, trace.Terminated)
+	}
+
+	// input nao pode trazer chave com nome de derivada, mesmo sem input_ declarado
+	vars = map[string]any{"age": 30.0, "debt": 100.0, "income": 1000.0, "risky": false}
+	trace, err = NewEngine(ExprEvaluator{}).RunWithTrace(p, vars)
+	if err == nil || trace.Terminated != "error_derived" || err.Error() != "derived risky: input already has key risky" {
+		t.Fatalf("expected collision error, got %v (%s)", err, trace.Terminated)
+	}
+	if _, ok := vars["dti"]; ok {
+		t.Fatalf("no derived var should be written when the input collides")
+	}
+}
+
+func TestCompiler_DerivedVarsRejectCyclesAndShadowing(t *testing.T) {
+	cases := map[string]string{
+		`derived_a="b + 1"; derived_b="c * 2"; derived_c="a";`: "derived variables form a cycle: a -> b -> c -> a",
+		`derived_a="a + 1";`:                            "derived variables form a cycle: a -> a",
+		`input_age="int"; derived_age="years * 1";`:     "derived age shadows declared input age",
+		`const_limit=5; derived_limit="x * 2";`:         "derived limit collides with constant limit",
+		`input_age="int"; derived_label="age + \"y\"";`: "derived label invalid expression",
+		`derived_x="len(name)";`:                        "function calls are not allowed",
+	}
+	for attrs, want := range cases {
+		_, err := NewCompiler().Compile("digraph {\n" + attrs + "\nstart [result=\"ok=true\"];\n}")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected %q, got %v", attrs, want, err)
+		}
+	}
+}
+
+func TestPolicy_RequiredInputsExpandsDerivedVars(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	derived_dti="debt / income";
+	start -> high [cond="dti > 1"];
+	start -> low [default=true];
+	high [result="risk=high"];
+	low [result="risk=low"];
+}`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if got := p.RequiredInputs().Always; !reflect.DeepEqual(got, []string{"debt", "income"}) {
+		t.Fatalf("always = %v", got)
+	}
+}
@@ -0,0 +1,390 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+)
+
+// Document é o formato JSON da policy, alternativo ao DOT. Ex:
+//
+//	{
+//	  "entry": "start",
+//	  "entries": {"final_approval": "final"},
+//	  "inputs": {"age": {"type": "int", "min": 0}, "segment": {"type": "string", "optional": true, "enum": ["prime"]}},
+//	  "outputs": {"approved": {"type": "bool"}},
+//	  "constants": {"min_score": 700, "blocked_states": ["NY", "CA"]},
+//	  "derived": {"dti": "debt / income"},
+//	  "timeout": "50ms",
+//	  "nodes": [
+//	    {"id": "start"},
+//	    {"id": "approved", "result": {"approved": true, "segment": "prime"}}
+//	  ],
+//	  "edges": [
+//	    {"from": "start", "to": "approved", "cond": "age>=18 && score>700", "priority": 1},
+//	    {"from": "start", "to": "review", "default": true}
+//	  ]
+//	}
+//
+// Compila pro mesmo Policy do DOT, com as mesmas validações (entries, DAG, lint).
+type Document struct {
+	Entry   string                   `json:"entry,omitempty"`
+	Entries map[string]string        `json:"entries,omitempty"`
+	Inputs  map[string]DocumentInput `json:"inputs,omitempty"`
+	Outputs map[string]DocumentInput `json:"outputs,omitempty"`
+	// Constants sao os const_/list_ do DOT; array vira lista.
+	Constants map[string]any `json:"constants,omitempty"`
+	// Derived sao os derived_<name> do DOT: nome -> expressão.
+	Derived map[string]string `json:"derived,omitempty"`
+	// Timeout é o timeout do DOT (duração do Go, ex: "50ms").
+	Timeout string         `json:"timeout,omitempty"`
+	Nodes   []DocumentNode `json:"nodes"`
+	Edges   []DocumentEdge `json:"edges,omitempty"`
+}
+
+// DocumentInput é o input_<name>/output_<name> do DOT (ver InputField).
+type DocumentInput struct {
+	Type     string   `json:"type"`
+	Optional bool     `json:"optional,omitempty"`
+	Enum     []any    `json:"enum,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+}
+
+type DocumentNode struct {
+	ID     string         `json:"id"`
+	Call   string         `json:"call,omitempty"`
+	Fanout string         `json:"fanout,omitempty"`
+	Join   string         `json:"join,omitempty"`
+	Result map[string]any `json:"result,omitempty"`
+}
+
+type DocumentEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Cond     string `json:"cond,omitempty"`
+	Priority *int   `json:"priority,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+}
+
+// CompileJSON é o front-end JSON do compiler (ver Document).
+func (c *Compiler) CompileJSON(src string) (*Policy, error) {
+	dec := json.NewDecoder(strings.NewReader(src))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+
+	var doc Document
+	if err := dec.Decode(&doc); err != nil {
+		var errs CompileErrors
+		errs.add(jsonErrorPos(src, err), CompileError{Message: fmt.Sprintf("parse JSON: %v", err)})
+		return nil, errs
+	}
+
+	p, attrs, errs := doc.build()
+	return c.finish(p, attrs, nil, errs)
+}
+
+// build monta o Policy a partir do documento; attrs sao os mesmos atributos de grafo que o DOT teria.
+func (doc Document) build() (*Policy, map[string]string, CompileErrors) {
+	var errs CompileErrors
+	p := &Policy{
+		Start: defaultStart,
+		Nodes: map[string]*Node{},
+	}
+
+	for i, dn := range doc.Nodes {
+		id := strings.TrimSpace(dn.ID)
+		if id == "" {
+			errs.add(Pos{}, CompileError{Attr: "id", Message: fmt.Sprintf("nodes[%d]: id is required", i)})
+			continue
+		}
+		if _, dup := p.Nodes[id]; dup {
+			errs.add(Pos{}, CompileError{Node: id, Message: fmt.Sprintf("node %s declared more than once", id)})
+			continue
+		}
+
+		node := ensureNode(p, id)
+		if ref := strings.TrimSpace(dn.Call); ref != "" {
+			node.Call = &PolicyCall{Ref: ref}
+		}
+		node.Fanout = strings.TrimSpace(dn.Fanout)
+		node.Join = MergeStrategy(strings.TrimSpace(dn.Join))
+		assignments, err := documentResult(dn.Result)
+		if err != nil {
+			errs.add(Pos{}, CompileError{
+				Node:    id,
+				Attr:    "result",
+				Message: fmt.Sprintf("node %s invalid result: %v", id, err),
+			})
+			continue
+		}
+		node.Result = assignments
+	}
+
+	for i, de := range doc.Edges {
+		from, to := strings.TrimSpace(de.From), strings.TrimSpace(de.To)
+		if from == "" || to == "" {
+			errs.add(Pos{}, CompileError{Message: fmt.Sprintf("edges[%d]: from and to are required", i)})
+			continue
+		}
+		ref := &EdgeRef{From: from, To: to}
+
+		cond := strings.TrimSpace(de.Cond)
+		compiledCond, err := eval.Compile(cond)
+		if err != nil {
+			errs.add(Pos{}, CompileError{Node: from, Edge: ref, Attr: "cond", Message: fmt.Sprintf("edge %s invalid cond: %v", from, err)})
+		}
+		if de.Default && cond != "" {
+			errs.add(Pos{}, CompileError{Node: from, Edge: ref, Attr: "default", Message: fmt.Sprintf("edge %s: default edge cannot have cond", from)})
+		}
+		if de.Default && de.Priority != nil {
+			errs.add(Pos{}, CompileError{Node: from, Edge: ref, Attr: "priority", Message: fmt.Sprintf("edge %s: default edge cannot have priority", from)})
+		}
+
+		ensureNode(p, from)
+		ensureNode(p, to)
+		p.Nodes[from].Outgoing = append(p.Nodes[from].Outgoing, Edge{
+			To:           to,
+			Cond:         cond,
+			CompiledCond: compiledCond,
+			Default:      de.Default,
+			Priority:     de.Priority,
+		})
+	}
+
+	p.Inputs = documentSchema("inputs", doc.Inputs, &errs)
+	p.Outputs = documentSchema("outputs", doc.Outputs, &errs)
+	p.Constants = documentConstants(doc.Constants, &errs)
+
+	attrs := map[string]string{}
+	if doc.Entry != "" {
+		attrs["entry"] = doc.Entry
+	}
+	for name, id := range doc.Entries {
+		attrs["entry_"+name] = id
+	}
+	for name, src := range doc.Derived {
+		attrs["derived_"+name] = src
+	}
+	if doc.Timeout != "" {
+		attrs["timeout"] = doc.Timeout
+	}
+
+	return p, attrs, errs
+}
+
+// documentConstants valida o bloco constants com as mesmas regras do const_/list_ do DOT.
+func documentConstants(raw map[string]any, errs *CompileErrors) map[string]any {
+	if len(raw) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make(map[string]any, len(raw))
+	for _, name := range names {
+		if err := validateConstName(name); err != nil {
+			errs.add(Pos{}, CompileError{Attr: "constants", Message: fmt.Sprintf("constants: %v", err)})
+			continue
+		}
+		v, err := documentValue(raw[name])
+		if err == nil {
+			err = validateConstValue(v)
+		}
+		if err != nil {
+			errs.add(Pos{}, CompileError{Attr: "constants", Message: fmt.Sprintf("constants %s: %v", name, err)})
+			continue
+		}
+		out[name] = v
+	}
+	return out
+}
+
+// documentSchema converte o bloco inputs/outputs do documento, com as mesmas regras do input_/output_ do DOT.
+func documentSchema(attr string, fields map[string]DocumentInput, errs *CompileErrors) InputSchema {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out InputSchema
+	for _, name := range names {
+		di := fields[name]
+		if strings.TrimSpace(name) == "" {
+			errs.add(Pos{}, CompileError{Attr: attr, Message: fmt.Sprintf("%s entry has empty name", attr)})
+			continue
+		}
+		f := InputField{Name: name, Type: di.Type, Required: !di.Optional, Min: di.Min, Max: di.Max}
+		var bad error
+		for _, e := range di.Enum {
+			v, err := documentValue(e)
+			if err != nil {
+				bad = err
+				break
+			}
+			f.Enum = append(f.Enum, v)
+		}
+		if bad == nil {
+			bad = validateInputField(f)
+		}
+		if bad != nil {
+			errs.add(Pos{}, CompileError{Attr: attr + "." + name, Message: fmt.Sprintf("%s %s: %v", strings.TrimSuffix(attr, "s"), name, bad)})
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// documentResult converte o result tipado do JSON em assignments (chaves em ordem alfabetica).
+// Numero inteiro vira int, igual ao result do DOT; null, array e object passam direto.
+// String no formato "$(...)" é expressão calculada, igual no DOT.
+// Operadores vão na chave: {"reasons+=": "LOW_SCORE", "-temp_flag": null}.
+func documentResult(result map[string]any) ([]Assignment, error) {
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(result))
+	for k := range result {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]Assignment, 0, len(keys))
+	for _, raw := range keys {
+		key, op := documentResultKey(raw)
+		if strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("empty key in result")
+		}
+
+		path, err := resultPath(key)
+		if err != nil {
+			return nil, err
+		}
+		if op == OpUnset {
+			if result[raw] != nil {
+				return nil, fmt.Errorf("key %s: unset must have null value", raw)
+			}
+			out = append(out, Assignment{Key: key, Path: path, Op: op})
+			continue
+		}
+		if src, ok := documentExpr(result[raw]); ok {
+			compiled, err := eval.CompileExpr(src)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: invalid expression $(%s): %v", raw, src, err)
+			}
+			out = append(out, Assignment{Key: key, Path: path, Expr: compiled, Op: op})
+			continue
+		}
+		val, err := documentValue(result[raw])
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", raw, err)
+		}
+		if op == OpAdd && val == nil {
+			return nil, fmt.Errorf("key %s: operator += needs a non-null value", raw)
+		}
+		out = append(out, Assignment{Key: key, Value: val, Path: path, Op: op})
+	}
+	return out, nil
+}
+
+// documentResultKey separa o operador da chave: "reasons+=" acumula e "-temp_flag" remove (valor null).
+func documentResultKey(raw string) (string, AssignOp) {
+	switch {
+	case strings.HasSuffix(raw, "+="):
+		return strings.TrimSpace(strings.TrimSuffix(raw, "+=")), OpAdd
+	case strings.HasPrefix(raw, "-"):
+		return strings.TrimSpace(strings.TrimPrefix(raw, "-")), OpUnset
+	}
+	return raw, OpSet
+}
+
+// documentResultKeyFor é o inverso do documentResultKey, usado no ToDocument.
+func documentResultKeyFor(a Assignment) string {
+	switch a.Op {
+	case OpAdd:
+		return a.Key + "+="
+	case OpUnset:
+		return "-" + a.Key
+	}
+	return a.Key
+}
+
+func documentExpr(v any) (string, bool) {
+	s, ok := v.(string)
+	if !ok || !strings.HasPrefix(s, "$(") || !strings.HasSuffix(s, ")") {
+		return "", false
+	}
+	return s[2 : len(s)-1], true
+}
+
+// documentValue normaliza o json.Number recursivamente (dentro de array/object também).
+func documentValue(v any) (any, error) {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return int(i), nil
+		}
+		if f, err := val.Float64(); err == nil {
+			return f, nil
+		}
+		return nil, fmt.Errorf("invalid number %s", val)
+	case nil, string, bool:
+		return val, nil
+	case []any:
+		out := make([]any, len(val))
+		for i, it := range val {
+			n, err := documentValue(it)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = n
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, it := range val {
+			n, err := documentValue(it)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = n
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", val)
+	}
+}
+
+// jsonErrorPos traduz o offset do erro de decode em linha/coluna.
+func jsonErrorPos(src string, err error) Pos {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return Pos{}
+	}
+
+	if offset > int64(len(src)) {
+		offset = int64(len(src))
+	}
+	before := []byte(src[:offset])
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return Pos{Line: line, Column: col}
+}
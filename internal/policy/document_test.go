@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const complexPolicyJSON = `{
+  "nodes": [
+    {"id": "start"},
+    {"id": "approved", "result": {"approved": true, "segment": "prime"}},
+    {"id": "review", "result": {"approved": false, "segment": "manual"}},
+    {"id": "rejected", "result": {"approved": false}}
+  ],
+  "edges": [
+    {"from": "start", "to": "approved", "cond": "age>=18 && score>700"},
+    {"from": "start", "to": "review", "cond": "age>=18 && score<=700"},
+    {"from": "start", "to": "rejected", "cond": "age<18"}
+  ]
+}`
+
+func TestCompileJSON_MatchesDOTPolicy(t *testing.T) {
+	dot, err := os.ReadFile("testdata/complex.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compiler := NewCompiler()
+	fromDOT, err := compiler.Compile(string(dot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := compiler.CompileJSON(complexPolicyJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := summarize(fromJSON), summarize(fromDOT); !reflect.DeepEqual(got, want) {
+		t.Fatalf("policies differ:\njson=%v\ndot=%v", got, want)
+	}
+}
+
+func TestCompileJSON_ReportsErrors(t *testing.T) {
+	_, err := NewCompiler().CompileJSON(`{
+  "nodes": [{"id": "ok", "result": {" ": true}}],
+  "edges": [{"from": "start", "to": "ok", "cond": "x+1>2"}]
+}`)
+	var errs CompileErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected 2 compile errors, got %v", err)
+	}
+	if errs[0].Node != "ok" || errs[0].Attr != "result" {
+		t.Fatalf("unexpected result error: %#v", errs[0])
+	}
+	if errs[1].Edge == nil || errs[1].Edge.To != "ok" || errs[1].Attr != "cond" {
+		t.Fatalf("unexpected cond error: %#v", errs[1])
+	}
+
+	_, err = NewCompiler().CompileJSON("{\n  \"nodes\": [,]\n}")
+	if !errors.As(err, &errs) || errs[0].Line != 2 || !strings.Contains(errs[0].Message, "parse JSON") {
+		t.Fatalf("expected positioned parse error, got %v", err)
+	}
+}
+
+func TestConvert_RoundTripsBetweenFormats(t *testing.T) {
+	compiler := NewCompiler()
+	original, err := compiler.Compile(`digraph {
+		entry="intake";
+		entry_final="final";
+		input_score="int, min=0, max=1000";
+		input_segment="string, optional, enum=prime|standard";
+		output_approved="bool";
+		const_min_score=700;
+		const_note="'it, ok'";
+		list_segments="prime,'standard plus',3";
+		derived_double="score * 2";
+		derived_big="double > min_score";
+		intake -> final [cond="segment==\"prime\" && score > min_score && segment in segments", priority=1];
+		intake -> other [default=true];
+		final [result="approved=true,code=007::string,label='say \"hi\", ok',tags=['a', 1],limits={daily: 500, extra: null},limit=$(score * 2 + 1)"];
+		other [result="approved=false,ratio=1.5,reasons+=MANUAL,points+=$(score / 10),-temp"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromDOT, err := compiler.Compile(ToDOT(original))
+	if err != nil {
+		t.Fatalf("recompile DOT: %v\n%s", err, ToDOT(original))
+	}
+	if got, want := summarize(fromDOT), summarize(original); !reflect.DeepEqual(got, want) {
+		t.Fatalf("DOT round trip differs:\ngot=%v\nwant=%v", got, want)
+	}
+
+	doc, err := json.Marshal(ToDocument(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := compiler.CompileJSON(string(doc))
+	if err != nil {
+		t.Fatalf("recompile JSON: %v\n%s", err, doc)
+	}
+	if got, want := summarize(fromJSON), summarize(original); !reflect.DeepEqual(got, want) {
+		t.Fatalf("JSON round trip differs:\ngot=%v\nwant=%v", got, want)
+	}
+}
+
+// summarize tira o que é detalhe de compile (programa compilado, posição) pra comparar policies.
+func summarize(p *Policy) map[string]any {
+	nodes := map[string]any{}
+	for id, n := range p.Nodes {
+		results := map[string]any{}
+		for _, a := range n.Result {
+			key := documentResultKeyFor(a)
+			results[key] = a.Value
+			if a.Expr != nil {
+				results[key] = "expr:" + a.Expr.Source()
+			}
+		}
+		var edges []string
+		for _, e := range n.Outgoing {
+			prio := "-"
+			if e.Priority != nil {
+				prio = strconv.Itoa(*e.Priority)
+			}
+			edges = append(edges, e.To+"|"+e.Cond+"|"+prio+"|"+map[bool]string{true: "default", false: ""}[e.Default])
+		}
+		nodes[id] = map[string]any{"result": results, "edges": edges}
+	}
+	var derived []string
+	for _, d := range p.Derived {
+		derived = append(derived, d.Name+"="+d.Expr.Source())
+	}
+	return map[string]any{"derived": derived, "start": p.Start, "entries": p.Entries, "inputs": p.Inputs, "outputs": p.Outputs, "constants": p.Constants, "nodes": nodes}
+}
+
+func TestToDOT_QuotesGraphAttributeNames(t *testing.T) {
+	original, err := NewCompiler().CompileJSON(`{
+  "entries": {"final approval": "final"},
+  "nodes": [{"id": "start"}, {"id": "final", "result": {"approved": true}}],
+  "edges": [{"from": "start", "to": "final", "cond": "segment == \"prime\""}]
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dot := ToDOT(original)
+	if !strings.Contains(dot, `"entry_final approval"="final"`) {
+		t.Fatalf("expected quoted entry attribute, got:\n%s", dot)
+	}
+	back, err := NewCompiler().Compile(dot)
+	if err != nil {
+		t.Fatalf("recompile DOT: %v\n%s", err, dot)
+	}
+	if back.Entries["final approval"] != "final" || back.Nodes["start"].Outgoing[0].Cond != `segment == "prime"` {
+		t.Fatalf("unexpected round trip: entries=%v cond=%q", back.Entries, back.Nodes["start"].Outgoing[0].Cond)
+	}
+}
@@ -1,6 +1,7 @@
 package policy
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
@@ -22,6 +23,8 @@ type Engine struct {
 	eval            Evaluator
 	latencyObserver NodeLatencyObserver
 	maxSteps        int
+	evaluateAll     bool
+	explain         bool
 }
 
 type EngineOption func(*Engine)
@@ -40,6 +43,13 @@ func WithMaxSteps(maxSteps int) EngineOption {
 	}
 }
 
+// WithEvaluateAll liga o modo evaluate-all em toda execução (ver ContextWithEvaluateAll pra ligar por request).
+func WithEvaluateAll() EngineOption {
+	return func(e *Engine) {
+		e.evaluateAll = true
+	}
+}
+
 func NewEngine(eval Evaluator, opts ...EngineOption) *Engine {
 	e := &Engine{
 		eval:     eval,
@@ -53,38 +63,74 @@ func NewEngine(eval Evaluator, opts ...EngineOption) *Engine {
 
 // Run executa a inferencia normal (sem retornar trace), só muta vars com resultado final.
 func (e *Engine) Run(p *Policy, vars map[string]any) error {
-	_, err := e.runInternal(p, vars, nil)
+	return e.RunContext(context.Background(), p, vars)
+}
+
+// RunContext é o Run que para quando o ctx é cancelado ou estoura o prazo (do ctx ou o timeout da policy).
+// A checagem é entre nós e entre avaliações de aresta; o erro embrulha o ctx.Err().
+func (e *Engine) RunContext(ctx context.Context, p *Policy, vars map[string]any) error {
+	_, err := e.runInternal(ctx, p, vars, nil)
 	return err
 }
 
 // RunWithTrace faz a mesma execução do Run, mas trazendo o caminho todo pra debug.
 // Bom pra explicar porque foi pra um nó e não pro outro.
 func (e *Engine) RunWithTrace(p *Policy, vars map[string]any) (*ExecutionTrace, error) {
+	return e.RunWithTraceContext(context.Background(), p, vars)
+}
+
+// RunWithTraceContext é o RunWithTrace com cancelamento/prazo (ver RunContext).
+func (e *Engine) RunWithTraceContext(ctx context.Context, p *Policy, vars map[string]any) (*ExecutionTrace, error) {
 	trace := &ExecutionTrace{}
-	return e.runInternal(p, vars, trace)
+	return e.runInternal(ctx, p, vars, trace)
 }
 
 // runInternal é o coração da engine:
-// visita nó, aplica result, avalia arestas em ordem e segue a primeira cond true.
-func (e *Engine) runInternal(p *Policy, vars map[string]any, trace *ExecutionTrace) (*ExecutionTrace, error) {
+// calcula as derivadas, visita nó, roda o call (se tiver), aplica result, avalia arestas em ordem e segue a primeira cond true.
+// A aresta default (se tiver) já vem por ultimo do compiler, entao vira o "senão".
+func (e *Engine) runInternal(ctx context.Context, p *Policy, vars map[string]any, trace *ExecutionTrace) (*ExecutionTrace, error) {
 	if p == nil {
 		return trace, fmt.Errorf("policy is nil")
 	}
 	if p.Nodes == nil {
 		return trace, fmt.Errorf("policy nodes is nil")
 	}
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
 
 	start := p.Start
 	if start == "" {
-		start = "start"
+		start = defaultStart
 	}
 	if trace != nil {
 		trace.StartNode = start
 	}
 
-	current := start
+	if err := evalDerived(p, vars, trace); err != nil {
+		setTermination(trace, "error_derived")
+		return trace, err
+	}
+
+	return e.walk(ctx, p, start, "", vars, trace, e.evaluateAll || evaluateAllFrom(ctx))
+}
+
+// walk é o loop da travessia a partir de from. Com stopAt (branch de fan-out) para com sucesso ao chegar
+// nesse nó, sem visitar; folha ou nó sem aresta casando antes dele é erro do branch.
+func (e *Engine) walk(ctx context.Context, p *Policy, from, stopAt string, vars map[string]any, trace *ExecutionTrace, evaluateAll bool) (*ExecutionTrace, error) {
+	current := from
+	explain := trace != nil && (e.explain || explainFrom(ctx))
 
 	for range e.maxSteps {
+		if err := ctx.Err(); err != nil {
+			setTermination(trace, contextTermination(err))
+			return trace, fmt.Errorf("execution stopped before node %q: %w", current, err)
+		}
+		if current == stopAt {
+			return trace, nil
+		}
 		nodeStart := time.Now()
 		step := TraceStep{NodeID: current}
 		node := p.Nodes[current]
@@ -98,8 +144,42 @@ func (e *Engine) runInternal(p *Policy, vars map[string]any, trace *ExecutionTra
 		}
 		appendVisitedNode(trace, current)
 
-		for _, a := range node.Result {
-			vars[a.Key] = a.Value
+		if node.Call != nil {
+			call, err := e.runCall(ctx, node.Call, vars, trace != nil)
+			step.Call = call
+			if err != nil {
+				duration := time.Since(nodeStart)
+				e.observeNodeLatency(current, duration)
+				step.DurationMicros = duration.Microseconds()
+				appendTrace(trace, step)
+				if isContextErr(err) {
+					setTermination(trace, contextTermination(err))
+				} else {
+					setTermination(trace, "error_call")
+				}
+				return trace, fmt.Errorf("node %q call %s: %w", current, node.Call.Ref, err)
+			}
+			if call != nil && call.Trace != nil {
+				for _, n := range call.Trace.AmbiguousNodes {
+					markAmbiguous(trace, current+"/"+n)
+				}
+			}
+		}
+
+		results, err := applyResult(node, vars, trace != nil)
+		step.Results = results
+		if err != nil {
+			duration := time.Since(nodeStart)
+			e.observeNodeLatency(current, duration)
+			step.DurationMicros = duration.Microseconds()
+			appendTrace(trace, step)
+			var opErr *resultOpError
+			if errors.As(err, &opErr) {
+				setTermination(trace, "error_result_op")
+			} else {
+				setTermination(trace, "error_result_expr")
+			}
+			return trace, fmt.Errorf("node %q %w", current, err)
 		}
 
 		if len(node.Outgoing) == 0 {
@@ -107,8 +187,11 @@ func (e *Engine) runInternal(p *Policy, vars map[string]any, trace *ExecutionTra
 			e.observeNodeLatency(current, duration)
 			step.DurationMicros = duration.Microseconds()
 			appendTrace(trace, step)
-			setTermination(trace, "leaf")
-			return trace, nil
+			if stopAt != "" {
+				setTermination(trace, "error_branch_no_join")
+				return trace, fmt.Errorf("branch reached leaf %q without reaching join %q", current, stopAt)
+			}
+			return finishRun(p, vars, trace, "leaf")
 		}
 
 		found := false
@@ -116,10 +199,23 @@ func (e *Engine) runInternal(p *Policy, vars map[string]any, trace *ExecutionTra
 		errs := make([]string, 0, len(node.Outgoing))
 		missingVars := map[string]struct{}{}
 		edgeTraces := make([]EdgeTrace, 0, len(node.Outgoing))
+		var branches []string // fan-out: todo alvo que casou
 
-		for _, edge := range node.Outgoing {
+		for i, edge := range node.Outgoing {
+			if edge.Default && len(branches) > 0 {
+				continue // no fan-out a default só vira branch quando nenhuma outra casou
+			}
+			if err := ctx.Err(); err != nil {
+				step.Edges = edgeTraces
+				duration := time.Since(nodeStart)
+				e.observeNodeLatency(current, duration)
+				step.DurationMicros = duration.Microseconds()
+				appendTrace(trace, step)
+				setTermination(trace, contextTermination(err))
+				return trace, fmt.Errorf("execution stopped at node %q before edge %s -> %s: %w", current, current, edge.To, err)
+			}
 			ok, err := e.evalEdge(edge, vars)
-			edgeTrace := EdgeTrace{To: edge.To, Cond: edge.Cond}
+			edgeTrace := EdgeTrace{To: edge.To, Cond: edge.Cond, Order: i, Priority: edge.Priority, Default: edge.Default}
 			if err != nil {
 				errs = append(errs, fmt.Sprintf("%s -> %s (%q): %v", current, edge.To, edge.Cond, err))
 				edgeTrace.Error = err.Error()
@@ -132,17 +228,59 @@ func (e *Engine) runInternal(p *Policy, vars map[string]any, trace *ExecutionTra
 				edgeTraces = append(edgeTraces, edgeTrace)
 				continue
 			}
+			if ok && node.Fanout != "" {
+				edgeTrace.Matched = true
+				edgeTraces = append(edgeTraces, edgeTrace)
+				branches = append(branches, edge.To)
+				continue
+			}
 			if ok {
 				next = edge.To
 				found = true
 				edgeTrace.Matched = true
 				edgeTraces = append(edgeTraces, edgeTrace)
+				if evaluateAll {
+					rest, also := e.evalRemaining(node.Outgoing[i+1:], i+1, vars)
+					edgeTraces = append(edgeTraces, rest...)
+					if len(also) > 0 {
+						step.Ambiguous = true
+						markAmbiguous(trace, current)
+						e.observeAmbiguous(current, append([]string{next}, also...))
+					}
+				}
 				break
 			}
 			edgeTraces = append(edgeTraces, edgeTrace)
 		}
+		if explain {
+			explainEdges(p, current, edgeTraces, vars)
+		}
 		step.Edges = edgeTraces
 
+		if len(branches) > 0 {
+			fan, err := e.runFanout(ctx, p, node, branches, vars, trace != nil, evaluateAll)
+			step.Fanout = fan
+			if fan != nil {
+				for _, b := range fan.Branches {
+					if b.Trace != nil {
+						for _, n := range b.Trace.AmbiguousNodes {
+							markAmbiguous(trace, n)
+						}
+					}
+				}
+			}
+			if err != nil {
+				duration := time.Since(nodeStart)
+				e.observeNodeLatency(current, duration)
+				step.DurationMicros = duration.Microseconds()
+				appendTrace(trace, step)
+				setTermination(trace, fanoutTermination(err))
+				return trace, fmt.Errorf("node %q fan-out: %w", current, err)
+			}
+			next = node.Fanout
+			found = true
+		}
+
 		if !found {
 			duration := time.Since(nodeStart)
 			e.observeNodeLatency(current, duration)
@@ -160,8 +298,11 @@ func (e *Engine) runInternal(p *Policy, vars map[string]any, trace *ExecutionTra
 				setTermination(trace, "error_no_edge_matched")
 				return trace, fmt.Errorf("no edge matched at node %q: eval details: %s", current, strings.Join(errs, "; "))
 			}
-			setTermination(trace, "no_edge_matched")
-			return trace, nil
+			if stopAt != "" {
+				setTermination(trace, "error_branch_no_join")
+				return trace, fmt.Errorf("branch stopped at node %q (no edge matched) without reaching join %q", current, stopAt)
+			}
+			return finishRun(p, vars, trace, "no_edge_matched")
 		}
 
 		step.ChosenNext = next
@@ -176,6 +317,115 @@ func (e *Engine) runInternal(p *Policy, vars map[string]any, trace *ExecutionTra
 	return trace, fmt.Errorf("maxSteps exceeded (possible cycle or huge graph)")
 }
 
+// runCall roda a sub-policy numa cópia das vars (com o schema de input dela) e, se der certo, devolve
+// pro chamador só o que ela publica: os campos output_ declarados ou, sem contrato, as chaves que o
+// result dela grava. Derivada da sub-policy fica na cópia, assim como o -temp (chave do chamador nunca
+// é removida).
+func (e *Engine) runCall(ctx context.Context, call *PolicyCall, vars map[string]any, record bool) (*CallTrace, error) {
+	if call.Policy == nil {
+		return nil, fmt.Errorf("policy %s is not resolved", call.Ref)
+	}
+	if err := call.Policy.Inputs.Validate(vars); err != nil {
+		return nil, err
+	}
+
+	var sub *ExecutionTrace
+	if record {
+		sub = &ExecutionTrace{}
+	}
+	// a derivada da sub-policy é recalculada lá dentro: valor com o mesmo nome no estado do chamador
+	// (derivada dele ou de um call anterior) nao conta como input colidindo
+	subVars := copyMap(vars)
+	for _, d := range call.Policy.Derived {
+		delete(subVars, d.Name)
+	}
+	sub, err := e.runInternal(ctx, call.Policy, subVars, sub)
+	var out *CallTrace
+	if record {
+		out = &CallTrace{Ref: call.Ref, Trace: sub}
+	}
+	if err != nil {
+		return out, err
+	}
+
+	mergeCallOutput(call.Policy, subVars, vars)
+	return out, nil
+}
+
+func mergeCallOutput(sub *Policy, subVars, vars map[string]any) {
+	if len(sub.Outputs) > 0 {
+		for _, f := range sub.Outputs {
+			path := strings.Split(f.Name, ".")
+			if v, ok := lookupPath(subVars, path); ok {
+				applyAssignment(vars, Assignment{Key: f.Name, Path: path}, v)
+			}
+		}
+		return
+	}
+	for k := range writtenKeys(sub) {
+		if v, ok := subVars[k]; ok {
+			vars[k] = v
+		}
+	}
+}
+
+// evalRemaining avalia as arestas depois da escolhida (modo evaluate-all) só pra registro:
+// a escolha nao muda e erro aqui nao derruba a execução. A default fica de fora, ela sempre "casa".
+func (e *Engine) evalRemaining(edges []Edge, offset int, vars map[string]any) ([]EdgeTrace, []string) {
+	var (
+		out  []EdgeTrace
+		also []string
+	)
+	for i, edge := range edges {
+		if edge.Default {
+			continue
+		}
+		edgeTrace := EdgeTrace{To: edge.To, Cond: edge.Cond, Order: offset + i, Priority: edge.Priority}
+		ok, err := e.evalEdge(edge, vars)
+		switch {
+		case err != nil:
+			edgeTrace.Error = err.Error()
+		case ok:
+			edgeTrace.AlsoMatched = true
+			also = append(also, edge.To)
+		}
+		out = append(out, edgeTrace)
+	}
+	return out, also
+}
+
+type evaluateAllKey struct{}
+
+// ContextWithEvaluateAll liga o modo evaluate-all só nas execuções com esse ctx (flag do request):
+// a engine continua seguindo a primeira aresta que casa, mas avalia as seguintes e marca as que também casariam.
+func ContextWithEvaluateAll(ctx context.Context) context.Context {
+	return context.WithValue(ctx, evaluateAllKey{}, true)
+}
+
+func evaluateAllFrom(ctx context.Context) bool {
+	on, _ := ctx.Value(evaluateAllKey{}).(bool)
+	return on
+}
+
+// isContextErr diz se a execução parou por cancelamento/prazo (inclusive dentro de uma sub-policy).
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// contextTermination separa prazo estourado (error_deadline_exceeded) de cancelamento (error_canceled).
+func contextTermination(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return "error_canceled"
+	}
+	return "error_deadline_exceeded"
+}
+
+func (e *Engine) observeAmbiguous(nodeID string, matched []string) {
+	if o, ok := e.latencyObserver.(AmbiguityObserver); ok {
+		o.ObserveAmbiguousDecision(nodeID, matched)
+	}
+}
+
 func (e *Engine) observeNodeLatency(nodeID string, duration time.Duration) {
 	if e.latencyObserver == nil {
 		return
@@ -192,6 +442,58 @@ func (e *Engine) evalEdge(edge Edge, vars map[string]any) (bool, error) {
 	return e.eval.Eval(edge.Cond, vars)
 }
 
+// finishRun fecha uma execução que terminou sem erro, conferindo o contrato de saida (output_<key>).
+func finishRun(p *Policy, vars map[string]any, trace *ExecutionTrace, terminated string) (*ExecutionTrace, error) {
+	if err := p.Outputs.validateOutput(vars); err != nil {
+		setTermination(trace, "error_output_contract")
+		return trace, err
+	}
+	setTermination(trace, terminated)
+	return trace, nil
+}
+
+// applyResult aplica o result do nó em ordem; expressão enxerga o que os assignments anteriores já gravaram.
+// Com record=true devolve o antes/depois de cada assignment pro trace.
+func applyResult(node *Node, vars map[string]any, record bool) ([]ResultTrace, error) {
+	var out []ResultTrace
+	for _, a := range node.Result {
+		path := a.path()
+		before, exists := lookupPath(vars, path)
+
+		var value any
+		switch {
+		case a.Op == OpUnset:
+		case a.Expr != nil:
+			v, err := a.Expr.Run(vars)
+			if err != nil {
+				return out, fmt.Errorf("result %s: $(%s): %w", a.Key, a.Expr.Source(), err)
+			}
+			value = v
+		default:
+			value = cloneValue(a.Value)
+		}
+
+		switch a.Op {
+		case OpUnset:
+			unsetPath(vars, path)
+		case OpAdd:
+			v, err := accumulate(before, exists, value)
+			if err != nil {
+				return out, fmt.Errorf("result %s+=: %w", a.Key, err)
+			}
+			applyAssignment(vars, a, v)
+		default:
+			applyAssignment(vars, a, value)
+		}
+
+		if record {
+			after, stays := lookupPath(vars, path)
+			out = append(out, ResultTrace{Key: a.Key, Op: a.Op.String(), Before: before, Existed: exists, After: after, Exists: stays})
+		}
+	}
+	return out, nil
+}
+
 func joinSortedKeys(items map[string]struct{}) string {
 	if len(items) == 0 {
 		return ""
@@ -219,6 +521,14 @@ func appendTrace(trace *ExecutionTrace, step TraceStep) {
 	trace.Steps = append(trace.Steps, step)
 }
 
+func markAmbiguous(trace *ExecutionTrace, node string) {
+	if trace == nil {
+		return
+	}
+	trace.Ambiguous = true
+	trace.AmbiguousNodes = append(trace.AmbiguousNodes, node)
+}
+
 func setTermination(trace *ExecutionTrace, terminated string) {
 	if trace == nil {
 		return
@@ -1,10 +1,15 @@
 package policy
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
 )
 
 type fakeEval struct {
@@ -294,3 +299,264 @@ func TestEngine_RunWithTrace_MissingVarsIncludesTraceOnError(t *testing.T) {
 		t.Fatalf("expected edge error details in trace")
 	}
 }
+
+func TestEngine_RunWithTrace_DefaultEdgeIsReportedAsFallback(t *testing.T) {
+	compiler := NewCompiler()
+	p, err := compiler.Compile(`digraph {
+		start -> review [default=true];
+		start -> approved [cond="score>700"];
+		approved [result="approved=true"];
+		review [result="approved=false,segment=manual"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEngine(ExprEvaluator{})
+	vars := map[string]any{"score": 650}
+	trace, err := e.RunWithTrace(p, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["segment"] != "manual" {
+		t.Fatalf("expected fallback to review, got %#v", vars)
+	}
+	edges := trace.Steps[0].Edges
+	if len(edges) != 2 || edges[0].Default || !edges[1].Default || !edges[1].Matched {
+		t.Fatalf("expected matched default edge after conditional edge, got %#v", edges)
+	}
+}
+
+func TestEngine_RunWithTrace_ExposesEffectiveEdgeOrder(t *testing.T) {
+	compiler := NewCompiler()
+	p, err := compiler.Compile(`digraph {
+		start -> adult [cond="age>=18", priority=2];
+		start -> minor [cond="age<18", priority=1];
+		adult [result="approved=true"];
+		minor [result="approved=false"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, map[string]any{"age": 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edges := trace.Steps[0].Edges
+	if len(edges) != 2 {
+		t.Fatalf("expected 2 evaluated edges, got %#v", edges)
+	}
+	if edges[0].To != "minor" || edges[0].Order != 0 || edges[0].Priority == nil || *edges[0].Priority != 1 {
+		t.Fatalf("unexpected first edge trace: %#v", edges[0])
+	}
+	if edges[1].To != "adult" || edges[1].Order != 1 || !edges[1].Matched {
+		t.Fatalf("unexpected second edge trace: %#v", edges[1])
+	}
+}
+
+func TestEngine_Run_StructuredResultIsCopiedPerRun(t *testing.T) {
+	p := &Policy{
+		Start: "start",
+		Nodes: map[string]*Node{
+			"start": {ID: "start", Result: []Assignment{
+				{Key: "limits", Value: map[string]any{"daily": 500}},
+				{Key: "tags", Value: []any{"vip"}},
+			}},
+		},
+	}
+	e := NewEngine(fakeEval{fn: func(string, map[string]any) (bool, error) { return true, nil }})
+
+	vars := map[string]any{}
+	if err := e.Run(p, vars); err != nil {
+		t.Fatal(err)
+	}
+	vars["limits"].(map[string]any)["daily"] = 0
+	vars["tags"].([]any)[0] = "changed"
+
+	again := map[string]any{}
+	if err := e.Run(p, again); err != nil {
+		t.Fatal(err)
+	}
+	if again["limits"].(map[string]any)["daily"] != 500 || again["tags"].([]any)[0] != "vip" {
+		t.Fatalf("compiled result was mutated: %#v", again)
+	}
+}
+
+func TestEngine_RunWithTrace_ComputedResult(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+		start -> ok [cond="income>0"];
+		ok [result="limit=$(income*3),decision.applicant=$(name),label=$(name == \"ana\" ? \"vip\" : \"std\"),base=10,bonus=$(base/4)"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]any{"income": 1000, "name": "ana"}
+	if _, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars["limit"] != 3000 || vars["label"] != "vip" || vars["bonus"] != 2.5 {
+		t.Fatalf("unexpected computed values: %#v", vars)
+	}
+	if vars["decision"].(map[string]any)["applicant"] != "ana" {
+		t.Fatalf("expected nested copy of name, got %#v", vars["decision"])
+	}
+
+	vars = map[string]any{"income": 1000}
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, vars)
+	var mvErr *eval.MissingVariablesError
+	if !errors.As(err, &mvErr) || mvErr.Vars[0] != "name" {
+		t.Fatalf("expected missing name error, got %v", err)
+	}
+	if trace.Terminated != "error_result_expr" {
+		t.Fatalf("expected error_result_expr, got %q", trace.Terminated)
+	}
+}
+
+func TestEngine_RunWithTrace_AccumulatingOperators(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+		start [result="score=0,temp_flag=true"];
+		start -> low [cond="income<1000"];
+		low [result="reasons+=LOW_INCOME,score+=15"];
+		low -> done [default=true];
+		done [result="reasons+=MANUAL_REVIEW,score+=$(income / 100),-temp_flag"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]any{"income": 500}
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := vars["reasons"]; fmt.Sprint(got) != "[LOW_INCOME MANUAL_REVIEW]" {
+		t.Fatalf("unexpected reasons: %#v", got)
+	}
+	if vars["score"] != 20.0 {
+		t.Fatalf("expected score 20.0, got %#v", vars["score"])
+	}
+	if _, ok := vars["temp_flag"]; ok {
+		t.Fatalf("expected temp_flag to be unset")
+	}
+
+	last := trace.Steps[2].Results
+	if len(last) != 3 || last[0].Op != "add" || fmt.Sprint(last[0].Before) != "[LOW_INCOME]" ||
+		last[1].Before != 15 || last[1].After != 20.0 ||
+		last[2].Op != "unset" || last[2].Before != true || last[2].After != nil {
+		t.Fatalf("unexpected result trace: %#v", last)
+	}
+	if !last[2].Existed || last[2].Exists || !trace.Steps[1].Results[0].Exists || trace.Steps[1].Results[0].Existed {
+		t.Fatalf("existed/exists must track key presence: %#v %#v", trace.Steps[1].Results, last)
+	}
+	raw, err := json.Marshal(last[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != `{"key":"temp_flag","op":"unset","before":true,"existed":true,"after":null,"exists":false}` {
+		t.Fatalf("unexpected json: %s", raw)
+	}
+
+	bad, err := NewCompiler().Compile(`digraph { start [result="label=x,label+=y"]; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err = NewEngine(ExprEvaluator{}).RunWithTrace(bad, map[string]any{})
+	if err == nil || trace.Terminated != "error_result_op" {
+		t.Fatalf("expected error_result_op, got %v (%s)", err, trace.Terminated)
+	}
+}
+
+func TestEngine_EvaluateAllRecordsOtherMatchingEdges(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	start -> prime [cond="score > 700"];
+	start -> broken [cond="missing_var > 1"];
+	start -> adult [cond="age >= 18"];
+	start -> rejected [default=true];
+	prime [result="segment='prime'"];
+	broken [result="segment='broken'"];
+	adult [result="segment='adult'"];
+	rejected [result="segment='none'"];
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]any{"score": 720, "age": 30}
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTraceContext(ContextWithEvaluateAll(context.Background()), p, vars)
+	if err != nil {
+		t.Fatalf("evaluate-all must not fail on errors after the chosen edge: %v", err)
+	}
+	if vars["segment"] != "prime" {
+		t.Fatalf("first match must still win, got %v", vars["segment"])
+	}
+	step := trace.Steps[0]
+	if !trace.Ambiguous || !step.Ambiguous || len(trace.AmbiguousNodes) != 1 || trace.AmbiguousNodes[0] != "start" {
+		t.Fatalf("expected ambiguous decision at start, got %+v", trace)
+	}
+	if len(step.Edges) != 3 {
+		t.Fatalf("expected all non-default edges evaluated, got %+v", step.Edges)
+	}
+	if step.Edges[1].Error == "" || step.Edges[1].AlsoMatched {
+		t.Fatalf("expected eval error recorded for broken edge, got %+v", step.Edges[1])
+	}
+	if !step.Edges[2].AlsoMatched || step.Edges[2].Order != 2 {
+		t.Fatalf("expected adult edge marked also_matched, got %+v", step.Edges[2])
+	}
+
+	plain, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, map[string]any{"score": 720, "age": 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.Ambiguous || len(plain.Steps[0].Edges) != 1 {
+		t.Fatalf("default mode should stop at the first match, got %+v", plain.Steps[0].Edges)
+	}
+}
+
+func TestEngine_ExplainRecordsWhyEachEdgeWasOrWasNotTaken(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	const_min_score=700;
+	start -> approved [cond="age >= 18 && score > min_score"];
+	start -> review [cond="age >= 18"];
+	start -> rejected [default=true];
+	approved [result="decision='approved'"];
+	review [result="decision='review'"];
+	rejected [result="decision='rejected'"];
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTraceContext(ContextWithExplain(context.Background()), p, map[string]any{"age": 30.0, "score": 650.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edges := trace.Steps[0].Edges
+	if len(edges) != 2 {
+		t.Fatalf("expected two evaluated edges, got %+v", edges)
+	}
+	ex := edges[0].Explain
+	if ex == nil || ex.Kind != "and" || len(ex.Children) != 2 || ex.Children[1].Value != false {
+		t.Fatalf("expected decomposed cond on first edge, got %+v", ex)
+	}
+	if ex.Children[1].Vars["score"] != 650.0 {
+		t.Fatalf("expected score read by the failing comparison, got %+v", ex.Children[1].Vars)
+	}
+
+	want := []string{
+		"start -> approved not taken: score > min_score was false (score=650)",
+		"start -> review taken: age >= 18 was true (age=30)",
+	}
+	if got := trace.Explanations(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("explanations mismatch\nwant %q\ngot  %q", want, got)
+	}
+
+	plain, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, map[string]any{"age": 30.0, "score": 650.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.Steps[0].Edges[0].Explain != nil || plain.Steps[0].Edges[0].Why != "" {
+		t.Fatalf("explain must be off by default, got %+v", plain.Steps[0].Edges[0])
+	}
+}
@@ -0,0 +1,40 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompileError é um erro de compile apontando pro lugar da policy que causou ele.
+// Line/Column ficam zerados quando a origem nao tem posição (ex: policy montada em memoria).
+type CompileError struct {
+	Line    int      `json:"line,omitempty"`
+	Column  int      `json:"column,omitempty"`
+	Node    string   `json:"node,omitempty"`
+	Edge    *EdgeRef `json:"edge,omitempty"`
+	Attr    string   `json:"attr,omitempty"`
+	Message string   `json:"message"`
+}
+
+func (e *CompileError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+	}
+	return e.Message
+}
+
+// CompileErrors junta todos os erros de um compile, pra quem escreveu a policy corrigir tudo de uma vez.
+type CompileErrors []*CompileError
+
+func (e CompileErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *CompileErrors) add(pos Pos, ce CompileError) {
+	ce.Line, ce.Column = pos.Line, pos.Column
+	*e = append(*e, &ce)
+}
@@ -0,0 +1,21 @@
+package eval
+
+import (
+	"strings"
+
+	"github.com/expr-lang/expr/parser"
+)
+
+// Canonical reescreve a expressão a partir da AST: espaço, quebra de linha e parentese redundante
+// somem, entao "age>=18" e "( age >= 18 )" dao o mesmo texto. Usado no hash canonico da policy.
+func Canonical(src string) (string, error) {
+	src = strings.TrimSpace(src)
+	if src == "" {
+		return "", nil
+	}
+	tree, err := parser.Parse(src)
+	if err != nil {
+		return "", err
+	}
+	return tree.Node.String(), nil
+}
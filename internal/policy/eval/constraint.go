@@ -0,0 +1,649 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+)
+
+// ErrNotAnalyzable indica que a cond usa algo fora do subconjunto que a analise estatica entende
+// (comparação entre variaveis, tipos misturados, expressão grande demais...).
+var ErrNotAnalyzable = errors.New("condition is not statically analyzable")
+
+// maxTerms limita a explosão da expansão em DNF; acima disso a analise desiste.
+const maxTerms = 256
+
+type DomainKind int
+
+const (
+	KindNumber DomainKind = iota + 1
+	KindString
+	KindBool
+)
+
+// Domain é o conjunto de valores que uma variavel pode assumir dentro de um termo.
+// Number: intervalo [Lo,Hi] (com bordas abertas/fechadas) menos os pontos em NotEq.
+// String: In (nil = qualquer valor) menos NotIn.
+// Bool: AllowTrue/AllowFalse.
+type Domain struct {
+	Kind DomainKind
+
+	Lo, Hi         float64
+	LoIncl, HiIncl bool
+	NotEq          []float64
+
+	In    []string
+	NotIn []string
+
+	AllowTrue, AllowFalse bool
+}
+
+// Term é um AND de restrições por variavel.
+type Term map[string]Domain
+
+// DNF é um OR de termos. DNF vazia nunca é verdadeira; DNF{Term{}} é sempre verdadeira.
+type DNF []Term
+
+// Constraints converte a cond em DNF de restrições por variavel.
+// Cond vazia é sempre verdadeira. Das opções só WithConstants vale aqui (constante entra como literal).
+func Constraints(cond string, opts ...CompileOption) (DNF, error) {
+	cond = strings.TrimSpace(cond)
+	if cond == "" {
+		return DNF{Term{}}, nil
+	}
+
+	tree, err := parser.Parse(cond)
+	if err != nil {
+		return nil, err
+	}
+	var cfg compileConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	inlineConsts(&tree.Node, cfg.consts)
+	return toDNF(tree.Node, false)
+}
+
+// Satisfiable diz se existe alguma entrada que torna a DNF verdadeira.
+func (d DNF) Satisfiable() bool {
+	return len(d) > 0
+}
+
+// And devolve a interseção de duas DNFs.
+func (d DNF) And(other DNF) (DNF, error) {
+	out := make(DNF, 0, len(d)*len(other))
+	for _, a := range d {
+		for _, b := range other {
+			t, ok, err := a.intersect(b)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			out = append(out, t)
+			if len(out) > maxTerms {
+				return nil, ErrNotAnalyzable
+			}
+		}
+	}
+	return out, nil
+}
+
+// Or devolve a união de duas DNFs.
+func (d DNF) Or(other DNF) (DNF, error) {
+	if len(d)+len(other) > maxTerms {
+		return nil, ErrNotAnalyzable
+	}
+	out := make(DNF, 0, len(d)+len(other))
+	out = append(out, d...)
+	return append(out, other...), nil
+}
+
+// Not devolve o complemento da DNF (De Morgan + complemento de cada dominio).
+func (d DNF) Not() (DNF, error) {
+	out := DNF{Term{}}
+	for _, t := range d {
+		neg, err := t.not()
+		if err != nil {
+			return nil, err
+		}
+		out, err = out.And(neg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// String renderiza a DNF de forma legivel, ex: "age < 18 || age >= 18 && score <= 700".
+func (d DNF) String() string {
+	if len(d) == 0 {
+		return "false"
+	}
+	parts := make([]string, 0, len(d))
+	for _, t := range d {
+		parts = append(parts, t.String())
+	}
+	return strings.Join(parts, " || ")
+}
+
+func (t Term) String() string {
+	if len(t) == 0 {
+		return "true"
+	}
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, t[name].describe(name))
+	}
+	return strings.Join(parts, " && ")
+}
+
+func (t Term) intersect(other Term) (Term, bool, error) {
+	out := make(Term, len(t)+len(other))
+	for name, d := range t {
+		out[name] = d
+	}
+	for name, d := range other {
+		cur, ok := out[name]
+		if !ok {
+			out[name] = d
+			continue
+		}
+		merged, err := cur.intersect(d)
+		if err != nil {
+			return nil, false, err
+		}
+		if merged.empty() {
+			return nil, false, nil
+		}
+		out[name] = merged
+	}
+	return out, true, nil
+}
+
+func (t Term) not() (DNF, error) {
+	if len(t) == 0 {
+		return DNF{}, nil
+	}
+	out := make(DNF, 0, len(t))
+	for name, d := range t {
+		for _, c := range d.complement() {
+			out = append(out, Term{name: c})
+		}
+	}
+	return out, nil
+}
+
+func toDNF(node ast.Node, negated bool) (DNF, error) {
+	switch n := node.(type) {
+	case *ast.BoolNode:
+		if n.Value != negated {
+			return DNF{Term{}}, nil
+		}
+		return DNF{}, nil
+
+	case *ast.IdentifierNode:
+		return atomDNF(n.Value, Domain{Kind: KindBool, AllowTrue: true}, negated), nil
+
+	case *ast.UnaryNode:
+		switch n.Operator {
+		case "!", "not":
+			return toDNF(n.Node, !negated)
+		}
+
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "&&", "and", "||", "or":
+			left, err := toDNF(n.Left, negated)
+			if err != nil {
+				return nil, err
+			}
+			right, err := toDNF(n.Right, negated)
+			if err != nil {
+				return nil, err
+			}
+			isAnd := n.Operator == "&&" || n.Operator == "and"
+			// De Morgan: negado, AND vira OR e vice-versa.
+			if isAnd != negated {
+				return left.And(right)
+			}
+			return left.Or(right)
+
+		case "==", "!=", "<", "<=", ">", ">=":
+			name, d, err := comparisonDomain(n)
+			if err != nil {
+				return nil, err
+			}
+			return atomDNF(name, d, negated), nil
+		}
+	}
+
+	return nil, ErrNotAnalyzable
+}
+
+func atomDNF(name string, d Domain, negated bool) DNF {
+	if !negated {
+		return DNF{Term{name: d}}
+	}
+	out := DNF{}
+	for _, c := range d.complement() {
+		out = append(out, Term{name: c})
+	}
+	return out
+}
+
+// comparisonDomain entende "var op literal" e "literal op var".
+func comparisonDomain(n *ast.BinaryNode) (string, Domain, error) {
+	op := n.Operator
+	ident, ok := n.Left.(*ast.IdentifierNode)
+	lit := n.Right
+	if !ok {
+		ident, ok = n.Right.(*ast.IdentifierNode)
+		if !ok {
+			return "", Domain{}, ErrNotAnalyzable
+		}
+		lit = n.Left
+		op = flipOp(op)
+	}
+
+	switch v := lit.(type) {
+	case *ast.IntegerNode:
+		return ident.Value, numberDomain(op, float64(v.Value)), nil
+	case *ast.FloatNode:
+		return ident.Value, numberDomain(op, v.Value), nil
+	case *ast.StringNode:
+		switch op {
+		case "==":
+			return ident.Value, Domain{Kind: KindString, In: []string{v.Value}}, nil
+		case "!=":
+			return ident.Value, Domain{Kind: KindString, NotIn: []string{v.Value}}, nil
+		}
+	case *ast.BoolNode:
+		switch op {
+		case "==":
+			return ident.Value, Domain{Kind: KindBool, AllowTrue: v.Value, AllowFalse: !v.Value}, nil
+		case "!=":
+			return ident.Value, Domain{Kind: KindBool, AllowTrue: !v.Value, AllowFalse: v.Value}, nil
+		}
+	}
+
+	return "", Domain{}, ErrNotAnalyzable
+}
+
+func flipOp(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+func numberDomain(op string, v float64) Domain {
+	d := Domain{Kind: KindNumber, Lo: math.Inf(-1), Hi: math.Inf(1)}
+	switch op {
+	case "==":
+		d.Lo, d.Hi, d.LoIncl, d.HiIncl = v, v, true, true
+	case "!=":
+		d.NotEq = []float64{v}
+	case "<":
+		d.Hi = v
+	case "<=":
+		d.Hi, d.HiIncl = v, true
+	case ">":
+		d.Lo = v
+	case ">=":
+		d.Lo, d.LoIncl = v, true
+	}
+	return d
+}
+
+func (d Domain) intersect(o Domain) (Domain, error) {
+	if d.Kind != o.Kind {
+		return Domain{}, ErrNotAnalyzable
+	}
+
+	switch d.Kind {
+	case KindNumber:
+		out := d
+		if o.Lo > out.Lo || (o.Lo == out.Lo && !o.LoIncl) {
+			out.Lo, out.LoIncl = o.Lo, o.LoIncl
+		}
+		if o.Hi < out.Hi || (o.Hi == out.Hi && !o.HiIncl) {
+			out.Hi, out.HiIncl = o.Hi, o.HiIncl
+		}
+		out.NotEq = append(append([]float64{}, d.NotEq...), o.NotEq...)
+		return out, nil
+
+	case KindString:
+		out := Domain{Kind: KindString}
+		out.NotIn = append(append([]string{}, d.NotIn...), o.NotIn...)
+		switch {
+		case d.In == nil:
+			out.In = o.In
+		case o.In == nil:
+			out.In = d.In
+		default:
+			out.In = []string{}
+			for _, v := range d.In {
+				if containsString(o.In, v) {
+					out.In = append(out.In, v)
+				}
+			}
+		}
+		return out, nil
+
+	default:
+		return Domain{
+			Kind:       KindBool,
+			AllowTrue:  d.AllowTrue && o.AllowTrue,
+			AllowFalse: d.AllowFalse && o.AllowFalse,
+		}, nil
+	}
+}
+
+func (d Domain) empty() bool {
+	switch d.Kind {
+	case KindNumber:
+		if d.Lo > d.Hi {
+			return true
+		}
+		if d.Lo == d.Hi {
+			if !d.LoIncl || !d.HiIncl {
+				return true
+			}
+			return containsFloat(d.NotEq, d.Lo)
+		}
+		return false
+
+	case KindString:
+		if d.In == nil {
+			return false
+		}
+		for _, v := range d.In {
+			if !containsString(d.NotIn, v) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return !d.AllowTrue && !d.AllowFalse
+	}
+}
+
+// complement devolve o complemento do dominio como uniao de dominios.
+func (d Domain) complement() []Domain {
+	switch d.Kind {
+	case KindNumber:
+		var out []Domain
+		if !math.IsInf(d.Lo, -1) {
+			out = append(out, Domain{Kind: KindNumber, Lo: math.Inf(-1), Hi: d.Lo, HiIncl: !d.LoIncl})
+		}
+		if !math.IsInf(d.Hi, 1) {
+			out = append(out, Domain{Kind: KindNumber, Lo: d.Hi, LoIncl: !d.HiIncl, Hi: math.Inf(1)})
+		}
+		for _, v := range d.NotEq {
+			out = append(out, Domain{Kind: KindNumber, Lo: v, Hi: v, LoIncl: true, HiIncl: true})
+		}
+		return out
+
+	case KindString:
+		var out []Domain
+		if d.In != nil {
+			out = append(out, Domain{Kind: KindString, NotIn: d.In})
+		}
+		if len(d.NotIn) > 0 {
+			out = append(out, Domain{Kind: KindString, In: d.NotIn})
+		}
+		return out
+
+	default:
+		c := Domain{Kind: KindBool, AllowTrue: !d.AllowTrue, AllowFalse: !d.AllowFalse}
+		if c.empty() {
+			return nil
+		}
+		return []Domain{c}
+	}
+}
+
+func (d Domain) describe(name string) string {
+	switch d.Kind {
+	case KindNumber:
+		var parts []string
+		switch {
+		case d.Lo == d.Hi:
+			parts = append(parts, fmt.Sprintf("%s == %s", name, formatNumber(d.Lo)))
+		default:
+			if !math.IsInf(d.Lo, -1) {
+				op := ">"
+				if d.LoIncl {
+					op = ">="
+				}
+				parts = append(parts, fmt.Sprintf("%s %s %s", name, op, formatNumber(d.Lo)))
+			}
+			if !math.IsInf(d.Hi, 1) {
+				op := "<"
+				if d.HiIncl {
+					op = "<="
+				}
+				parts = append(parts, fmt.Sprintf("%s %s %s", name, op, formatNumber(d.Hi)))
+			}
+		}
+		for _, v := range d.NotEq {
+			if v >= d.Lo && v <= d.Hi && d.Lo != d.Hi {
+				parts = append(parts, fmt.Sprintf("%s != %s", name, formatNumber(v)))
+			}
+		}
+		if len(parts) == 0 {
+			return name + " is any number"
+		}
+		return strings.Join(parts, " && ")
+
+	case KindString:
+		var parts []string
+		if d.In != nil {
+			vals := make([]string, 0, len(d.In))
+			for _, v := range d.In {
+				if !containsString(d.NotIn, v) {
+					vals = append(vals, strconv.Quote(v))
+				}
+			}
+			if len(vals) == 1 {
+				return fmt.Sprintf("%s == %s", name, vals[0])
+			}
+			return fmt.Sprintf("%s in [%s]", name, strings.Join(vals, ", "))
+		}
+		for _, v := range d.NotIn {
+			parts = append(parts, fmt.Sprintf("%s != %s", name, strconv.Quote(v)))
+		}
+		if len(parts) == 0 {
+			return name + " is any string"
+		}
+		return strings.Join(parts, " && ")
+
+	default:
+		switch {
+		case d.AllowTrue && !d.AllowFalse:
+			return name + " == true"
+		case d.AllowFalse && !d.AllowTrue:
+			return name + " == false"
+		}
+		return name + " is any bool"
+	}
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func containsString(items []string, v string) bool {
+	for _, it := range items {
+		if it == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFloat(items []float64, v float64) bool {
+	for _, it := range items {
+		if it == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Fix substitui uma variavel de valor já conhecido (ex: gravada por um nó antes da aresta):
+// termo cujo dominio nao aceita o valor cai, e nos que aceitam a variavel sai do termo.
+func (d DNF) Fix(name string, value any) DNF {
+	out := make(DNF, 0, len(d))
+	for _, t := range d {
+		dom, ok := t[name]
+		if !ok {
+			out = append(out, t)
+			continue
+		}
+		if !dom.Contains(value) {
+			continue
+		}
+		rest := make(Term, len(t)-1)
+		for k, v := range t {
+			if k != name {
+				rest[k] = v
+			}
+		}
+		out = append(out, rest)
+	}
+	return out
+}
+
+// Contains diz se o valor está no dominio (tipo errado nunca está).
+func (d Domain) Contains(value any) bool {
+	switch d.Kind {
+	case KindNumber:
+		v, ok := Number(value)
+		if !ok || containsFloat(d.NotEq, v) {
+			return false
+		}
+		if v < d.Lo || (v == d.Lo && !d.LoIncl && !math.IsInf(d.Lo, -1)) {
+			return false
+		}
+		if v > d.Hi || (v == d.Hi && !d.HiIncl && !math.IsInf(d.Hi, 1)) {
+			return false
+		}
+		return true
+
+	case KindString:
+		v, ok := value.(string)
+		if !ok || containsString(d.NotIn, v) {
+			return false
+		}
+		return d.In == nil || containsString(d.In, v)
+
+	default:
+		v, ok := value.(bool)
+		if !ok {
+			return false
+		}
+		return (v && d.AllowTrue) || (!v && d.AllowFalse)
+	}
+}
+
+// Closest devolve o valor do dominio mais perto de current: o próprio current se já está dentro,
+// a borda do intervalo (um passo pra dentro quando a borda é aberta) ou o primeiro valor aceito.
+// ok=false quando nao dá pra sugerir um valor concreto (ex: string que só precisa ser diferente de X).
+func (d Domain) Closest(current any) (any, bool) {
+	if d.Contains(current) {
+		return current, true
+	}
+	switch d.Kind {
+	case KindNumber:
+		c, isNum := Number(current)
+		interval := d
+		interval.NotEq = nil
+		candidate, dir := 0.0, 1.0
+		switch {
+		case isNum && interval.Contains(c):
+			candidate = c // só caiu num ponto proibido (!=): anda pro lado
+		case !math.IsInf(d.Lo, -1) && (!isNum || c <= d.Lo):
+			candidate = d.Lo
+			if !d.LoIncl {
+				candidate = stepInto(d, d.Lo, 1)
+			}
+		case !math.IsInf(d.Hi, 1):
+			candidate, dir = d.Hi, -1
+			if !d.HiIncl {
+				candidate = stepInto(d, d.Hi, -1)
+			}
+		}
+		for range 8 {
+			if d.Contains(candidate) {
+				return candidate, true
+			}
+			candidate = stepInto(d, candidate, dir)
+		}
+		return nil, false
+
+	case KindString:
+		for _, v := range d.In {
+			if !containsString(d.NotIn, v) {
+				return v, true
+			}
+		}
+		return nil, false
+
+	default:
+		if d.AllowTrue {
+			return true, true
+		}
+		if d.AllowFalse {
+			return false, true
+		}
+		return nil, false
+	}
+}
+
+// stepInto anda um passo a partir de v: inteiro se v é inteiro e o passo cabe no dominio, senão o menor float seguinte.
+func stepInto(d Domain, v float64, dir float64) float64 {
+	if v == math.Trunc(v) && d.Contains(v+dir) {
+		return v + dir
+	}
+	return math.Nextafter(v, v+dir)
+}
+
+// Number converte os tipos numericos que aparecem em vars (int do Go, float64 do JSON...) pra float64.
+func Number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,126 @@
+package eval
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConstraints_ContradictionIsUnsatisfiable(t *testing.T) {
+	dnf, err := Constraints(`age>=18 && age<18`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dnf.Satisfiable() {
+		t.Fatalf("expected unsatisfiable, got %s", dnf)
+	}
+}
+
+func TestConstraints_NegationCoversComplement(t *testing.T) {
+	a, err := Constraints(`age>=18 && score>700`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notA, err := a.Not()
+	if err != nil {
+		t.Fatal(err)
+	}
+	both, err := a.And(notA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if both.Satisfiable() {
+		t.Fatalf("expected a && !a unsatisfiable, got %s", both)
+	}
+
+	gap, err := Constraints(`!(age>=18 && score>700) && age>=18`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gap.String() != "age >= 18 && score <= 700" {
+		t.Fatalf("unexpected gap: %s", gap)
+	}
+}
+
+func TestConstraints_StringsAndBools(t *testing.T) {
+	dnf, err := Constraints(`segment=="prime" && segment!="prime"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dnf.Satisfiable() {
+		t.Fatalf("expected unsatisfiable, got %s", dnf)
+	}
+
+	dnf, err = Constraints(`approved && approved==false`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dnf.Satisfiable() {
+		t.Fatalf("expected unsatisfiable, got %s", dnf)
+	}
+}
+
+func TestConstraints_VariableComparisonNotAnalyzable(t *testing.T) {
+	_, err := Constraints(`income > debt`)
+	if !errors.Is(err, ErrNotAnalyzable) {
+		t.Fatalf("expected ErrNotAnalyzable, got %v", err)
+	}
+}
+
+func TestConstraints_WithConstants(t *testing.T) {
+	consts := WithConstants(map[string]any{"min_score": 700})
+	a, err := Constraints("score > min_score", consts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Constraints("score < 600", consts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	both, err := a.And(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if both.Satisfiable() {
+		t.Fatalf("expected contradiction after inlining, got %s", both)
+	}
+}
+
+func TestDomain_ClosestStepsIntoOpenBounds(t *testing.T) {
+	dnf, err := Constraints(`score > 700 && age >= 18 && segment == "prime" && vip`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	term := dnf[0]
+	cases := []struct {
+		name    string
+		current any
+		want    any
+	}{
+		{"score", 650.0, 701.0},
+		{"score", 720.0, 720.0},
+		{"age", nil, 18.0},
+		{"segment", "retail", "prime"},
+		{"vip", false, true},
+	}
+	for _, tc := range cases {
+		got, ok := term[tc.name].Closest(tc.current)
+		if !ok || got != tc.want {
+			t.Fatalf("%s: expected %v, got %v (ok=%v)", tc.name, tc.want, got, ok)
+		}
+	}
+
+	if _, ok := (Domain{Kind: KindString, NotIn: []string{"x"}}).Closest("x"); ok {
+		t.Fatalf("string that only needs to differ has no concrete suggestion")
+	}
+}
+
+func TestDNF_FixDropsTermsThatRejectTheValue(t *testing.T) {
+	dnf, err := Constraints(`risk == "low" && score > 700 || risk == "high" && score > 500`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixed := dnf.Fix("risk", "high")
+	if fixed.String() != "score > 500" {
+		t.Fatalf("unexpected fixed dnf: %s", fixed)
+	}
+}
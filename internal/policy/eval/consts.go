@@ -0,0 +1,101 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr/ast"
+)
+
+// WithConstants declara constantes da policy (const_min_score=700, list_blocked_states="NY,CA").
+// O identificador vira literal dentro do programa compilado, entao nao é lido do input no runtime
+// e a checagem de tipo/analise estatica enxergam o valor. Valores aceitos: int, float64, string, bool e []any deles.
+func WithConstants(consts map[string]any) CompileOption {
+	return func(c *compileConfig) {
+		c.consts = consts
+	}
+}
+
+// constInliner troca cada identificador que é constante pelo literal equivalente.
+type constInliner struct {
+	consts map[string]any
+}
+
+func (v constInliner) Visit(node *ast.Node) {
+	ident, ok := (*node).(*ast.IdentifierNode)
+	if !ok {
+		return
+	}
+	value, ok := v.consts[ident.Value]
+	if !ok {
+		return
+	}
+	if lit := literalNode(value); lit != nil {
+		ast.Patch(node, lit)
+	}
+}
+
+func literalNode(v any) ast.Node {
+	switch val := v.(type) {
+	case int:
+		return &ast.IntegerNode{Value: val}
+	case float64:
+		return &ast.FloatNode{Value: val}
+	case string:
+		return &ast.StringNode{Value: val}
+	case bool:
+		return &ast.BoolNode{Value: val}
+	case []any:
+		items := make([]ast.Node, 0, len(val))
+		for _, it := range val {
+			lit := literalNode(it)
+			if lit == nil {
+				return nil
+			}
+			items = append(items, lit)
+		}
+		return &ast.ArrayNode{Nodes: items}
+	}
+	return nil
+}
+
+// inlineConsts aplica o constInliner na arvore inteira (usado pelo Constraints, que nao passa pelo expr.Compile).
+func inlineConsts(node *ast.Node, consts map[string]any) {
+	if len(consts) == 0 {
+		return
+	}
+	ast.Walk(node, constInliner{consts: consts})
+}
+
+// withoutConsts tira as constantes da lista de variaveis lidas do input.
+func withoutConsts(vars []string, consts map[string]any) []string {
+	if len(consts) == 0 {
+		return vars
+	}
+	out := make([]string, 0, len(vars))
+	for _, name := range vars {
+		if _, ok := consts[name]; !ok {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func constSignature(consts map[string]any) string {
+	if len(consts) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(consts))
+	for name := range consts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("\x00const")
+	for _, name := range names {
+		fmt.Fprintf(&b, "\x00%s=%#v", name, consts[name])
+	}
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package eval
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"sort"
@@ -20,19 +21,45 @@ type MissingVariablesError struct {
 	Vars []string
 }
 
+// Vars devolve as variaveis que a cond lê do input, ordenadas.
+func (c *Compiled) Vars() []string { return c.vars }
+
 func (e *MissingVariablesError) Error() string {
 	return fmt.Sprintf("missing variables: %s", strings.Join(e.Vars, ", "))
 }
 
 var compileCache sync.Map
 
-func Compile(cond string) (*Compiled, error) {
+type compileConfig struct {
+	types  map[string]string
+	consts map[string]any
+}
+
+type CompileOption func(*compileConfig)
+
+// WithVarTypes declara o tipo das variaveis (string, number, int, bool, list, object; any = sem checagem).
+// Com isso o expr faz checagem de tipo no compile (ex: age >= "eighteen" vira erro).
+// Variavel que nao está no mapa continua liberada, sem tipo.
+func WithVarTypes(types map[string]string) CompileOption {
+	return func(c *compileConfig) {
+		c.types = types
+	}
+}
+
+func Compile(cond string, opts ...CompileOption) (*Compiled, error) {
 	cond = strings.TrimSpace(cond)
 	if cond == "" {
 		return &Compiled{}, nil
 	}
 
-	if cached, ok := compileCache.Load(cond); ok {
+	var cfg compileConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	env := typeEnv(cfg.types)
+	key := cond + envSignature(env) + constSignature(cfg.consts)
+
+	if cached, ok := compileCache.Load(key); ok {
 		return cached.(*Compiled), nil
 	}
 
@@ -40,19 +67,79 @@ func Compile(cond string) (*Compiled, error) {
 		return nil, err
 	}
 
-	program, err := expr.Compile(cond, expr.AsBool(), expr.AllowUndefinedVariables())
+	// Env liga o modo estrito do expr, por isso vem antes do AllowUndefinedVariables.
+	var exprOpts []expr.Option
+	if len(env) > 0 {
+		exprOpts = append(exprOpts, expr.Env(env))
+	}
+	if len(cfg.consts) > 0 {
+		exprOpts = append(exprOpts, expr.Patch(constInliner{consts: cfg.consts}))
+	}
+	exprOpts = append(exprOpts, expr.AsBool(), expr.AllowUndefinedVariables())
+	program, err := expr.Compile(cond, exprOpts...)
 	if err != nil {
+		if len(env) > 0 {
+			return nil, typeError(err)
+		}
 		return nil, err
 	}
 
 	compiled := &Compiled{
 		program: program,
-		vars:    extractVars(cond),
+		vars:    withoutConsts(withoutKeywords(extractVars(cond)), cfg.consts),
 	}
-	actual, _ := compileCache.LoadOrStore(cond, compiled)
+	actual, _ := compileCache.LoadOrStore(key, compiled)
 	return actual.(*Compiled), nil
 }
 
+// typeEnv monta o env de exemplo que o expr usa pra inferir tipo.
+// int também vira float64 porque input JSON chega como float64.
+func typeEnv(types map[string]string) map[string]any {
+	if len(types) == 0 {
+		return nil
+	}
+	env := make(map[string]any, len(types))
+	for name, typ := range types {
+		switch typ {
+		case "string":
+			env[name] = ""
+		case "number", "int":
+			env[name] = 0.0
+		case "bool":
+			env[name] = false
+		case "list":
+			env[name] = []any{}
+		case "object":
+			env[name] = map[string]any{}
+		}
+	}
+	return env
+}
+
+// typeError limpa o erro de tipo do expr: só a primeira linha (sem o trecho com ^) e float64 vira number.
+func typeError(err error) error {
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	msg = strings.ReplaceAll(msg, "float64", "number")
+	return errors.New(strings.TrimSpace(msg))
+}
+
+func envSignature(env map[string]any) string {
+	if len(env) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "\x00%s:%T", name, env[name])
+	}
+	return b.String()
+}
+
 func Run(compiled *Compiled, vars map[string]any) (bool, error) {
 	if compiled == nil || compiled.program == nil {
 		return true, nil
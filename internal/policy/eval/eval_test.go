@@ -2,6 +2,7 @@ package eval
 
 import (
 	"errors"
+	"strings"
 	"testing"
 )
 
@@ -98,3 +99,59 @@ func TestEval_QuotedStringComparison(t *testing.T) {
 		t.Fatalf("expected true")
 	}
 }
+
+func TestCompile_WithVarTypesRejectsMismatches(t *testing.T) {
+	types := map[string]string{"age": "int", "approved": "bool", "segment": "string"}
+
+	for _, cond := range []string{`age >= "eighteen"`, `approved > 3`, `segment == 1`} {
+		_, err := Compile(cond, WithVarTypes(types))
+		if err == nil || !strings.Contains(err.Error(), "mismatched types") || strings.Contains(err.Error(), "\n") {
+			t.Fatalf("%s: expected single-line type error, got %v", cond, err)
+		}
+	}
+
+	c, err := Compile(`age >= 18 && segment == "prime" && other > 1`, WithVarTypes(types))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := Run(c, map[string]any{"age": 20, "segment": "prime", "other": 2.0})
+	if err != nil || !ok {
+		t.Fatalf("expected true, got %v %v", ok, err)
+	}
+
+	if _, err := Compile(`age >= "eighteen"`); err != nil {
+		t.Fatalf("untyped compile should still accept it, got %v", err)
+	}
+}
+
+func TestCompile_WithConstantsInlinesValues(t *testing.T) {
+	consts := map[string]any{"min_score": 700, "blocked_states": []any{"NY", "CA"}}
+
+	c, err := Compile(`score > min_score && !(state in blocked_states)`, WithConstants(consts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars := c.Vars(); len(vars) != 2 || vars[0] != "score" || vars[1] != "state" {
+		t.Fatalf("constants should not be input vars, got %v", vars)
+	}
+	ok, err := Run(c, map[string]any{"score": 720.0, "state": "TX"})
+	if err != nil || !ok {
+		t.Fatalf("expected true, got %v %v", ok, err)
+	}
+	ok, err = Run(c, map[string]any{"score": 720.0, "state": "NY"})
+	if err != nil || ok {
+		t.Fatalf("expected false for blocked state, got %v %v", ok, err)
+	}
+
+	if _, err := Compile(`score > blocked_states`, WithConstants(consts), WithVarTypes(map[string]string{"score": "number"})); err == nil {
+		t.Fatalf("expected type error comparing number with list constant")
+	}
+
+	other, err := Compile(`score > min_score`, WithConstants(map[string]any{"min_score": 500}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := Run(other, map[string]any{"score": 600.0}); !ok {
+		t.Fatalf("compile cache should key on constant values")
+	}
+}
@@ -0,0 +1,208 @@
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+)
+
+// Explanation é a cond avaliada pedaço por pedaço da AST: os nós and/or/not viram Children e cada
+// comparação (ou valor solto, tipo uma variavel bool) é avaliada sozinha com as variaveis que ela lê.
+// Todos os pedaços sao avaliados, sem curto-circuito, pra mostrar tudo que falhou e nao só o primeiro.
+type Explanation struct {
+	Expr string `json:"expr"`
+	// Kind: and, or, not, compare ou value.
+	Kind string `json:"kind"`
+	// Value é o resultado do pedaço; nil quando faltou variavel ou deu erro (nos and/or/not, quando nao dá pra decidir).
+	Value    any            `json:"value"`
+	Vars     map[string]any `json:"vars,omitempty"`
+	Missing  []string       `json:"missing,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Children []*Explanation `json:"children,omitempty"`
+}
+
+var compareOps = map[string]struct{}{
+	"==": {}, "!=": {}, "<": {}, ">": {}, "<=": {}, ">=": {}, "in": {}, "not in": {},
+	"matches": {}, "contains": {}, "startsWith": {}, "endsWith": {},
+}
+
+// Explain decompõe a cond e avalia cada pedaço contra vars. Das opções só WithConstants vale:
+// constante é lida pelo nome (aparece como constante no texto, nao como variavel lida).
+func Explain(cond string, vars map[string]any, opts ...CompileOption) (*Explanation, error) {
+	cond = strings.TrimSpace(cond)
+	if cond == "" {
+		return &Explanation{Expr: "", Kind: "value", Value: true}, nil
+	}
+	if err := Validate(cond); err != nil {
+		return nil, err
+	}
+	tree, err := parser.Parse(cond)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg compileConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	env := make(map[string]any, len(vars)+len(cfg.consts))
+	for k, v := range vars {
+		env[k] = v
+	}
+	for k, v := range cfg.consts {
+		env[k] = v
+	}
+	x := explainer{env: env, vars: vars, consts: cfg.consts}
+	return x.node(tree.Node), nil
+}
+
+type explainer struct {
+	env    map[string]any
+	vars   map[string]any
+	consts map[string]any
+}
+
+func (x explainer) node(n ast.Node) *Explanation {
+	switch v := n.(type) {
+	case *ast.BinaryNode:
+		switch v.Operator {
+		case "&&", "and":
+			return x.logical("and", n, v.Left, v.Right)
+		case "||", "or":
+			return x.logical("or", n, v.Left, v.Right)
+		}
+		if _, ok := compareOps[v.Operator]; ok {
+			return x.leaf("compare", n)
+		}
+	case *ast.UnaryNode:
+		if v.Operator == "!" || v.Operator == "not" {
+			child := x.node(v.Node)
+			out := &Explanation{Expr: n.String(), Kind: "not", Children: []*Explanation{child}}
+			if b, ok := child.Value.(bool); ok {
+				out.Value = !b
+			}
+			return out
+		}
+	}
+	return x.leaf("value", n)
+}
+
+// logical junta and/or encadeados (a && b && c) num nó só, com lógica de tres valores pro que ficou nil.
+func (x explainer) logical(kind string, n ast.Node, left, right ast.Node) *Explanation {
+	out := &Explanation{Expr: n.String(), Kind: kind}
+	for _, side := range []ast.Node{left, right} {
+		child := x.node(side)
+		if child.Kind == kind {
+			out.Children = append(out.Children, child.Children...)
+			continue
+		}
+		out.Children = append(out.Children, child)
+	}
+
+	decided, unknown := kind == "or", false
+	for _, c := range out.Children {
+		b, ok := c.Value.(bool)
+		switch {
+		case !ok:
+			unknown = true
+		case b == decided:
+			out.Value = decided
+			return out
+		}
+	}
+	if !unknown {
+		out.Value = !decided
+	}
+	return out
+}
+
+func (x explainer) leaf(kind string, n ast.Node) *Explanation {
+	src := n.String()
+	out := &Explanation{Expr: src, Kind: kind}
+	for _, name := range withoutConsts(withoutKeywords(extractVars(src)), x.consts) {
+		value, ok := x.vars[name]
+		if !ok {
+			out.Missing = append(out.Missing, name)
+			continue
+		}
+		if out.Vars == nil {
+			out.Vars = map[string]any{}
+		}
+		out.Vars[name] = value
+	}
+	if len(out.Missing) > 0 {
+		return out
+	}
+	value, err := expr.Eval(src, x.env)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.Value = value
+	return out
+}
+
+// Sentence resume porque a cond deu o que deu, citando só os pedaços que decidiram:
+// and falso cita as partes falsas, or verdadeiro cita as verdadeiras, e assim por diante.
+//
+//	score > 700 was false (score=650)
+func (e *Explanation) Sentence() string {
+	parts := make([]string, 0)
+	for _, leaf := range e.deciding() {
+		parts = append(parts, leaf.phrase())
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (e *Explanation) deciding() []*Explanation {
+	if len(e.Children) == 0 {
+		return []*Explanation{e}
+	}
+	if e.Kind == "not" {
+		return e.Children[0].deciding()
+	}
+
+	var out []*Explanation
+	for _, c := range e.Children {
+		pick := false
+		switch b, ok := e.Value.(bool); {
+		case !ok:
+			pick = c.Value == nil // indecidido: cita o que nao deu pra avaliar
+		case e.Kind == "and" && !b, e.Kind == "or" && b:
+			pick = c.Value == b // quem derrubou (and) ou quem segurou (or)
+		default:
+			pick = true // and verdadeiro / or falso: todas as partes importam
+		}
+		if pick {
+			out = append(out, c.deciding()...)
+		}
+	}
+	return out
+}
+
+func (e *Explanation) phrase() string {
+	switch {
+	case len(e.Missing) > 0:
+		return fmt.Sprintf("%s could not be evaluated (missing %s)", e.Expr, strings.Join(e.Missing, ", "))
+	case e.Error != "":
+		return fmt.Sprintf("%s failed (%s)", e.Expr, e.Error)
+	}
+	s := fmt.Sprintf("%s was %v", e.Expr, e.Value)
+	if len(e.Vars) == 0 {
+		return s
+	}
+	names := make([]string, 0, len(e.Vars))
+	for name := range e.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vals := make([]string, 0, len(names))
+	for _, name := range names {
+		vals = append(vals, fmt.Sprintf("%s=%v", name, e.Vars[name]))
+	}
+	return s + " (" + strings.Join(vals, ", ") + ")"
+}
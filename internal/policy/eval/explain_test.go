@@ -0,0 +1,93 @@
+package eval
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExplain_AndCitesOnlyFailingComparisons(t *testing.T) {
+	vars := map[string]any{"age": 25.0, "score": 650.0, "segment": "retail"}
+
+	ex, err := Explain(`age >= 18 && score > 700 && segment == "prime"`, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Kind != "and" || ex.Value != false || len(ex.Children) != 3 {
+		t.Fatalf("unexpected explanation: %+v", ex)
+	}
+	if ex.Children[0].Value != true || ex.Children[1].Value != false || ex.Children[2].Value != false {
+		t.Fatalf("every comparison should be evaluated (no short-circuit): %+v", ex.Children)
+	}
+	if ex.Children[1].Vars["score"] != 650.0 {
+		t.Fatalf("expected score to be recorded, got %+v", ex.Children[1].Vars)
+	}
+
+	want := `score > 700 was false (score=650); segment == "prime" was false (segment=retail)`
+	if got := ex.Sentence(); got != want {
+		t.Fatalf("sentence mismatch\nwant %s\ngot  %s", want, got)
+	}
+}
+
+func TestExplain_OrAndNot(t *testing.T) {
+	vars := map[string]any{"vip": false, "score": 800.0, "blocked": false}
+
+	ex, err := Explain(`(vip || score > 700) && !blocked`, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Value != true {
+		t.Fatalf("expected true, got %+v", ex)
+	}
+	if ex.Children[0].Kind != "or" || ex.Children[1].Kind != "not" {
+		t.Fatalf("unexpected children: %+v", ex.Children)
+	}
+
+	want := "score > 700 was true (score=800); blocked was false (blocked=false)"
+	if got := ex.Sentence(); got != want {
+		t.Fatalf("sentence mismatch\nwant %s\ngot  %s", want, got)
+	}
+}
+
+func TestExplain_MissingVariableIsUnknown(t *testing.T) {
+	ex, err := Explain(`age >= 18 && score > 700`, map[string]any{"age": 30.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Value != nil {
+		t.Fatalf("expected undecided value, got %v", ex.Value)
+	}
+	if got := ex.Sentence(); got != "score > 700 could not be evaluated (missing score)" {
+		t.Fatalf("unexpected sentence: %s", got)
+	}
+
+	// falso do lado conhecido decide o and mesmo com variavel faltando
+	ex, err = Explain(`age >= 18 && score > 700`, map[string]any{"age": 10.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Value != false {
+		t.Fatalf("expected false, got %v", ex.Value)
+	}
+}
+
+func TestExplain_ConstantsAreNotReportedAsVars(t *testing.T) {
+	ex, err := Explain(`score > MIN_SCORE`, map[string]any{"score": 650.0}, WithConstants(map[string]any{"MIN_SCORE": 700.0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Value != false || len(ex.Missing) != 0 {
+		t.Fatalf("unexpected explanation: %+v", ex)
+	}
+	if got := ex.Sentence(); got != "score > MIN_SCORE was false (score=650)" {
+		t.Fatalf("unexpected sentence: %s", got)
+	}
+
+	raw, err := json.Marshal(ex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `"kind":"compare","value":false,"vars":{"score":650}}`) {
+		t.Fatalf("unexpected json: %s", raw)
+	}
+}
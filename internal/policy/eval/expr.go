@@ -0,0 +1,191 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// CompiledExpr é uma expressão de valor do result (ex: $(income*3)).
+// Diferente da cond, aqui aritmetica é liberada; o resto das restrições continua.
+type CompiledExpr struct {
+	src     string
+	program *vm.Program
+	vars    []string
+}
+
+// exprKeywords sao operadores em palavra do expr, que nao sao variavel nem chamada de função.
+var exprKeywords = map[string]struct{}{
+	"and": {}, "or": {}, "not": {}, "in": {}, "nil": {},
+}
+
+// CompileExpr aceita as mesmas opções do Compile (WithVarTypes, WithConstants).
+func CompileExpr(src string, opts ...CompileOption) (*CompiledExpr, error) {
+	src = strings.TrimSpace(src)
+	if src == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	if err := ValidateExpr(src); err != nil {
+		return nil, err
+	}
+
+	var cfg compileConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	env := typeEnv(cfg.types)
+
+	var exprOpts []expr.Option
+	if len(env) > 0 {
+		exprOpts = append(exprOpts, expr.Env(env))
+	}
+	if len(cfg.consts) > 0 {
+		exprOpts = append(exprOpts, expr.Patch(constInliner{consts: cfg.consts}))
+	}
+	exprOpts = append(exprOpts, expr.AllowUndefinedVariables())
+	program, err := expr.Compile(src, exprOpts...)
+	if err != nil {
+		if len(env) > 0 {
+			return nil, typeError(err)
+		}
+		return nil, err
+	}
+	if t := program.Node().Type(); t != nil && !isJSONType(t) {
+		return nil, fmt.Errorf("expression must yield a JSON value (got %s)", t)
+	}
+
+	return &CompiledExpr{src: src, program: program, vars: withoutConsts(withoutKeywords(extractVars(src)), cfg.consts)}, nil
+}
+
+// withoutKeywords tira and/or/not/in/nil da lista de identificadores (nao sao variavel).
+func withoutKeywords(names []string) []string {
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, kw := exprKeywords[name]; !kw {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// Source devolve o texto da expressão (sem o $( )).
+func (c *CompiledExpr) Source() string { return c.src }
+
+// Vars devolve as variaveis referenciadas, ordenadas.
+func (c *CompiledExpr) Vars() []string { return c.vars }
+
+// Run avalia a expressão e garante que o valor cabe no output JSON.
+func (c *CompiledExpr) Run(vars map[string]any) (any, error) {
+	missing := missingVars(c.vars, vars)
+	if len(missing) > 0 {
+		return nil, &MissingVariablesError{Vars: missing}
+	}
+
+	out, err := expr.Run(c.program, vars)
+	if err != nil {
+		return nil, err
+	}
+	return jsonValue(out)
+}
+
+// ValidateExpr é o Validate das expressões de valor: libera + - * / % e float literal,
+// mas continua barrando chamada de função, indexação, member access e afins.
+func ValidateExpr(src string) error {
+	bare := stripQuoted(src)
+
+	illegalChars := []rune{'{', '}', '[', ']', ';', '@', '#', '$', '\\'}
+	for _, ch := range illegalChars {
+		if strings.ContainsRune(bare, ch) {
+			return fmt.Errorf("illegal character %q", ch)
+		}
+	}
+
+	for i := 0; i < len(bare); i++ {
+		if bare[i] != '.' {
+			continue
+		}
+		prevDigit := i > 0 && unicode.IsDigit(rune(bare[i-1]))
+		nextDigit := i+1 < len(bare) && unicode.IsDigit(rune(bare[i+1]))
+		if !prevDigit || !nextDigit {
+			return fmt.Errorf("dot access is not allowed")
+		}
+	}
+
+	for i := 0; i < len(bare); i++ {
+		if bare[i] != '(' {
+			continue
+		}
+		j := i - 1
+		for j >= 0 && unicode.IsSpace(rune(bare[j])) {
+			j--
+		}
+		k := j
+		for k >= 0 && (unicode.IsLetter(rune(bare[k])) || unicode.IsDigit(rune(bare[k])) || bare[k] == '_') {
+			k--
+		}
+		ident := bare[k+1 : j+1]
+		if ident == "" || unicode.IsDigit(rune(ident[0])) {
+			continue
+		}
+		if _, kw := exprKeywords[ident]; kw {
+			continue
+		}
+		return fmt.Errorf("function calls are not allowed (found %q(...))", ident)
+	}
+
+	return nil
+}
+
+func isJSONType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface, reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// jsonValue normaliza o resultado pros tipos do result (int, float64, string, bool, nil, []any, map[string]any).
+func jsonValue(v any) (any, error) {
+	switch val := v.(type) {
+	case nil, bool, string, int:
+		return val, nil
+	case int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return int(reflect.ValueOf(val).Convert(reflect.TypeOf(0)).Int()), nil
+	case float32:
+		return jsonValue(float64(val))
+	case float64:
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return nil, fmt.Errorf("expression yielded non-finite number %v", val)
+		}
+		return val, nil
+	case []any:
+		out := make([]any, len(val))
+		for i, it := range val {
+			n, err := jsonValue(it)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = n
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, it := range val {
+			n, err := jsonValue(it)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = n
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("expression yielded non-JSON value of type %T", v)
+}
@@ -0,0 +1,83 @@
+package eval
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCompileExpr_ArithmeticAndTypes(t *testing.T) {
+	cases := []struct {
+		src  string
+		want any
+	}{
+		{"income * 3", 3000},
+		{"income / 4", 250.0},
+		{"income * 1.5 - 100", 1400.0},
+		{`segment == "prime" ? "gold" : "silver"`, "gold"},
+		{"score > 700 and not blocked", true},
+		{"segment", "prime"},
+	}
+	vars := map[string]any{"income": 1000, "segment": "prime", "score": 720, "blocked": false}
+
+	for _, tc := range cases {
+		c, err := CompileExpr(tc.src)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.src, err)
+		}
+		got, err := c.Run(vars)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.src, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: expected %#v, got %#v", tc.src, tc.want, got)
+		}
+	}
+}
+
+func TestCompileExpr_RejectsUnsafeForms(t *testing.T) {
+	cases := map[string]string{
+		"len(name)":    "function calls",
+		"user.name":    "dot access",
+		"tags[0]":      "illegal character",
+		"{a: 1}":       "illegal character",
+		"":             "empty expression",
+		"income * * 2": "",
+	}
+	for src, want := range cases {
+		_, err := CompileExpr(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestCompiledExpr_RunErrors(t *testing.T) {
+	c, err := CompileExpr("income * 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Run(map[string]any{})
+	var mvErr *MissingVariablesError
+	if !errors.As(err, &mvErr) || mvErr.Vars[0] != "income" {
+		t.Fatalf("expected missing income, got %v", err)
+	}
+
+	c, err = CompileExpr("income / zero")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Run(map[string]any{"income": 1, "zero": 0})
+	if err == nil || !strings.Contains(err.Error(), "non-finite") {
+		t.Fatalf("expected non-finite error, got %v", err)
+	}
+
+	c, err = CompileExpr("profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Run(map[string]any{"profile": struct{}{}})
+	if err == nil || !strings.Contains(err.Error(), "non-JSON") {
+		t.Fatalf("expected non-JSON error, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+)
+
+// WithExplain liga o modo explain em toda execução com trace (ver ContextWithExplain pra ligar por request).
+func WithExplain() EngineOption {
+	return func(e *Engine) {
+		e.explain = true
+	}
+}
+
+type explainKey struct{}
+
+// ContextWithExplain liga o modo explain só nas execuções com esse ctx (flag do request): cada aresta
+// avaliada ganha no trace a cond quebrada por comparação (valor de cada pedaço e as variaveis que ele leu)
+// e uma frase curta dizendo porque foi ou nao foi seguida. Sem trace nao faz nada.
+func ContextWithExplain(ctx context.Context) context.Context {
+	return context.WithValue(ctx, explainKey{}, true)
+}
+
+func explainFrom(ctx context.Context) bool {
+	on, _ := ctx.Value(explainKey{}).(bool)
+	return on
+}
+
+// explainEdges preenche Explain/Why das arestas já avaliadas do nó. Roda antes do fan-out/próximo nó,
+// entao vars ainda é o estado que as conds viram.
+func explainEdges(p *Policy, from string, edges []EdgeTrace, vars map[string]any) {
+	for i := range edges {
+		et := &edges[i]
+		verdict := "not taken"
+		switch {
+		case et.Matched:
+			verdict = "taken"
+		case et.AlsoMatched:
+			verdict = "would also match"
+		}
+		if et.Cond == "" {
+			if et.Default {
+				et.Why = fmt.Sprintf("%s -> %s %s: default edge", from, et.To, verdict)
+			}
+			continue
+		}
+
+		ex, err := eval.Explain(et.Cond, vars, eval.WithConstants(p.Constants))
+		if err != nil {
+			et.Why = fmt.Sprintf("%s -> %s %s: %v", from, et.To, verdict, err)
+			continue
+		}
+		et.Explain = ex
+		et.Why = fmt.Sprintf("%s -> %s %s: %s", from, et.To, verdict, ex.Sentence())
+	}
+}
+
+// Explanations junta as frases (Why) das arestas avaliadas no caminho, em ordem de execução,
+// descendo nas sub-policies e nos branches de fan-out.
+func (t *ExecutionTrace) Explanations() []string {
+	if t == nil {
+		return nil
+	}
+	var out []string
+	for _, step := range t.Steps {
+		if step.Call != nil {
+			out = append(out, step.Call.Trace.Explanations()...)
+		}
+		for _, edge := range step.Edges {
+			if edge.Why != "" {
+				out = append(out, edge.Why)
+			}
+		}
+		if step.Fanout != nil {
+			for _, b := range step.Fanout.Branches {
+				out = append(out, b.Trace.Explanations()...)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,337 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MergeStrategy é como o join junta os branches de um fan-out:
+//
+//	checks [fanout="checks_done"];        // toda aresta que casa vira um branch
+//	checks -> device; checks -> velocity [cond="amount > 1000"]; checks -> sanctions;
+//	device -> checks_done; velocity -> checks_done; sanctions -> checks_done;
+//	checks_done [join="all", result="checked=true"];
+//
+// Cada branch roda em paralelo numa cópia das vars até chegar no join; o que ele gravou/removeu
+// volta pro estado principal conforme a estratégia, e a execução segue pelo join.
+type MergeStrategy string
+
+const (
+	// MergeAll exige todos os branches sem erro; junta tudo na ordem das arestas (o ultimo ganha).
+	MergeAll MergeStrategy = "all"
+	// MergeAny aceita branch com erro enquanto pelo menos um terminar; junta só os que terminaram.
+	MergeAny MergeStrategy = "any"
+	// MergeFirst usa só o primeiro branch que terminou, na ordem das arestas (nao na de chegada).
+	MergeFirst MergeStrategy = "first"
+	// MergeConflictError é o MergeAll, mas dois branches gravando valores diferentes no mesmo caminho é erro.
+	MergeConflictError MergeStrategy = "conflict-error"
+)
+
+func (m MergeStrategy) valid() bool {
+	switch m {
+	case MergeAll, MergeAny, MergeFirst, MergeConflictError:
+		return true
+	}
+	return false
+}
+
+// FanoutTrace é o fan-out de um nó: um BranchTrace por aresta que casou, na ordem das arestas.
+type FanoutTrace struct {
+	Join      string        `json:"join"`
+	Strategy  string        `json:"strategy"`
+	Branches  []BranchTrace `json:"branches"`
+	Conflicts []string      `json:"conflicts,omitempty"`
+}
+
+// BranchTrace é um branch do fan-out; Merged diz se o que ele gravou entrou no estado principal.
+type BranchTrace struct {
+	To     string          `json:"to"`
+	Merged bool            `json:"merged"`
+	Error  string          `json:"error,omitempty"`
+	Trace  *ExecutionTrace `json:"trace,omitempty"`
+}
+
+// mergeConflictError é o conflito do join="conflict-error".
+type mergeConflictError struct {
+	conflicts []string
+}
+
+func (e *mergeConflictError) Error() string {
+	return "merge conflict: " + strings.Join(e.conflicts, "; ")
+}
+
+// fanoutTermination escolhe o terminated do trace quando o fan-out falha.
+func fanoutTermination(err error) string {
+	var conflict *mergeConflictError
+	switch {
+	case isContextErr(err):
+		return contextTermination(err)
+	case errors.As(err, &conflict):
+		return "error_merge_conflict"
+	}
+	return "error_fanout"
+}
+
+type branchResult struct {
+	to    string
+	vars  map[string]any
+	trace *ExecutionTrace
+	err   error
+}
+
+// runFanout roda um branch por alvo (em paralelo, cada um com a sua cópia das vars) até o join do nó
+// e aplica o merge em vars. O map é copy-on-write (applyAssignment/unsetPath copiam o nível que mexem),
+// entao a cópia rasa basta pra um branch nao enxergar o outro.
+func (e *Engine) runFanout(ctx context.Context, p *Policy, node *Node, targets []string, vars map[string]any, record, evaluateAll bool) (*FanoutTrace, error) {
+	join := p.Nodes[node.Fanout]
+	if join == nil {
+		return nil, fmt.Errorf("unknown join node %q", node.Fanout)
+	}
+
+	results := make([]branchResult, len(targets))
+	var wg sync.WaitGroup
+	for i, to := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var trace *ExecutionTrace
+			if record {
+				trace = &ExecutionTrace{StartNode: to}
+			}
+			branchVars := copyMap(vars)
+			trace, err := e.walk(ctx, p, to, node.Fanout, branchVars, trace, evaluateAll)
+			if err == nil {
+				setTermination(trace, "join")
+			}
+			results[i] = branchResult{to: to, vars: branchVars, trace: trace, err: err}
+		}()
+	}
+	wg.Wait()
+
+	var fan *FanoutTrace
+	if record {
+		fan = &FanoutTrace{Join: node.Fanout, Strategy: string(join.Join)}
+		for _, r := range results {
+			bt := BranchTrace{To: r.to, Trace: r.trace}
+			if r.err != nil {
+				bt.Error = r.err.Error()
+			}
+			fan.Branches = append(fan.Branches, bt)
+		}
+	}
+
+	var (
+		selected []int
+		failed   []string
+	)
+	for i, r := range results {
+		if r.err != nil {
+			if isContextErr(r.err) {
+				return fan, fmt.Errorf("branch -> %s: %w", r.to, r.err)
+			}
+			failed = append(failed, fmt.Sprintf("-> %s: %v", r.to, r.err))
+			continue
+		}
+		selected = append(selected, i)
+	}
+
+	switch join.Join {
+	case MergeAny, MergeFirst:
+		if len(selected) == 0 {
+			return fan, fmt.Errorf("all %d branches failed (join %s=%s): %s", len(results), node.Fanout, join.Join, strings.Join(failed, "; "))
+		}
+		if join.Join == MergeFirst {
+			selected = selected[:1]
+		}
+	default:
+		if len(failed) > 0 {
+			return fan, fmt.Errorf("branch failed (join %s=%s): %s", node.Fanout, join.Join, strings.Join(failed, "; "))
+		}
+	}
+
+	changes := make([][]varChange, len(selected))
+	for i, idx := range selected {
+		changes[i] = diffVars(vars, results[idx].vars, nil)
+	}
+	if join.Join == MergeConflictError {
+		names := make([]string, len(selected))
+		for i, idx := range selected {
+			names[i] = results[idx].to
+		}
+		if conflicts := mergeConflicts(names, changes); len(conflicts) > 0 {
+			if fan != nil {
+				fan.Conflicts = conflicts
+			}
+			return fan, &mergeConflictError{conflicts: conflicts}
+		}
+	}
+
+	for i, idx := range selected {
+		for _, c := range changes[i] {
+			if c.unset {
+				unsetPath(vars, c.path)
+				continue
+			}
+			applyAssignment(vars, Assignment{Key: strings.Join(c.path, "."), Path: c.path}, c.value)
+		}
+		if fan != nil {
+			fan.Branches[idx].Merged = true
+		}
+	}
+	return fan, nil
+}
+
+// varChange é uma diferença do branch em relação ao estado antes do fan-out, no nível mais fundo
+// em que o valor ainda é map (checks.device e checks.velocity nao conflitam).
+type varChange struct {
+	path  []string
+	value any
+	unset bool
+}
+
+func diffVars(base, branch map[string]any, prefix []string) []varChange {
+	keys := make([]string, 0, len(branch))
+	for k := range branch {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out []varChange
+	for _, k := range keys {
+		path := append(prefix[:len(prefix):len(prefix)], k)
+		before, existed := base[k]
+		after := branch[k]
+		if existed && reflect.DeepEqual(before, after) {
+			continue
+		}
+		bm, bIsMap := before.(map[string]any)
+		am, aIsMap := after.(map[string]any)
+		if aIsMap && (bIsMap || !existed) {
+			// map novo tambem desce: dois branches criando checks.x e checks.y nao se atropelam
+			nested := diffVars(bm, am, path)
+			if len(nested) == 0 && !existed {
+				nested = []varChange{{path: path, value: map[string]any{}}}
+			}
+			out = append(out, nested...)
+			continue
+		}
+		out = append(out, varChange{path: path, value: after})
+	}
+
+	removed := make([]string, 0)
+	for k := range base {
+		if _, ok := branch[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(removed)
+	for _, k := range removed {
+		out = append(out, varChange{path: append(prefix[:len(prefix):len(prefix)], k), unset: true})
+	}
+	return out
+}
+
+// mergeConflicts acha caminhos que dois branches mudaram de jeitos diferentes
+// (mesmo caminho com valor diferente, ou um caminho dentro do outro).
+func mergeConflicts(names []string, changes [][]varChange) []string {
+	var out []string
+	for i := range changes {
+		for j := i + 1; j < len(changes); j++ {
+			for _, a := range changes[i] {
+				for _, b := range changes[j] {
+					if !pathsOverlap(a.path, b.path) {
+						continue
+					}
+					if len(a.path) == len(b.path) && a.unset == b.unset && reflect.DeepEqual(a.value, b.value) {
+						continue
+					}
+					out = append(out, fmt.Sprintf("branches -> %s and -> %s both change %s", names[i], names[j], strings.Join(shorterPath(a.path, b.path), ".")))
+				}
+			}
+		}
+	}
+	return out
+}
+
+func pathsOverlap(a, b []string) bool {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func shorterPath(a, b []string) []string {
+	if len(b) < len(a) {
+		return b
+	}
+	return a
+}
+
+// validateFanouts confere os nós fanout=... (roda depois do validateAcyclic):
+// o alvo existe e é um join com estratégia valida, e todo caminho a partir de cada filho chega no join
+// antes de uma folha (senão o branch nunca termina).
+func validateFanouts(p *Policy, errs *CompileErrors) {
+	for _, id := range sortedNodeIDs(p) {
+		node := p.Nodes[id]
+		if node.Join != "" && !node.Join.valid() {
+			errs.add(node.Pos, CompileError{Node: id, Attr: "join", Message: fmt.Sprintf("node %s invalid join strategy %q (expected all, any, first or conflict-error)", id, node.Join)})
+		}
+		if node.Fanout == "" {
+			continue
+		}
+		fail := func(format string, args ...any) {
+			errs.add(node.Pos, CompileError{Node: id, Attr: "fanout", Message: fmt.Sprintf(format, args...)})
+		}
+		join, ok := p.Nodes[node.Fanout]
+		switch {
+		case !ok:
+			fail("node %s fanout join %s does not exist", id, node.Fanout)
+			continue
+		case node.Fanout == id:
+			fail("node %s cannot be its own join", id)
+			continue
+		case join.Join == "":
+			fail("node %s fanout target %s is not a join node (missing join=...)", id, node.Fanout)
+			continue
+		case len(node.Outgoing) == 0:
+			fail("node %s has fanout but no outgoing edges", id)
+			continue
+		}
+
+		seen := map[string]bool{}
+		for _, edge := range node.Outgoing {
+			if leaf := leafBeforeJoin(p, edge.To, node.Fanout, seen); leaf != "" {
+				fail("fan-out %s: branch -> %s reaches leaf %s without passing through join %s", id, edge.To, leaf, node.Fanout)
+			}
+		}
+	}
+}
+
+// leafBeforeJoin devolve uma folha alcançável a partir de id sem passar pelo join ("" se nao tem).
+func leafBeforeJoin(p *Policy, id, join string, seen map[string]bool) string {
+	if id == join || seen[id] {
+		return ""
+	}
+	seen[id] = true
+	node := p.Nodes[id]
+	if node == nil {
+		return ""
+	}
+	if len(node.Outgoing) == 0 {
+		return id
+	}
+	for _, edge := range node.Outgoing {
+		if leaf := leafBeforeJoin(p, edge.To, join, seen); leaf != "" {
+			return leaf
+		}
+	}
+	return ""
+}
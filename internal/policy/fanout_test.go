@@ -0,0 +1,200 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const fraudFanoutPolicy = `digraph {
+	start -> checks;
+	checks [fanout="checks_done"];
+	checks -> device;
+	checks -> velocity [cond="amount > 1000"];
+	checks -> sanctions;
+	device [result="checks.device=$(device_score < 50)"];
+	velocity [result="checks.velocity=$(tx_last_hour < 10)"];
+	sanctions [result="checks.sanctions=true,-tmp"];
+	device -> checks_done;
+	velocity -> checks_done;
+	sanctions -> checks_done;
+	checks_done [join="%s", result="checked=true"];
+	checks_done -> approved;
+	approved [result="approved=true"];
+}`
+
+func compileFanout(t *testing.T, strategy string) *Policy {
+	t.Helper()
+	p, err := NewCompiler().Compile(strings.Replace(fraudFanoutPolicy, "%s", strategy, 1))
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	return p
+}
+
+func TestEngine_FanoutRunsMatchingBranchesAndMerges(t *testing.T) {
+	p := compileFanout(t, "all")
+	vars := map[string]any{"amount": 2000, "device_score": 10, "tx_last_hour": 3, "tmp": 1}
+
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, vars)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	checks, ok := vars["checks"].(map[string]any)
+	if !ok || checks["device"] != true || checks["velocity"] != true || checks["sanctions"] != true {
+		t.Fatalf("expected all branch results merged, got %v", vars["checks"])
+	}
+	if _, ok := vars["tmp"]; ok {
+		t.Fatalf("unset in a branch should be merged too")
+	}
+	if vars["checked"] != true || vars["approved"] != true {
+		t.Fatalf("execution should continue from the join, got %v", vars)
+	}
+
+	if got := strings.Join(trace.VisitedPath, ","); got != "start,checks,checks_done,approved" {
+		t.Fatalf("unexpected visited path %s", got)
+	}
+	fan := trace.Steps[1].Fanout
+	if fan == nil || fan.Join != "checks_done" || fan.Strategy != "all" || len(fan.Branches) != 3 {
+		t.Fatalf("unexpected fanout trace: %+v", fan)
+	}
+	for _, b := range fan.Branches {
+		if !b.Merged || b.Trace == nil || b.Trace.Terminated != "join" {
+			t.Fatalf("unexpected branch trace: %+v", b)
+		}
+	}
+	if trace.Steps[1].ChosenNext != "checks_done" {
+		t.Fatalf("fan-out step should point to the join, got %q", trace.Steps[1].ChosenNext)
+	}
+
+	vars = map[string]any{"amount": 10, "device_score": 10, "tx_last_hour": 3}
+	if err := NewEngine(ExprEvaluator{}).Run(p, vars); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vars["checks"].(map[string]any)["velocity"]; ok {
+		t.Fatalf("branch whose cond is false must not run")
+	}
+}
+
+func TestEngine_FanoutStrategies(t *testing.T) {
+	// velocity falha (tx_last_hour ausente), os outros terminam
+	input := func() map[string]any { return map[string]any{"amount": 2000, "device_score": 10} }
+
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(compileFanout(t, "all"), input())
+	if err == nil || trace.Terminated != "error_fanout" || !strings.Contains(err.Error(), "-> velocity") {
+		t.Fatalf("all: expected branch failure, got %v (%s)", err, trace.Terminated)
+	}
+
+	vars := input()
+	trace, err = NewEngine(ExprEvaluator{}).RunWithTrace(compileFanout(t, "any"), vars)
+	if err != nil {
+		t.Fatalf("any: %v", err)
+	}
+	checks := vars["checks"].(map[string]any)
+	if checks["device"] != true || checks["sanctions"] != true || len(checks) != 2 {
+		t.Fatalf("any: expected successful branches merged, got %v", checks)
+	}
+	if b := trace.Steps[1].Fanout.Branches[1]; b.Merged || b.Error == "" {
+		t.Fatalf("any: failed branch should be reported and not merged, got %+v", b)
+	}
+
+	vars = input()
+	if err := NewEngine(ExprEvaluator{}).Run(compileFanout(t, "first"), vars); err != nil {
+		t.Fatalf("first: %v", err)
+	}
+	if checks := vars["checks"].(map[string]any); len(checks) != 1 || checks["device"] != true {
+		t.Fatalf("first: expected only the first branch in edge order, got %v", checks)
+	}
+}
+
+func TestEngine_FanoutConflictError(t *testing.T) {
+	src := `digraph {
+	start [fanout="done"];
+	start -> a;
+	start -> b;
+	a [result="risk='%s',a=true"];
+	b [result="risk='high',b=true"];
+	a -> done;
+	b -> done;
+	done [join="conflict-error"];
+}`
+	p, err := NewCompiler().Compile(strings.Replace(src, "%s", "low", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, map[string]any{})
+	var conflict *mergeConflictError
+	if !errors.As(err, &conflict) || trace.Terminated != "error_merge_conflict" {
+		t.Fatalf("expected merge conflict, got %v (%s)", err, trace.Terminated)
+	}
+	if fan := trace.Steps[0].Fanout; len(fan.Conflicts) != 1 || !strings.Contains(fan.Conflicts[0], "both change risk") {
+		t.Fatalf("unexpected conflicts: %+v", fan.Conflicts)
+	}
+
+	p, err = NewCompiler().Compile(strings.Replace(src, "%s", "high", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]any{}
+	if err := NewEngine(ExprEvaluator{}).Run(p, vars); err != nil {
+		t.Fatalf("same value in both branches is not a conflict: %v", err)
+	}
+	if vars["a"] != true || vars["b"] != true || vars["risk"] != "high" {
+		t.Fatalf("unexpected merge: %v", vars)
+	}
+}
+
+func TestCompiler_FanoutValidation(t *testing.T) {
+	cases := map[string]struct {
+		src  string
+		want string
+	}{
+		"not a join": {
+			src:  `digraph { start [fanout="done"]; start -> a; a -> done; done [result="x=1"]; }`,
+			want: "node start fanout target done is not a join node",
+		},
+		"unknown join": {
+			src:  `digraph { start [fanout="nope"]; start -> a; a [result="x=1"]; }`,
+			want: "node start fanout join nope does not exist",
+		},
+		"invalid strategy": {
+			src:  `digraph { start [fanout="done"]; start -> a; a -> done; done [join="most"]; }`,
+			want: `node done invalid join strategy "most"`,
+		},
+		"branch skips join": {
+			src:  `digraph { start [fanout="done"]; start -> a; start -> b; a -> done; b [result="x=1"]; done [join="all"]; }`,
+			want: "fan-out start: branch -> b reaches leaf b without passing through join done",
+		},
+	}
+	for name, tc := range cases {
+		_, err := NewCompiler().Compile(tc.src)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestFanout_RoundTripsThroughDOTAndJSON(t *testing.T) {
+	p := compileFanout(t, "conflict-error")
+
+	fromDOT, err := NewCompiler().Compile(ToDOT(p))
+	if err != nil {
+		t.Fatalf("recompile DOT: %v\n%s", err, ToDOT(p))
+	}
+	if fromDOT.Hash != p.Hash || fromDOT.Nodes["checks"].Fanout != "checks_done" || fromDOT.Nodes["checks_done"].Join != MergeConflictError {
+		t.Fatalf("fan-out lost in DOT round trip:\n%s", ToDOT(p))
+	}
+
+	doc, err := json.Marshal(ToDocument(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := NewCompiler().CompileJSON(string(doc))
+	if err != nil {
+		t.Fatalf("recompile JSON: %v", err)
+	}
+	if fromJSON.Nodes["checks"].Fanout != "checks_done" || fromJSON.Nodes["checks_done"].Join != MergeConflictError {
+		t.Fatalf("fan-out lost in JSON round trip:\n%s", doc)
+	}
+}
@@ -0,0 +1,254 @@
+package policy
+
+import (
+	"sort"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+)
+
+// maxIntrospectPaths limita a enumeração de caminhos; DAG com muito diamante explode rapido.
+const maxIntrospectPaths = 1000
+
+// InputRequirements é o que a policy lê do input, pra quem chama montar form/validação sem abrir o DOT.
+//
+//   - All: toda variavel que algum caminho pode ler
+//   - Always: lida em todo caminho a partir do Start
+//   - Sometimes: All menos Always (depende de por onde a execução passa)
+//
+// Variavel gravada por um result antes de ser lida nao conta como input daquele caminho;
+// derivada lida numa cond conta como o input que ela usa.
+type InputRequirements struct {
+	All       []string     `json:"all"`
+	Always    []string     `json:"always"`
+	Sometimes []string     `json:"sometimes"`
+	Paths     []PathInputs `json:"paths"`
+	// Truncated indica que a enumeração parou em maxIntrospectPaths; All continua completo, Always é aproximado.
+	Truncated bool        `json:"truncated,omitempty"`
+	Declared  InputSchema `json:"declared,omitempty"`
+}
+
+// PathInputs é um caminho do Start até onde a execução termina (folha ou nó sem aresta casando)
+// e as variaveis de input que ele lê.
+type PathInputs struct {
+	Nodes  []string `json:"nodes"`
+	Inputs []string `json:"inputs"`
+}
+
+// RequiredInputs analisa os caminhos a partir do Start. Num caminho que sai pela aresta i de um nó,
+// as conds das arestas 0..i (ordem efetiva) foram avaliadas, entao todas entram na conta.
+func (p *Policy) RequiredInputs() InputRequirements {
+	w := &inputWalker{p: p, all: map[string]bool{}, derived: derivedInputs(p)}
+	w.walk(p.Start, nil, map[string]bool{}, map[string]bool{})
+
+	req := InputRequirements{
+		All:       sortedSet(w.all),
+		Always:    []string{},
+		Sometimes: []string{},
+		Paths:     w.paths,
+		Truncated: w.truncated,
+		Declared:  p.Inputs,
+	}
+	if req.Paths == nil {
+		req.Paths = []PathInputs{}
+	}
+
+	always := map[string]bool{}
+	for i, path := range w.paths {
+		if i == 0 {
+			for _, name := range path.Inputs {
+				always[name] = true
+			}
+			continue
+		}
+		in := make(map[string]bool, len(path.Inputs))
+		for _, name := range path.Inputs {
+			in[name] = true
+		}
+		for name := range always {
+			if !in[name] {
+				delete(always, name)
+			}
+		}
+	}
+	for _, name := range req.All {
+		if always[name] {
+			req.Always = append(req.Always, name)
+		} else {
+			req.Sometimes = append(req.Sometimes, name)
+		}
+	}
+	return req
+}
+
+type inputWalker struct {
+	p         *Policy
+	all       map[string]bool
+	paths     []PathInputs
+	truncated bool
+	derived   map[string][]string // derivada -> input que ela lê
+
+	// stopAt/arrivals: walker de um branch de fan-out, que para no join e guarda como chegou lá
+	stopAt   string
+	arrivals []branchArrival
+}
+
+// branchArrival é um caminho de um branch até o join: nós do branch, o que leu e o que gravou.
+type branchArrival struct {
+	nodes    []string
+	read     map[string]bool
+	produced map[string]bool
+}
+
+// walk desce em profundidade carregando o caminho, o que já foi lido e o que os results já gravaram.
+// Os mapas sao copiados a cada nó porque cada ramo tem o seu.
+func (w *inputWalker) walk(id string, nodes []string, read, produced map[string]bool) {
+	if len(w.paths)+len(w.arrivals) >= maxIntrospectPaths {
+		w.truncated = true
+		return
+	}
+	if w.stopAt != "" && id == w.stopAt {
+		w.arrivals = append(w.arrivals, branchArrival{nodes: nodes, read: read, produced: produced})
+		return
+	}
+	node := w.p.Nodes[id]
+	if node == nil {
+		return
+	}
+	nodes = append(nodes[:len(nodes):len(nodes)], id)
+	read, produced = copySet(read), copySet(produced)
+
+	if node.Call != nil && node.Call.Policy != nil {
+		// a sub-policy roda inteira aqui: o que ela sempre lê entra no caminho, o resto só no total
+		sub := node.Call.Policy.RequiredInputs()
+		w.read(read, produced, sub.Always)
+		w.read(map[string]bool{}, produced, sub.Sometimes)
+	}
+	for _, a := range node.Result {
+		if a.Expr != nil {
+			w.read(read, produced, a.Expr.Vars())
+		}
+		root := a.path()[0]
+		if a.Op == OpUnset {
+			delete(produced, root)
+			continue
+		}
+		produced[root] = true
+	}
+
+	if len(node.Outgoing) == 0 {
+		w.addPath(nodes, read)
+		return
+	}
+	if node.Fanout != "" {
+		w.walkFanout(node, nodes, read, produced)
+		return
+	}
+
+	readSoFar := read
+	for _, edge := range node.Outgoing {
+		readSoFar = copySet(readSoFar)
+		w.read(readSoFar, produced, condVars(edge, w.p.Constants))
+		w.walk(edge.To, nodes, readSoFar, produced)
+		if edge.Cond == "" {
+			return // aresta sem cond sempre casa, as seguintes nunca sao avaliadas
+		}
+	}
+	// nenhuma aresta casou: a execução termina aqui depois de ler todas as conds
+	w.addPath(nodes, readSoFar)
+}
+
+// walkFanout trata o fan-out como um caminho só até o join: toda cond das arestas é lida (todas sao
+// avaliadas pra escolher os branches) e os nós de todos os branches entram no caminho. Branch sem cond
+// sempre roda, entao o que ele lê em todo caminho dele até o join soma no caminho; o que um branch com
+// cond lê entra só no All, porque ele pode nao rodar.
+func (w *inputWalker) walkFanout(node *Node, nodes []string, read, produced map[string]bool) {
+	read = copySet(read)
+	for _, edge := range node.Outgoing {
+		w.read(read, produced, condVars(edge, w.p.Constants))
+	}
+
+	// só all/conflict-error garante que o que um branch grava chega no join
+	join := w.p.Nodes[node.Fanout]
+	mergesAll := join != nil && (join.Join == MergeAll || join.Join == MergeConflictError)
+	joined := copySet(produced)
+	for _, edge := range node.Outgoing {
+		branch := &inputWalker{p: w.p, all: w.all, derived: w.derived, stopAt: node.Fanout}
+		branch.walk(edge.To, nil, map[string]bool{}, produced)
+		w.truncated = w.truncated || branch.truncated
+		if len(branch.arrivals) == 0 {
+			continue // branch que nunca chega no join só falha
+		}
+		nodes = append(nodes[:len(nodes):len(nodes)], branch.arrivals[0].nodes...)
+		if edge.Cond != "" || edge.Default {
+			continue
+		}
+		branchRead, branchProduced := copySet(branch.arrivals[0].read), copySet(branch.arrivals[0].produced)
+		for _, a := range branch.arrivals[1:] {
+			intersect(branchRead, a.read)
+			intersect(branchProduced, a.produced)
+		}
+		for k := range branchRead {
+			read[k] = true
+		}
+		if mergesAll {
+			for k := range branchProduced {
+				joined[k] = true
+			}
+		}
+	}
+	w.walk(node.Fanout, nodes, read, joined)
+}
+
+// intersect tira de set o que nao está em other.
+func intersect(set, other map[string]bool) {
+	for k := range set {
+		if !other[k] {
+			delete(set, k)
+		}
+	}
+}
+
+func (w *inputWalker) read(read, produced map[string]bool, vars []string) {
+	for _, name := range vars {
+		if produced[name] {
+			continue
+		}
+		if deps, ok := w.derived[name]; ok {
+			w.read(read, produced, deps)
+			continue
+		}
+		read[name] = true
+		w.all[name] = true
+	}
+}
+
+func (w *inputWalker) addPath(nodes []string, read map[string]bool) {
+	if len(w.paths) >= maxIntrospectPaths {
+		w.truncated = true
+		return
+	}
+	w.paths = append(w.paths, PathInputs{Nodes: append([]string(nil), nodes...), Inputs: sortedSet(read)})
+}
+
+// condVars usa o compilado quando tem; policy montada na mão pode vir sem CompiledCond.
+func condVars(edge Edge, consts map[string]any) []string {
+	if edge.CompiledCond != nil {
+		return edge.CompiledCond.Vars()
+	}
+	compiled, err := eval.Compile(edge.Cond, eval.WithConstants(consts))
+	if err != nil {
+		return nil
+	}
+	return compiled.Vars()
+}
+
+func sortedSet(s map[string]bool) []string {
+	out := make([]string, 0, len(s))
+	for k, v := range s {
+		if v {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPolicy_RequiredInputsSplitsAlwaysAndSometimes(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	input_age="int";
+	start -> adult [cond="age >= 18"];
+	start -> minor [default=true];
+	adult [result="limit=$(income*3)"];
+	adult -> prime [cond="score > 700 && limit > 1000"];
+	adult -> standard [cond="score > 500"];
+	prime [result="tier=prime"];
+	standard [result="tier=standard"];
+	minor [result="tier=none"];
+}`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	req := p.RequiredInputs()
+	if want := []string{"age", "income", "score"}; !reflect.DeepEqual(req.All, want) {
+		t.Fatalf("all = %v, want %v", req.All, want)
+	}
+	if want := []string{"age"}; !reflect.DeepEqual(req.Always, want) {
+		t.Fatalf("always = %v, want %v", req.Always, want)
+	}
+	if want := []string{"income", "score"}; !reflect.DeepEqual(req.Sometimes, want) {
+		t.Fatalf("sometimes = %v, want %v", req.Sometimes, want)
+	}
+	if len(req.Declared) != 1 || req.Declared[0].Name != "age" {
+		t.Fatalf("expected declared schema, got %+v", req.Declared)
+	}
+
+	got := map[string][]string{}
+	for _, path := range req.Paths {
+		got[path.Nodes[len(path.Nodes)-1]] = path.Inputs
+	}
+	want := map[string][]string{
+		"prime":    {"age", "income", "score"},
+		"standard": {"age", "income", "score"},
+		"adult":    {"age", "income", "score"}, // nenhuma aresta casou
+		"minor":    {"age"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("paths = %v, want %v", got, want)
+	}
+}
+
+func TestPolicy_RequiredInputsSkipsVarsSetByResult(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	start [result="approved=true"];
+	start -> review [cond="approved && amount > 10"];
+	review [result="note=ok"];
+}`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	req := p.RequiredInputs()
+	if want := []string{"amount"}; !reflect.DeepEqual(req.All, want) {
+		t.Fatalf("all = %v, want %v", req.All, want)
+	}
+
+	scoped, err := p.ForEntry("")
+	if err != nil {
+		t.Fatalf("for entry: %v", err)
+	}
+	if got := scoped.RequiredInputs().Always; !reflect.DeepEqual(got, []string{"amount"}) {
+		t.Fatalf("always = %v", got)
+	}
+}
+
+func TestPolicy_RequiredInputsWalksFanoutBranchesAsOnePath(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	start [fanout="done"];
+	start -> a [cond="a > 1"];
+	start -> b [cond="b > 1"];
+	start -> c;
+	a [result="x=$(extra)"];
+	c [result="checked=true"];
+	a -> done;
+	b -> done;
+	c -> done;
+	done [join="all"];
+	done -> ok [cond="checked && score > 600"];
+	ok [result="approved=true"];
+}`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	req := p.RequiredInputs()
+	// as duas conds sao sempre avaliadas; extra só se o branch a rodar; checked vem do branch c
+	if want := []string{"a", "b", "score"}; !reflect.DeepEqual(req.Always, want) {
+		t.Fatalf("always = %v, want %v", req.Always, want)
+	}
+	if want := []string{"extra"}; !reflect.DeepEqual(req.Sometimes, want) {
+		t.Fatalf("sometimes = %v, want %v", req.Sometimes, want)
+	}
+	if len(req.Paths) != 2 || !reflect.DeepEqual(req.Paths[0].Nodes, []string{"start", "a", "b", "c", "done", "ok"}) {
+		t.Fatalf("expected one path through every branch per join exit, got %+v", req.Paths)
+	}
+}
@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Node     string   `json:"node,omitempty"`
+	Edge     *EdgeRef `json:"edge,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Message  string   `json:"message"`
+}
+
+type EdgeRef struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+}
+
+func (d Diagnostic) at(pos Pos) Diagnostic {
+	d.Line, d.Column = pos.Line, pos.Column
+	return d
+}
+
+// Lint roda as checagens semanticas que nao impedem a execucao mas quase sempre indicam erro de autoria:
+// nó inalcançavel a partir dos entries, aresta apontando pra nó vazio (normalmente typo no ID)
+// a analise estatica das conds (ver analyzeConditions) e constante com nome de variavel de input (erro).
+func Lint(p *Policy) []Diagnostic {
+	if p == nil || len(p.Nodes) == 0 {
+		return nil
+	}
+
+	ids := sortedNodeIDs(p)
+	reachable := reachableNodes(p)
+
+	var out []Diagnostic
+	for _, id := range ids {
+		if _, ok := reachable[id]; !ok {
+			out = append(out, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     "unreachable_node",
+				Node:     id,
+				Message:  fmt.Sprintf("node %s is not reachable from any entry", id),
+			}.at(p.Nodes[id].Pos))
+		}
+	}
+
+	for _, id := range ids {
+		for _, edge := range p.Nodes[id].Outgoing {
+			target := p.Nodes[edge.To]
+			if target == nil || len(target.Result) > 0 || len(target.Outgoing) > 0 || target.Call != nil {
+				continue
+			}
+			out = append(out, Diagnostic{
+				Severity: SeverityWarning,
+				Code:     "empty_leaf",
+				Node:     edge.To,
+				Edge:     &EdgeRef{From: id, To: edge.To},
+				Message:  fmt.Sprintf("edge %s -> %s points to a node without result and outgoing edges (typo in node id?)", id, edge.To),
+			}.at(edge.Pos))
+		}
+	}
+
+	out = append(out, constantCollisions(p)...)
+	return append(out, analyzeConditions(p)...)
+}
+
+// HasSeverity diz se algum diagnostico tem a severidade informada.
+func HasSeverity(diags []Diagnostic, severity Severity) bool {
+	for _, d := range diags {
+		if d.Severity == severity {
+			return true
+		}
+	}
+	return false
+}
+
+func reachableNodes(p *Policy) map[string]struct{} {
+	seen := make(map[string]struct{}, len(p.Nodes))
+	stack := []string{p.Start}
+	for _, id := range p.Entries {
+		stack = append(stack, id)
+	}
+
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		node := p.Nodes[id]
+		if node == nil {
+			continue
+		}
+		for _, edge := range node.Outgoing {
+			stack = append(stack, edge.To)
+		}
+	}
+
+	return seen
+}
+
+func sortedNodeIDs(p *Policy) []string {
+	ids := make([]string, 0, len(p.Nodes))
+	for id := range p.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,114 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint_ReportsUnreachableAndEmptyLeaf(t *testing.T) {
+	compiler := NewCompiler()
+	p, err := compiler.Compile(`digraph {
+		start -> approved [cond="score>700"];
+		start -> reviwe [cond="score<=700"];
+		approved [result="approved=true"];
+		review [result="approved=false"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codes := map[string]string{}
+	for _, d := range p.Diagnostics {
+		if d.Severity != SeverityWarning {
+			t.Fatalf("expected warning severity, got %#v", d)
+		}
+		codes[d.Code] = d.Node
+	}
+	if codes["unreachable_node"] != "review" {
+		t.Fatalf("expected review unreachable, got %#v", p.Diagnostics)
+	}
+	if codes["empty_leaf"] != "reviwe" {
+		t.Fatalf("expected empty leaf reviwe, got %#v", p.Diagnostics)
+	}
+}
+
+func TestLint_CleanPolicyHasNoDiagnostics(t *testing.T) {
+	compiler := NewCompiler()
+	p, err := compiler.Compile(`digraph {
+		start -> ok [cond="age>=18"];
+		start -> no [cond="age<18"];
+		ok [result="approved=true"];
+		no [result="approved=false"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Diagnostics) != 0 {
+		t.Fatalf("expected no diagnostics, got %#v", p.Diagnostics)
+	}
+}
+
+func TestCompiler_StrictLintFailsOnWarnings(t *testing.T) {
+	compiler := NewCompiler(WithStrictLint(true))
+	_, err := compiler.Compile(`digraph {
+		start -> ok [cond="age>=18"];
+		orphan [result="x=1"];
+		ok [result="approved=true"];
+	}`)
+	if err == nil {
+		t.Fatalf("expected strict lint error")
+	}
+	if !strings.Contains(err.Error(), "node orphan is not reachable") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLint_ConditionAnalysis(t *testing.T) {
+	compiler := NewCompiler()
+	p, err := compiler.Compile(`digraph {
+		start -> adult [cond="age>=18"];
+		start -> prime [cond="age>=18 && score>700"];
+		start -> never [cond="age>21 && age<20"];
+		start -> minor [cond="age<16"];
+		adult [result="approved=true"];
+		prime [result="approved=true"];
+		never [result="approved=false"];
+		minor [result="approved=false"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byCode := map[string][]Diagnostic{}
+	for _, d := range p.Diagnostics {
+		byCode[d.Code] = append(byCode[d.Code], d)
+	}
+
+	if ds := byCode["shadowed_edge"]; len(ds) != 1 || ds[0].Edge.To != "prime" {
+		t.Fatalf("expected prime edge shadowed, got %#v", ds)
+	}
+	if ds := byCode["unsatisfiable_edge"]; len(ds) != 1 || ds[0].Edge.To != "never" {
+		t.Fatalf("expected never edge unsatisfiable, got %#v", ds)
+	}
+	if ds := byCode["input_gap"]; len(ds) != 1 || !strings.Contains(ds[0].Message, "age >= 16 && age < 18") {
+		t.Fatalf("expected gap 16 <= age < 18, got %#v", ds)
+	}
+}
+
+func TestLint_OverlapIsInfo(t *testing.T) {
+	compiler := NewCompiler(WithStrictLint(true))
+	p, err := compiler.Compile(`digraph {
+		start -> prime [cond="age>=18 && score>700"];
+		start -> adult [cond="age>=18"];
+		start -> minor [cond="age<18"];
+		prime [result="approved=true"];
+		adult [result="approved=true"];
+		minor [result="approved=false"];
+	}`)
+	if err != nil {
+		t.Fatalf("expected overlap not to fail strict compile, got %v", err)
+	}
+	if len(p.Diagnostics) != 1 || p.Diagnostics[0].Code != "overlapping_edges" || p.Diagnostics[0].Severity != SeverityInfo {
+		t.Fatalf("expected single overlap info, got %#v", p.Diagnostics)
+	}
+}
@@ -1,25 +1,97 @@
 package policy
 
-import "github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+import (
+	"fmt"
+	"time"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+)
+
+const defaultStart = "start"
 
 type Policy struct {
-	Start string
-	Nodes map[string]*Node
+	Start       string
+	Entries     map[string]string
+	Nodes       map[string]*Node
+	Inputs      InputSchema
+	Outputs     InputSchema    // contrato de saida, mesmo formato do input (output_<key>)
+	Constants   map[string]any // const_<name>/list_<name>; lista vem como []any, inlined nas conds
+	Derived     []DerivedVar   // derived_<name>, em ordem de dependencia
+	Timeout     time.Duration  // timeout="50ms": orçamento de tempo de cada execução (0 = sem limite)
+	Diagnostics []Diagnostic
+	Hash        string // CanonicalHash, preenchido pelo compiler
 }
 
 type Node struct {
 	ID       string
 	Result   []Assignment
+	Call     *PolicyCall   // call="kyc@v3": roda a sub-policy antes do result
+	Fanout   string        // fanout="checks_done": segue todas as arestas que casam, em paralelo, até esse join
+	Join     MergeStrategy // join="all": nó onde os branches de um fan-out se juntam
 	Outgoing []Edge
+	Pos      Pos
 }
 
 type Edge struct {
 	To           string
 	Cond         string
 	CompiledCond *eval.Compiled
+	Default      bool
+	Priority     *int
+	Pos          Pos
 }
 
+// Assignment é um item do result. Key pode ser caminho pontuado (decision.approved),
+// e nesse caso Path tem os segmentos e o valor vai pra map aninhado no output.
+// Com Expr (result=$(income*3)) o valor é calculado pela engine quando o nó é visitado.
+// Op diz se o valor sobrescreve (=), acumula (+=) ou remove a chave (-key).
 type Assignment struct {
 	Key   string
 	Value any
+	Path  []string
+	Expr  *eval.CompiledExpr
+	Op    AssignOp
+}
+
+type AssignOp int
+
+const (
+	OpSet AssignOp = iota
+	OpAdd
+	OpUnset
+)
+
+func (op AssignOp) String() string {
+	switch op {
+	case OpAdd:
+		return "add"
+	case OpUnset:
+		return "unset"
+	default:
+		return "set"
+	}
+}
+
+func (a Assignment) path() []string {
+	if len(a.Path) > 0 {
+		return a.Path
+	}
+	return []string{a.Key}
+}
+
+// ForEntry devolve a policy começando no entry nomeado (ex: entry_pre_approval="intake").
+// Nome vazio usa o entry default. Os nós são compartilhados, só troca o Start.
+func (p *Policy) ForEntry(name string) (*Policy, error) {
+	if p == nil || name == "" {
+		return p, nil
+	}
+
+	start, ok := p.Entries[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown entry %q", name)
+	}
+
+	view := *p
+	view.Start = start
+	return &view, nil
 }
@@ -2,6 +2,7 @@ package policy
 
 import (
 	"log"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -11,6 +12,12 @@ type NodeLatencyObserver interface {
 	ObserveNodeLatency(nodeID string, duration time.Duration)
 }
 
+// AmbiguityObserver é opcional pro observer passado em WithNodeLatencyObserver: no modo evaluate-all
+// recebe cada nó em que mais de uma aresta casou (matched[0] é a seguida).
+type AmbiguityObserver interface {
+	ObserveAmbiguousDecision(nodeID string, matched []string)
+}
+
 type NodeLatencyLogger struct {
 	logger *log.Logger
 }
@@ -26,6 +33,13 @@ func (l *NodeLatencyLogger) ObserveNodeLatency(nodeID string, duration time.Dura
 	l.logger.Printf("policy_node_latency node=%s duration_ms=%.3f", nodeID, float64(duration.Microseconds())/1000.0)
 }
 
+func (l *NodeLatencyLogger) ObserveAmbiguousDecision(nodeID string, matched []string) {
+	if l == nil || l.logger == nil {
+		return
+	}
+	l.logger.Printf("policy_ambiguous_decision node=%s matched=%s", nodeID, strings.Join(matched, ","))
+}
+
 type AsyncNodeLatencyObserver struct {
 	next    NodeLatencyObserver
 	events  chan nodeLatencyEvent
@@ -34,11 +48,14 @@ type AsyncNodeLatencyObserver struct {
 	closed  bool
 	wg      sync.WaitGroup
 	dropped atomic.Uint64
+	// ambiguous conta as decisões ambiguas (evaluate-all) que passaram por aqui, mesmo as dropadas.
+	ambiguous atomic.Uint64
 }
 
 type nodeLatencyEvent struct {
 	nodeID   string
 	duration time.Duration
+	matched  []string // preenchido = evento de decisão ambigua
 }
 
 func NewAsyncNodeLatencyObserver(next NodeLatencyObserver, buffer int) *AsyncNodeLatencyObserver {
@@ -58,6 +75,12 @@ func NewAsyncNodeLatencyObserver(next NodeLatencyObserver, buffer int) *AsyncNod
 			if o.next == nil {
 				continue
 			}
+			if ev.matched != nil {
+				if next, ok := o.next.(AmbiguityObserver); ok {
+					next.ObserveAmbiguousDecision(ev.nodeID, ev.matched)
+				}
+				continue
+			}
 			o.next.ObserveNodeLatency(ev.nodeID, ev.duration)
 		}
 	}()
@@ -66,6 +89,18 @@ func NewAsyncNodeLatencyObserver(next NodeLatencyObserver, buffer int) *AsyncNod
 }
 
 func (o *AsyncNodeLatencyObserver) ObserveNodeLatency(nodeID string, duration time.Duration) {
+	o.send(nodeLatencyEvent{nodeID: nodeID, duration: duration})
+}
+
+func (o *AsyncNodeLatencyObserver) ObserveAmbiguousDecision(nodeID string, matched []string) {
+	if o == nil {
+		return
+	}
+	o.ambiguous.Add(1)
+	o.send(nodeLatencyEvent{nodeID: nodeID, matched: matched})
+}
+
+func (o *AsyncNodeLatencyObserver) send(ev nodeLatencyEvent) {
 	if o == nil {
 		return
 	}
@@ -76,7 +111,7 @@ func (o *AsyncNodeLatencyObserver) ObserveNodeLatency(nodeID string, duration ti
 		return
 	}
 	select {
-	case o.events <- nodeLatencyEvent{nodeID: nodeID, duration: duration}:
+	case o.events <- ev:
 	default:
 		o.dropped.Add(1)
 	}
@@ -90,6 +125,14 @@ func (o *AsyncNodeLatencyObserver) Dropped() uint64 {
 	return o.dropped.Load()
 }
 
+// AmbiguousDecisions é o total de decisões ambiguas observadas (modo evaluate-all).
+func (o *AsyncNodeLatencyObserver) AmbiguousDecisions() uint64 {
+	if o == nil {
+		return 0
+	}
+	return o.ambiguous.Load()
+}
+
 func (o *AsyncNodeLatencyObserver) Close() {
 	if o == nil {
 		return
@@ -1,6 +1,7 @@
 package policy
 
 import (
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -83,3 +84,46 @@ func TestAsyncNodeLatencyObserver_CloseDuringConcurrentObserveDoesNotPanic(t *te
 		t.Fatalf("expected no panics, got %d", panics.Load())
 	}
 }
+
+type spyAmbiguityObserver struct {
+	spyNodeLatencyObserver
+	ambiguous []string
+}
+
+func (s *spyAmbiguityObserver) ObserveAmbiguousDecision(nodeID string, matched []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ambiguous = append(s.ambiguous, nodeID+":"+strings.Join(matched, ","))
+}
+
+func TestEngine_EvaluateAllReportsAmbiguousDecisionsToObserver(t *testing.T) {
+	p, err := NewCompiler().Compile(`digraph {
+	start -> prime [cond="score > 700"];
+	start -> adult [cond="age >= 18"];
+	start -> rejected [default=true];
+	prime [result="segment='prime'"];
+	adult [result="segment='adult'"];
+	rejected [result="segment='none'"];
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spy := &spyAmbiguityObserver{}
+	async := NewAsyncNodeLatencyObserver(spy, 8)
+	engine := NewEngine(ExprEvaluator{}, WithNodeLatencyObserver(async), WithEvaluateAll())
+
+	if err := engine.Run(p, map[string]any{"score": 720, "age": 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Run(p, map[string]any{"score": 720, "age": 10}); err != nil {
+		t.Fatal(err)
+	}
+	async.Close()
+
+	if got := async.AmbiguousDecisions(); got != 1 {
+		t.Fatalf("expected 1 ambiguous decision, got %d", got)
+	}
+	if len(spy.ambiguous) != 1 || spy.ambiguous[0] != "start:prime,adult" {
+		t.Fatalf("unexpected forwarded events: %v", spy.ambiguous)
+	}
+}
@@ -0,0 +1,185 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PolicyCall é o call="kyc@v3" de um nó: a sub-policy já resolvida e compilada no compile.
+type PolicyCall struct {
+	Ref    string
+	Policy *Policy
+}
+
+// PolicyResolver resolve a referencia de um call (ex: "kyc@v3") pra policy compilada.
+type PolicyResolver interface {
+	ResolvePolicy(ref string) (*Policy, error)
+}
+
+// Registry guarda as policies que podem ser chamadas por call=... e compila cada uma na primeira vez
+// que alguém pede (já resolvendo os calls dela). Ciclo entre policies aparece aqui, no compile:
+// a pilha de refs sendo compiladas vai junto na resolução.
+type Registry struct {
+	opts []CompilerOption
+
+	mu       sync.Mutex
+	sources  map[string]registrySource
+	compiled map[string]*Policy
+}
+
+type registrySource struct {
+	src  string
+	json bool
+}
+
+// NewRegistry recebe as mesmas opções do compiler usado nas policies registradas (ex: WithStrictLint).
+func NewRegistry(opts ...CompilerOption) *Registry {
+	return &Registry{
+		opts:     opts,
+		sources:  map[string]registrySource{},
+		compiled: map[string]*Policy{},
+	}
+}
+
+// Register adiciona uma policy em DOT com a referencia usada no call (ex: "kyc@v3").
+func (r *Registry) Register(ref, dot string) error {
+	return r.register(ref, registrySource{src: dot})
+}
+
+// RegisterJSON é o Register pro formato JSON (Document).
+func (r *Registry) RegisterJSON(ref, src string) error {
+	return r.register(ref, registrySource{src: src, json: true})
+}
+
+func (r *Registry) register(ref string, src registrySource) error {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return fmt.Errorf("policy ref is required")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.sources[ref]; dup {
+		return fmt.Errorf("policy %q already registered", ref)
+	}
+	r.sources[ref] = src
+	return nil
+}
+
+// LoadDir registra cada arquivo .dot/.json do diretorio, com o nome do arquivo sem extensão como ref
+// (kyc@v3.dot vira "kyc@v3").
+func (r *Registry) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".dot" && ext != ".json") {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		ref := strings.TrimSuffix(entry.Name(), ext)
+		if ext == ".json" {
+			err = r.RegisterJSON(ref, string(raw))
+		} else {
+			err = r.Register(ref, string(raw))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Refs devolve as referencias registradas, ordenadas.
+func (r *Registry) Refs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, 0, len(r.sources))
+	for ref := range r.sources {
+		out = append(out, ref)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (r *Registry) ResolvePolicy(ref string) (*Policy, error) {
+	return r.resolve(ref, nil)
+}
+
+func (r *Registry) resolve(ref string, stack []string) (*Policy, error) {
+	for _, s := range stack {
+		if s == ref {
+			return nil, fmt.Errorf("policy call cycle: %s", strings.Join(append(stack, ref), " -> "))
+		}
+	}
+
+	r.mu.Lock()
+	p, ok := r.compiled[ref]
+	src, known := r.sources[ref]
+	r.mu.Unlock()
+	if ok {
+		return p, nil
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown policy %q", ref)
+	}
+
+	// compila fora do lock: a resolução dos calls volta aqui recursivamente
+	c := NewCompiler(r.opts...)
+	c.resolver = stackResolver{r: r, stack: append(stack[:len(stack):len(stack)], ref)}
+	var err error
+	if src.json {
+		p, err = c.CompileJSON(src.src)
+	} else {
+		p, err = c.Compile(src.src)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("compile %s: %w", ref, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if prev, ok := r.compiled[ref]; ok {
+		return prev, nil
+	}
+	r.compiled[ref] = p
+	return p, nil
+}
+
+// stackResolver carrega a pilha de refs que estão sendo compiladas, pra detectar ciclo.
+type stackResolver struct {
+	r     *Registry
+	stack []string
+}
+
+func (s stackResolver) ResolvePolicy(ref string) (*Policy, error) {
+	return s.r.resolve(ref, s.stack)
+}
+
+// resolveCalls resolve o call=... de cada nó pelo resolver do compiler.
+func resolveCalls(p *Policy, resolver PolicyResolver, errs *CompileErrors) {
+	for _, id := range sortedNodeIDs(p) {
+		node := p.Nodes[id]
+		if node.Call == nil {
+			continue
+		}
+		if resolver == nil {
+			errs.add(node.Pos, CompileError{Node: id, Attr: "call", Message: fmt.Sprintf("node %s calls %s but no policy registry is configured", id, node.Call.Ref)})
+			continue
+		}
+		sub, err := resolver.ResolvePolicy(node.Call.Ref)
+		if err != nil {
+			errs.add(node.Pos, CompileError{Node: id, Attr: "call", Message: fmt.Sprintf("node %s call %s: %v", id, node.Call.Ref, err)})
+			continue
+		}
+		node.Call.Policy = sub
+	}
+}
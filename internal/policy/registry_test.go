@@ -0,0 +1,187 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const kycPolicy = `digraph {
+	input_document="string";
+	output_kyc_ok="bool";
+	start -> ok [cond="document != \"\""];
+	start -> fail [default=true];
+	ok [result="kyc_ok=true,kyc_detail='doc',-temp"];
+	fail [result="kyc_ok=false"];
+}`
+
+func TestEngine_CallRunsSubPolicyAndMergesOutput(t *testing.T) {
+	reg := NewRegistry()
+	if err := reg.Register("kyc@v3", kycPolicy); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewCompiler(WithPolicyResolver(reg)).Compile(`digraph {
+	output_kyc_ok="bool";
+	start [result="temp=1"];
+	start -> kyc;
+	kyc [call="kyc@v3", result="checked=$(kyc_ok)"];
+	kyc -> approved [cond="kyc_ok"];
+	kyc -> rejected [default=true];
+	approved [result="approved=true"];
+	rejected [result="approved=false"];
+}`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if p.Nodes["kyc"].Call.Policy == nil {
+		t.Fatalf("call should be resolved at compile time")
+	}
+
+	vars := map[string]any{"document": "123"}
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, vars)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if vars["approved"] != true || vars["checked"] != true {
+		t.Fatalf("unexpected vars: %v", vars)
+	}
+	// só o output_ declarado volta: a remoção e a chave interna ficam na cópia da sub-policy
+	if vars["temp"] != 1 {
+		t.Fatalf("caller key must survive the sub-policy unset: %v", vars)
+	}
+	if _, ok := vars["kyc_detail"]; ok {
+		t.Fatalf("undeclared sub-policy key must not leak: %v", vars)
+	}
+	call := trace.Steps[1].Call
+	if call == nil || call.Ref != "kyc@v3" || call.Trace == nil || call.Trace.Terminated != "leaf" ||
+		strings.Join(call.Trace.VisitedPath, ",") != "start,ok" {
+		t.Fatalf("expected nested trace, got %+v", call)
+	}
+
+	vars = map[string]any{}
+	trace, err = NewEngine(ExprEvaluator{}).RunWithTrace(p, vars)
+	var inputErrs InputErrors
+	if !errors.As(err, &inputErrs) || trace.Terminated != "error_call" || !strings.Contains(err.Error(), `node "kyc" call kyc@v3`) {
+		t.Fatalf("expected sub-policy input error, got %v (%s)", err, trace.Terminated)
+	}
+}
+
+func TestEngine_CallWithoutContractMergesOnlyWrittenKeys(t *testing.T) {
+	reg := NewRegistry()
+	if err := reg.Register("score@v1", `digraph {
+	start [result="score=$(score + 10),bonus=true,-segment"];
+}`); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewCompiler(WithPolicyResolver(reg)).Compile(`digraph { start [call="score@v1"]; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]any{"score": 1.0, "segment": "prime", "age": 30.0}
+	if _, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars["score"] != 11.0 || vars["bonus"] != true || vars["segment"] != "prime" || vars["age"] != 30.0 {
+		t.Fatalf("unexpected vars after call: %v", vars)
+	}
+}
+
+func TestEngine_CallKeepsSubPolicyDerivedVarsInside(t *testing.T) {
+	reg := NewRegistry()
+	if err := reg.Register("age@v1", `digraph {
+	derived_adult="age >= 18";
+	start [result="age_ok=$(adult)"];
+}`); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewCompiler(WithPolicyResolver(reg)).Compile(`digraph {
+	derived_adult="age >= 21";
+	start [call="age@v1"];
+	again [call="age@v1"];
+	start -> again;
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := map[string]any{"age": 19.0}
+	trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(p, vars)
+	if err != nil {
+		t.Fatalf("caller derived var with the callee's name should not collide, got %v (%s)", err, trace.Terminated)
+	}
+	if vars["age_ok"] != true || vars["adult"] != false {
+		t.Fatalf("sub-policy derived var must not leak into the caller: %v", vars)
+	}
+
+	// sem derivada no chamador: o segundo call nao pode ver a derivada do primeiro
+	plain, err := NewCompiler(WithPolicyResolver(reg)).Compile(`digraph {
+	start [call="age@v1"];
+	again [call="age@v1"];
+	start -> again;
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars = map[string]any{"age": 19.0}
+	if trace, err := NewEngine(ExprEvaluator{}).RunWithTrace(plain, vars); err != nil {
+		t.Fatalf("calling the same derived-using sub-policy twice should work, got %v (%s)", err, trace.Terminated)
+	}
+	if _, ok := vars["adult"]; ok || vars["age_ok"] != true {
+		t.Fatalf("sub-policy derived var must not leak into the caller: %v", vars)
+	}
+}
+
+func TestRegistry_DetectsCallCycles(t *testing.T) {
+	reg := NewRegistry()
+	_ = reg.Register("a@v1", `digraph { start [call="b@v1"]; }`)
+	_ = reg.Register("b@v1", `digraph { start [call="a@v1"]; }`)
+
+	_, err := NewCompiler(WithPolicyResolver(reg)).Compile(`digraph { start [call="a@v1"]; }`)
+	if err == nil || !strings.Contains(err.Error(), "policy call cycle: a@v1 -> b@v1 -> a@v1") {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+
+	_, err = NewCompiler(WithPolicyResolver(reg)).Compile(`digraph { start [call="missing@v1"]; }`)
+	if err == nil || !strings.Contains(err.Error(), `node start call missing@v1: unknown policy "missing@v1"`) {
+		t.Fatalf("expected unknown policy error, got %v", err)
+	}
+
+	_, err = NewCompiler().Compile(`digraph { start [call="a@v1"]; }`)
+	if err == nil || !strings.Contains(err.Error(), "no policy registry is configured") {
+		t.Fatalf("expected missing registry error, got %v", err)
+	}
+}
+
+func TestRegistry_LoadDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kyc@v3.dot"), []byte(kycPolicy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fraud@v1.json"), []byte(`{"nodes":[{"id":"start","result":{"fraud":false}}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := NewRegistry()
+	if err := reg.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(reg.Refs(), ","); got != "fraud@v1,kyc@v3" {
+		t.Fatalf("refs = %s", got)
+	}
+	p, err := reg.ResolvePolicy("fraud@v1")
+	if err != nil || p.Nodes["start"] == nil {
+		t.Fatalf("resolve json policy: %v", err)
+	}
+	if again, _ := reg.ResolvePolicy("fraud@v1"); again != p {
+		t.Fatalf("compiled policy should be reused")
+	}
+	if err := reg.Register("kyc@v3", kycPolicy); err == nil {
+		t.Fatalf("expected duplicate ref error")
+	}
+}
@@ -2,56 +2,402 @@ package policy
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
 )
 
 // ParseResult converte o atributo result do nó em assignments tipados.
 // Ex: "approved=true,segment=prime" vira []Assignment.
+//
+// Gramatica (compativel com o key=value antigo):
+//
+//	result     = assignment { "," assignment }
+//	assignment = key ( "=" | "+=" ) ( value [ "::" type ] | "$(" expr ")" ) | "-" key
+//	value      = string | array | object | bare
+//	string     = "..." | '...'            (escapes estilo Go/JSON, \' vale nas aspas simples)
+//	array      = "[" [ value { "," value } ] "]"
+//	object     = "{" [ key ":" value { "," key ":" value } ] "}"
+//	bare       = true | false | null | int | float | texto cru
+//	type       = string | int | float | bool
+//
+// O sufixo de tipo força a interpretação do valor: code=007::string fica "007" e nao 7.
+// $(...) é expressão calculada em runtime (ex: limit=$(income*3)), compilada aqui uma vez só.
+// "+=" acumula (reasons+=LOW_SCORE, score+=15) e "-key" remove a chave, regras de tipo no accumulate.
 func ParseResult(raw string) ([]Assignment, error) {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
 		return nil, nil
 	}
 
-	parts := strings.Split(raw, ",")
-	out := make([]Assignment, 0, len(parts))
+	rp := &resultParser{src: raw}
+	var out []Assignment
 
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if part == "" {
+	for {
+		rp.skipSpaces()
+		if rp.eof() {
+			break
+		}
+		if rp.peek() == ',' {
+			rp.pos++
 			continue
 		}
 
-		kv := strings.SplitN(part, "=", 2)
-		if len(kv) != 2 {
-			return nil, fmt.Errorf("invalid assignment %q (expected key=value)", part)
+		a, err := rp.assignment()
+		if err != nil {
+			return nil, err
 		}
+		out = append(out, a)
+
+		rp.skipSpaces()
+		if !rp.eof() && rp.peek() != ',' {
+			return nil, rp.errorf("unexpected %q after value of %s (missing comma?)", rp.peek(), a.Key)
+		}
+	}
+
+	return out, nil
+}
+
+type resultParser struct {
+	src string
+	pos int
+}
 
-		key := strings.TrimSpace(kv[0])
+func (rp *resultParser) eof() bool { return rp.pos >= len(rp.src) }
+
+func (rp *resultParser) peek() byte { return rp.src[rp.pos] }
+
+func (rp *resultParser) skipSpaces() {
+	for !rp.eof() && (rp.peek() == ' ' || rp.peek() == '\t' || rp.peek() == '\n' || rp.peek() == '\r') {
+		rp.pos++
+	}
+}
+
+func (rp *resultParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid result at position %d: %s", rp.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (rp *resultParser) assignment() (Assignment, error) {
+	start := rp.pos
+	eq := strings.IndexByte(rp.src[start:], '=')
+	comma := strings.IndexByte(rp.src[start:], ',')
+
+	if rp.peek() == '-' && (eq < 0 || (comma >= 0 && comma < eq)) {
+		end := len(rp.src)
+		if comma >= 0 {
+			end = start + comma
+		}
+		key := strings.TrimSpace(rp.src[start+1 : end])
 		if key == "" {
-			return nil, fmt.Errorf("empty key in assignment %q", part)
+			return Assignment{}, rp.errorf("empty key in unset")
 		}
+		path, err := resultPath(key)
+		if err != nil {
+			return Assignment{}, err
+		}
+		rp.pos = end
+		return Assignment{Key: key, Path: path, Op: OpUnset}, nil
+	}
+
+	if eq < 0 || (comma >= 0 && comma < eq) {
+		end := len(rp.src)
+		if comma >= 0 {
+			end = start + comma
+		}
+		return Assignment{}, fmt.Errorf("invalid assignment %q (expected key=value)", strings.TrimSpace(rp.src[start:end]))
+	}
 
-		valRaw := strings.TrimSpace(kv[1])
-		val := parseLiteral(valRaw)
+	key := strings.TrimSpace(rp.src[start : start+eq])
+	op := OpSet
+	if strings.HasSuffix(key, "+") {
+		op = OpAdd
+		key = strings.TrimSpace(strings.TrimSuffix(key, "+"))
+	}
+	if key == "" {
+		return Assignment{}, fmt.Errorf("empty key in assignment %q", strings.TrimSpace(rp.src[start:]))
+	}
+	path, err := resultPath(key)
+	if err != nil {
+		return Assignment{}, err
+	}
+	rp.pos = start + eq + 1
 
-		out = append(out, Assignment{Key: key, Value: val})
+	rp.skipSpaces()
+	if strings.HasPrefix(rp.src[rp.pos:], "$(") {
+		compiled, err := rp.expression()
+		if err != nil {
+			return Assignment{}, err
+		}
+		return Assignment{Key: key, Path: path, Expr: compiled, Op: op}, nil
 	}
 
-	return out, nil
+	valuePos := rp.pos
+	val, err := rp.value(",")
+	if err != nil {
+		return Assignment{}, err
+	}
+	if op == OpAdd && val == nil {
+		rp.pos = valuePos
+		return Assignment{}, rp.errorf("operator += on %s needs a non-null value", key)
+	}
+	return Assignment{Key: key, Value: val, Path: path, Op: op}, nil
 }
 
-// parseLiteral tenta adivinhar o tipo do valor na moral:
-// bool -> int -> float -> string quoted -> string crua.
-func parseLiteral(s string) any {
-	s = strings.TrimSpace(s)
+// resultPath quebra a chave pontuada (decision.approved) em segmentos.
+// Chave simples devolve nil, ai o engine usa a Key direto.
+func resultPath(key string) ([]string, error) {
+	if !strings.Contains(key, ".") {
+		return nil, nil
+	}
+	path := strings.Split(key, ".")
+	for _, seg := range path {
+		if strings.TrimSpace(seg) == "" {
+			return nil, fmt.Errorf("invalid key %q: empty path segment", key)
+		}
+	}
+	return path, nil
+}
 
-	if s == "true" {
-		return true
+// expression lê o $(...) com parenteses balanceados (ignorando os que estão dentro de string) e compila.
+func (rp *resultParser) expression() (*eval.CompiledExpr, error) {
+	start := rp.pos
+	rp.pos += 2
+	depth := 1
+	var quote byte
+	for depth > 0 {
+		if rp.eof() {
+			rp.pos = start
+			return nil, rp.errorf("unterminated expression")
+		}
+		ch := rp.peek()
+		rp.pos++
+		switch {
+		case quote != 0:
+			if ch == '\\' && !rp.eof() {
+				rp.pos++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		}
+	}
+
+	src := rp.src[start+2 : rp.pos-1]
+	compiled, err := eval.CompileExpr(src)
+	if err != nil {
+		end := rp.pos
+		rp.pos = start
+		return nil, rp.errorf("invalid expression %s: %v", rp.src[start:end], err)
+	}
+	return compiled, nil
+}
+
+// value lê um valor; stops sao os caracteres que encerram um valor cru nesse contexto.
+func (rp *resultParser) value(stops string) (any, error) {
+	rp.skipSpaces()
+	if rp.eof() {
+		return "", nil
+	}
+
+	var (
+		val    any
+		text   string
+		scalar = true
+		err    error
+	)
+
+	switch rp.peek() {
+	case '"', '\'':
+		text, err = rp.quoted()
+		val = text
+	case '[':
+		scalar = false
+		val, err = rp.array()
+	case '{':
+		scalar = false
+		val, err = rp.object()
+	default:
+		text = rp.bare(stops)
+		val = parseBare(text)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rp.skipSpaces()
+	if !strings.HasPrefix(rp.src[rp.pos:], "::") {
+		return val, nil
+	}
+	rp.pos += 2
+	typeStart := rp.pos
+	for !rp.eof() && isResultIdentByte(rp.peek()) {
+		rp.pos++
+	}
+	typ := rp.src[typeStart:rp.pos]
+	if !scalar {
+		return nil, rp.errorf("type suffix ::%s is only allowed on scalar values", typ)
+	}
+	return convertTyped(text, typ, rp)
+}
+
+func (rp *resultParser) bare(stops string) string {
+	start := rp.pos
+	for !rp.eof() {
+		if strings.IndexByte(stops, rp.peek()) >= 0 || strings.HasPrefix(rp.src[rp.pos:], "::") {
+			break
+		}
+		rp.pos++
+	}
+	return strings.TrimSpace(rp.src[start:rp.pos])
+}
+
+// quoted lê string entre aspas duplas ou simples e resolve os escapes.
+func (rp *resultParser) quoted() (string, error) {
+	start := rp.pos
+	q := rp.peek()
+	rp.pos++
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for {
+		if rp.eof() {
+			rp.pos = start
+			return "", rp.errorf("unterminated string")
+		}
+		ch := rp.peek()
+		rp.pos++
+		switch {
+		case ch == q:
+			b.WriteByte('"')
+			s, err := strconv.Unquote(b.String())
+			if err != nil {
+				raw := rp.src[start:rp.pos] // o trecho do texto, nao o buffer reescrito (que cresce com \")
+				rp.pos = start
+				return "", rp.errorf("invalid escape in string %s", raw)
+			}
+			return s, nil
+		case ch == '\\':
+			if rp.eof() {
+				rp.pos = start
+				return "", rp.errorf("unterminated string")
+			}
+			next := rp.peek()
+			rp.pos++
+			if next == '\'' {
+				b.WriteByte('\'')
+				continue
+			}
+			b.WriteByte('\\')
+			b.WriteByte(next)
+		case ch == '"':
+			b.WriteString(`\"`)
+		default:
+			b.WriteByte(ch)
+		}
 	}
-	if s == "false" {
+}
+
+func (rp *resultParser) array() ([]any, error) {
+	rp.pos++ // [
+	out := []any{}
+	for {
+		rp.skipSpaces()
+		if rp.eof() {
+			return nil, rp.errorf("unterminated array")
+		}
+		if rp.peek() == ']' {
+			rp.pos++
+			return out, nil
+		}
+		if len(out) > 0 {
+			if rp.peek() != ',' {
+				return nil, rp.errorf("expected ',' or ']' in array, got %q", rp.peek())
+			}
+			rp.pos++
+		}
+
+		v, err := rp.value(",]}")
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+}
+
+func (rp *resultParser) object() (map[string]any, error) {
+	rp.pos++ // {
+	out := map[string]any{}
+	for {
+		rp.skipSpaces()
+		if rp.eof() {
+			return nil, rp.errorf("unterminated object")
+		}
+		if rp.peek() == '}' {
+			rp.pos++
+			return out, nil
+		}
+		if len(out) > 0 {
+			if rp.peek() != ',' {
+				return nil, rp.errorf("expected ',' or '}' in object, got %q", rp.peek())
+			}
+			rp.pos++
+			rp.skipSpaces()
+		}
+
+		var key string
+		if !rp.eof() && (rp.peek() == '"' || rp.peek() == '\'') {
+			k, err := rp.quoted()
+			if err != nil {
+				return nil, err
+			}
+			key = k
+		} else {
+			start := rp.pos
+			for !rp.eof() && isResultIdentByte(rp.peek()) {
+				rp.pos++
+			}
+			key = rp.src[start:rp.pos]
+		}
+		if key == "" {
+			return nil, rp.errorf("expected object key")
+		}
+
+		rp.skipSpaces()
+		if rp.eof() || rp.peek() != ':' {
+			return nil, rp.errorf("expected ':' after object key %s", key)
+		}
+		rp.pos++
+
+		v, err := rp.value(",]}")
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+}
+
+func isResultIdentByte(ch byte) bool {
+	return ch == '_' || ch == '-' || ch == '.' ||
+		(ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+// parseBare tenta adivinhar o tipo do valor cru na moral:
+// bool -> null -> int -> float -> string crua.
+func parseBare(s string) any {
+	switch s {
+	case "true":
+		return true
+	case "false":
 		return false
+	case "null":
+		return nil
 	}
 
 	if i, err := strconv.Atoi(s); err == nil {
@@ -62,14 +408,241 @@ func parseLiteral(s string) any {
 		return f
 	}
 
-	if len(s) >= 2 && ((s[0] == '"' && s[len(s)-1] == '"') || (s[0] == '\'' && s[len(s)-1] == '\'')) {
-		if s[0] == '\'' {
-			s = `"` + s[1:len(s)-1] + `"`
+	return s
+}
+
+func convertTyped(text, typ string, rp *resultParser) (any, error) {
+	switch typ {
+	case "string":
+		return text, nil
+	case "int":
+		i, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return nil, rp.errorf("value %q is not a valid int", text)
+		}
+		return i, nil
+	case "float":
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, rp.errorf("value %q is not a valid float", text)
 		}
-		if unq, err := strconv.Unquote(s); err == nil {
-			return unq
+		return f, nil
+	case "bool":
+		b, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return nil, rp.errorf("value %q is not a valid bool", text)
 		}
+		return b, nil
 	}
+	return nil, rp.errorf("unknown type suffix ::%s (expected string, int, float or bool)", typ)
+}
 
-	return s
+// FormatResult faz o caminho inverso do ParseResult, na forma canonica:
+// ParseResult(FormatResult(a)) devolve os mesmos valores.
+func FormatResult(assignments []Assignment) string {
+	parts := make([]string, 0, len(assignments))
+	for _, a := range assignments {
+		switch a.Op {
+		case OpUnset:
+			parts = append(parts, "-"+a.Key)
+		case OpAdd:
+			parts = append(parts, a.Key+"+="+formatAssignmentValue(a))
+		default:
+			parts = append(parts, a.Key+"="+formatAssignmentValue(a))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatAssignmentValue(a Assignment) string {
+	if a.Expr != nil {
+		return "$(" + a.Expr.Source() + ")"
+	}
+	return FormatValue(a.Value)
+}
+
+// FormatValue escreve um valor de result na gramatica do ParseResult.
+// String sempre vai entre aspas simples pra nao virar bool/numero de novo.
+func FormatValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return quoteSingle(val)
+	case bool:
+		return strconv.FormatBool(val)
+	case float64:
+		s := strconv.FormatFloat(val, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEnN") {
+			s += ".0"
+		}
+		return s
+	case []any:
+		parts := make([]string, 0, len(val))
+		for _, it := range val {
+			parts = append(parts, FormatValue(it))
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	case map[string]any:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, k := range keys {
+			key := k
+			if !isResultIdent(k) {
+				key = quoteSingle(k)
+			}
+			parts = append(parts, key+":"+FormatValue(val[k]))
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func quoteSingle(s string) string {
+	q := strconv.Quote(s)
+	q = strings.ReplaceAll(q[1:len(q)-1], `\"`, `"`)
+	q = strings.ReplaceAll(q, `'`, `\'`)
+	return "'" + q + "'"
+}
+
+func isResultIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isResultIdentByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyAssignment grava o valor no output. Caminho pontuado cria/mescla maps aninhados;
+// map que já existia (ex: veio do input) é copiado antes de mexer, e escalar no meio do caminho é sobrescrito.
+func applyAssignment(vars map[string]any, a Assignment, value any) {
+	path := a.path()
+	cur := vars
+	for _, seg := range path[:len(path)-1] {
+		next, ok := cur[seg].(map[string]any)
+		if ok {
+			next = copyMap(next)
+		} else {
+			next = map[string]any{}
+		}
+		cur[seg] = next
+		cur = next
+	}
+	cur[path[len(path)-1]] = value
+}
+
+func copyMap(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// lookupPath lê o valor atual no caminho (pra += e pro before do trace).
+func lookupPath(vars map[string]any, path []string) (any, bool) {
+	cur := vars
+	for _, seg := range path[:len(path)-1] {
+		next, ok := cur[seg].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		cur = next
+	}
+	v, ok := cur[path[len(path)-1]]
+	return v, ok
+}
+
+// unsetPath remove a chave; caminho que nao existe é no-op. Map aninhado é copiado antes, igual no applyAssignment.
+func unsetPath(vars map[string]any, path []string) {
+	if _, ok := lookupPath(vars, path); !ok {
+		return
+	}
+	cur := vars
+	for _, seg := range path[:len(path)-1] {
+		next := copyMap(cur[seg].(map[string]any))
+		cur[seg] = next
+		cur = next
+	}
+	delete(cur, path[len(path)-1])
+}
+
+// resultOpError é erro de tipo do += em runtime (ex: somar string em numero).
+type resultOpError struct {
+	msg string
+}
+
+func (e *resultOpError) Error() string { return e.msg }
+
+// accumulate aplica o += com regras fixas de tipo:
+//   - chave ausente/null: numero vira o proprio numero, array vira copia, qualquer outro valor vira lista [valor]
+//   - numero += numero soma (int só se os dois forem int, senão float64)
+//   - lista += array concatena, lista += outro valor faz append
+//   - qualquer outra combinação é erro
+func accumulate(cur any, exists bool, v any) (any, error) {
+	if v == nil {
+		return nil, &resultOpError{msg: "cannot add null"}
+	}
+
+	if !exists || cur == nil {
+		if _, ok := eval.Number(v); ok {
+			return v, nil
+		}
+		if list, ok := v.([]any); ok {
+			return cloneValue(list), nil
+		}
+		return []any{v}, nil
+	}
+
+	switch c := cur.(type) {
+	case []any:
+		add, ok := v.([]any)
+		if !ok {
+			add = []any{v}
+		}
+		out := make([]any, 0, len(c)+len(add))
+		out = append(out, c...)
+		return append(out, cloneValue(add).([]any)...), nil
+	}
+
+	cf, curNum := eval.Number(cur)
+	vf, addNum := eval.Number(v)
+	if !curNum || !addNum {
+		return nil, &resultOpError{msg: fmt.Sprintf("cannot add %T to %T value", v, cur)}
+	}
+	ci, curInt := cur.(int)
+	vi, addInt := v.(int)
+	if curInt && addInt {
+		return ci + vi, nil
+	}
+	return cf + vf, nil
+}
+
+// cloneValue copia array/object do result, pra execução nunca mutar o valor compartilhado da policy compilada.
+func cloneValue(v any) any {
+	switch val := v.(type) {
+	case []any:
+		out := make([]any, len(val))
+		for i, it := range val {
+			out[i] = cloneValue(it)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, it := range val {
+			out[k] = cloneValue(it)
+		}
+		return out
+	default:
+		return v
+	}
 }
@@ -1,6 +1,10 @@
 package policy
 
-import "testing"
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestParseResult_TypesAndQuotes(t *testing.T) {
 	assignments, err := ParseResult(`approved=true,segment="prime",score=720,ratio=1.5,label='ok'`)
@@ -56,3 +60,163 @@ func TestParseResult_QuotedBooleanRemainsString(t *testing.T) {
 		t.Fatalf("expected string true, got %#v", assignments[0].Value)
 	}
 }
+
+func TestParseResult_StructuredValues(t *testing.T) {
+	assignments, err := ParseResult(`tags=['vip', "new", 3], limits={daily: 500, "max per tx": 1.5, flags: [true, null]}, note=null, msg='it\'s "ok", really'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]any{}
+	for _, a := range assignments {
+		got[a.Key] = a.Value
+	}
+	want := map[string]any{
+		"tags":   []any{"vip", "new", 3},
+		"limits": map[string]any{"daily": 500, "max per tx": 1.5, "flags": []any{true, nil}},
+		"note":   nil,
+		"msg":    `it's "ok", really`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected values:\ngot  %#v\nwant %#v", got, want)
+	}
+}
+
+func TestParseResult_TypeSuffix(t *testing.T) {
+	assignments, err := ParseResult(`code=007::string,limit='42'::int,rate=2::float,on=1::bool`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Assignment{
+		{Key: "code", Value: "007"},
+		{Key: "limit", Value: 42},
+		{Key: "rate", Value: 2.0},
+		{Key: "on", Value: true},
+	}
+	if !reflect.DeepEqual(assignments, want) {
+		t.Fatalf("unexpected assignments: %#v", assignments)
+	}
+}
+
+func TestParseResult_StructuredErrors(t *testing.T) {
+	cases := map[string]string{
+		`tags=['a', 'b'`:   "unterminated array",
+		`obj={a 1}`:        "expected ':'",
+		`msg='open`:        "unterminated string",
+		`n=abc::int`:       "not a valid int",
+		`n=1::decimal`:     "unknown type suffix",
+		`tags=[1]::string`: "only allowed on scalar",
+		`a='x' b=1`:        "missing comma",
+		`k='""""""\q'`:     `invalid escape in string '""""""\q'`,
+	}
+	for raw, want := range cases {
+		_, err := ParseResult(raw)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", raw, want, err)
+		}
+		if !strings.Contains(err.Error(), "position") {
+			t.Fatalf("%s: expected error with position, got %v", raw, err)
+		}
+	}
+}
+
+func TestFormatResult_RoundTrip(t *testing.T) {
+	in := []Assignment{
+		{Key: "approved", Value: true},
+		{Key: "code", Value: "007"},
+		{Key: "flag", Value: "true"},
+		{Key: "limit", Value: 500},
+		{Key: "rate", Value: 2.0},
+		{Key: "msg", Value: "it's \"quoted\", with comma\n"},
+		{Key: "note", Value: nil},
+		{Key: "tags", Value: []any{"a", 1, []any{}}},
+		{Key: "meta", Value: map[string]any{"x y": map[string]any{"z": false}, "n": 1.25}},
+	}
+
+	out, err := ParseResult(FormatResult(in))
+	if err != nil {
+		t.Fatalf("format %q: %v", FormatResult(in), err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("round trip mismatch:\ngot  %#v\nwant %#v", out, in)
+	}
+}
+
+func TestParseResult_Expressions(t *testing.T) {
+	assignments, err := ParseResult(`limit=$(income * (ratio + 1)), note=$("a, b)"), plain=1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 3 || assignments[0].Expr == nil || assignments[1].Expr == nil || assignments[2].Expr != nil {
+		t.Fatalf("unexpected assignments: %#v", assignments)
+	}
+	if got := FormatResult(assignments); got != `limit=$(income * (ratio + 1)),note=$("a, b)"),plain=1` {
+		t.Fatalf("unexpected format: %s", got)
+	}
+
+	for raw, want := range map[string]string{
+		`limit=$(income*3`:   "unterminated expression",
+		`limit=$(len(name))`: "function calls are not allowed",
+		`limit=$(a.b)`:       "dot access",
+	} {
+		_, err := ParseResult(raw)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", raw, want, err)
+		}
+	}
+}
+
+func TestParseResult_Operators(t *testing.T) {
+	assignments, err := ParseResult(`reasons+=LOW_SCORE, score += 15, -temp_flag, decision.codes+=['A', 'B'], -old.path`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Assignment{
+		{Key: "reasons", Value: "LOW_SCORE", Op: OpAdd},
+		{Key: "score", Value: 15, Op: OpAdd},
+		{Key: "temp_flag", Op: OpUnset},
+		{Key: "decision.codes", Value: []any{"A", "B"}, Path: []string{"decision", "codes"}, Op: OpAdd},
+		{Key: "old.path", Path: []string{"old", "path"}, Op: OpUnset},
+	}
+	if !reflect.DeepEqual(assignments, want) {
+		t.Fatalf("unexpected assignments:\ngot  %#v\nwant %#v", assignments, want)
+	}
+	if got := FormatResult(assignments); got != `reasons+='LOW_SCORE',score+=15,-temp_flag,decision.codes+=['A','B'],-old.path` {
+		t.Fatalf("unexpected format: %s", got)
+	}
+
+	if _, err := ParseResult(`reasons+=null`); err == nil || !strings.Contains(err.Error(), "non-null") {
+		t.Fatalf("expected += null error, got %v", err)
+	}
+}
+
+func TestAccumulate_TypingRules(t *testing.T) {
+	cases := []struct {
+		name    string
+		cur     any
+		exists  bool
+		add     any
+		want    any
+		wantErr bool
+	}{
+		{"missing number", nil, false, 15, 15, false},
+		{"missing string starts list", nil, false, "LOW", []any{"LOW"}, false},
+		{"missing array copies", nil, false, []any{"A"}, []any{"A"}, false},
+		{"int plus int", 10, true, 5, 15, false},
+		{"float input plus int", 700.0, true, 15, 715.0, false},
+		{"list append", []any{"A"}, true, "B", []any{"A", "B"}, false},
+		{"list concat", []any{"A"}, true, []any{"B", "C"}, []any{"A", "B", "C"}, false},
+		{"string plus string", "A", true, "B", nil, true},
+		{"number plus string", 1, true, "B", nil, true},
+		{"add null", []any{}, true, nil, nil, true},
+	}
+	for _, tc := range cases {
+		got, err := accumulate(tc.cur, tc.exists, tc.add)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: expected %#v, got %#v", tc.name, tc.want, got)
+		}
+	}
+}
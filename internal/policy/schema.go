@@ -0,0 +1,341 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+)
+
+// InputField é a declaração de uma variavel de entrada da policy. No DOT vem de atributo de grafo:
+//
+//	input_score="number, min=300, max=850"
+//	input_segment="string, optional, enum=prime|standard"
+//
+// Campo declarado é obrigatório por padrão; "optional" libera a ausência (o tipo continua valendo se vier).
+type InputField struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Enum     []any    `json:"enum,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+}
+
+// InputSchema é a lista de campos declarados, ordenada por nome. Vazio = sem validação.
+type InputSchema []InputField
+
+var inputTypes = map[string]struct{}{
+	"any": {}, "string": {}, "number": {}, "int": {}, "bool": {}, "list": {}, "object": {},
+}
+
+// InputError é um campo do input que nao bate com o schema.
+type InputError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// InputErrors junta todos os campos invalidos numa validação só.
+type InputErrors []*InputError
+
+func (e InputErrors) Error() string {
+	parts := make([]string, 0, len(e))
+	for _, fe := range e {
+		parts = append(parts, fe.Field+": "+fe.Message)
+	}
+	return "invalid input: " + strings.Join(parts, "; ")
+}
+
+// Validate confere o input contra o schema e devolve InputErrors com todos os problemas (nil se ok).
+// Campo fora do schema passa direto.
+func (s InputSchema) Validate(input map[string]any) error {
+	if errs := s.fieldErrors(input, lookupKey); len(errs) > 0 {
+		return InputErrors(errs)
+	}
+	return nil
+}
+
+// lookupKey lê a chave literal: no input, "a.b" é o nome do campo e nao um caminho.
+func lookupKey(vars map[string]any, name string) (any, bool) {
+	v, ok := vars[name]
+	return v, ok
+}
+
+// lookupDotted lê nome pontuado (decision.approved) no map aninhado, como os assignments do result gravam.
+func lookupDotted(vars map[string]any, name string) (any, bool) {
+	return lookupPath(vars, strings.Split(name, "."))
+}
+
+// fieldErrors confere cada campo declarado, lendo o valor com lookup (literal no input, pontuado no output).
+func (s InputSchema) fieldErrors(vars map[string]any, lookup func(map[string]any, string) (any, bool)) []*InputError {
+	var errs []*InputError
+	for _, f := range s {
+		v, ok := lookup(vars, f.Name)
+		if !ok || v == nil {
+			if f.Required {
+				errs = append(errs, &InputError{Field: f.Name, Message: "is required"})
+			}
+			continue
+		}
+		if msg := f.check(v); msg != "" {
+			errs = append(errs, &InputError{Field: f.Name, Message: msg})
+		}
+	}
+	return errs
+}
+
+func (f InputField) check(v any) string {
+	if !inputTypeMatches(f.Type, v) {
+		return fmt.Sprintf("expected %s, got %s", f.Type, inputTypeName(v))
+	}
+
+	if len(f.Enum) > 0 && !enumContains(f.Enum, v) {
+		opts := make([]string, 0, len(f.Enum))
+		for _, e := range f.Enum {
+			opts = append(opts, fmt.Sprint(e))
+		}
+		return fmt.Sprintf("must be one of [%s], got %v", strings.Join(opts, ", "), v)
+	}
+
+	if n, ok := eval.Number(v); ok {
+		if f.Min != nil && n < *f.Min {
+			return fmt.Sprintf("must be >= %s, got %v", formatNumber(*f.Min), v)
+		}
+		if f.Max != nil && n > *f.Max {
+			return fmt.Sprintf("must be <= %s, got %v", formatNumber(*f.Max), v)
+		}
+	}
+	return ""
+}
+
+func inputTypeMatches(typ string, v any) bool {
+	switch typ {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := eval.Number(v)
+		return ok
+	case "int":
+		n, ok := eval.Number(v)
+		return ok && n == math.Trunc(n)
+	case "bool":
+		_, ok := v.(bool)
+		return ok
+	case "list":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	}
+	return true
+}
+
+func inputTypeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "object"
+	}
+	if _, ok := eval.Number(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func enumContains(enum []any, v any) bool {
+	n, isNum := eval.Number(v)
+	for _, e := range enum {
+		if en, ok := eval.Number(e); ok && isNum {
+			if en == n {
+				return true
+			}
+			continue
+		}
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInputField lê o valor do atributo input_<name> ("number, optional, min=0, max=10, enum=1|2").
+func parseInputField(name, raw string) (InputField, error) {
+	f := InputField{Name: name, Required: true}
+	var enumRaw []string
+
+	for i, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if i == 0 {
+			f.Type = part
+			continue
+		}
+		key, val, hasVal := strings.Cut(part, "=")
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		switch {
+		case key == "required" && !hasVal:
+			f.Required = true
+		case key == "optional" && !hasVal:
+			f.Required = false
+		case (key == "min" || key == "max") && hasVal:
+			n, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return f, fmt.Errorf("%s must be a number (got %q)", key, val)
+			}
+			if key == "min" {
+				f.Min = &n
+			} else {
+				f.Max = &n
+			}
+		case key == "enum" && hasVal:
+			enumRaw = strings.Split(val, "|")
+		default:
+			return f, fmt.Errorf("unknown option %q (expected required, optional, min=, max= or enum=)", part)
+		}
+	}
+
+	for _, item := range enumRaw {
+		item = strings.TrimSpace(item)
+		if f.Type == "string" {
+			f.Enum = append(f.Enum, item)
+			continue
+		}
+		f.Enum = append(f.Enum, parseBare(item))
+	}
+
+	return f, validateInputField(f)
+}
+
+// validateInputField checa a coerencia da declaração (vale pro DOT e pro JSON).
+func validateInputField(f InputField) error {
+	if _, ok := inputTypes[f.Type]; !ok {
+		return fmt.Errorf("unknown type %q (expected any, string, number, int, bool, list or object)", f.Type)
+	}
+	numeric := f.Type == "number" || f.Type == "int"
+	if (f.Min != nil || f.Max != nil) && !numeric {
+		return fmt.Errorf("min/max only apply to number or int (type is %s)", f.Type)
+	}
+	if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+		return fmt.Errorf("min %s is greater than max %s", formatNumber(*f.Min), formatNumber(*f.Max))
+	}
+	if len(f.Enum) > 0 && f.Type != "string" && !numeric {
+		return fmt.Errorf("enum only applies to string, number or int (type is %s)", f.Type)
+	}
+	for _, e := range f.Enum {
+		if !inputTypeMatches(f.Type, e) {
+			return fmt.Errorf("enum value %v is not a valid %s", e, f.Type)
+		}
+	}
+	return nil
+}
+
+// formatInputField é o inverso do parseInputField, usado no ToDOT.
+func formatInputField(f InputField) string {
+	parts := []string{f.Type}
+	if !f.Required {
+		parts = append(parts, "optional")
+	}
+	if f.Min != nil {
+		parts = append(parts, "min="+formatNumber(*f.Min))
+	}
+	if f.Max != nil {
+		parts = append(parts, "max="+formatNumber(*f.Max))
+	}
+	if len(f.Enum) > 0 {
+		items := make([]string, 0, len(f.Enum))
+		for _, e := range f.Enum {
+			items = append(items, fmt.Sprint(e))
+		}
+		parts = append(parts, "enum="+strings.Join(items, "|"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// applySchemas monta Policy.Inputs/Outputs a partir dos atributos input_<name>/output_<name> do grafo.
+// O front-end JSON já preenche direto, por isso aqui só acrescenta.
+func applySchemas(p *Policy, attrs map[string]string, src *sourceIndex, errs *CompileErrors) {
+	p.Inputs = append(p.Inputs, schemaFromAttrs("input", attrs, src, errs)...)
+	p.Outputs = append(p.Outputs, schemaFromAttrs("output", attrs, src, errs)...)
+}
+
+// schemaFromAttrs lê os atributos <kind>_<name> do grafo (input_score, output_approved...).
+func schemaFromAttrs(kind string, attrs map[string]string, src *sourceIndex, errs *CompileErrors) InputSchema {
+	prefix := kind + "_"
+	keys := make([]string, 0)
+	for k := range attrs {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var out InputSchema
+	for _, k := range keys {
+		name := strings.TrimPrefix(k, prefix)
+		if name == "" {
+			errs.add(src.graphAttr(k), CompileError{Attr: k, Message: fmt.Sprintf("%s attribute %q has empty name", kind, k)})
+			continue
+		}
+		f, err := parseInputField(name, attrs[k])
+		if err != nil {
+			errs.add(src.graphAttr(k), CompileError{Attr: k, Message: fmt.Sprintf("%s %s: %v", kind, name, err)})
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func (s InputSchema) varTypes() map[string]string {
+	out := make(map[string]string, len(s))
+	for _, f := range s {
+		out[f.Name] = f.Type
+	}
+	return out
+}
+
+// typeCheckConds recompila as conds com os tipos do schema, pra pegar no compile coisas como
+// age >= "eighteen" ou approved > 3, e com as constantes da policy inlined.
+// O programa novo substitui o compilado sem tipo.
+func typeCheckConds(p *Policy, errs *CompileErrors) {
+	if len(p.Inputs) == 0 && len(p.Constants) == 0 {
+		return
+	}
+	opts := []eval.CompileOption{eval.WithConstants(p.Constants)}
+	if len(p.Inputs) > 0 {
+		opts = append(opts, eval.WithVarTypes(p.Inputs.varTypes()))
+	}
+
+	for _, id := range sortedNodeIDs(p) {
+		node := p.Nodes[id]
+		for i, edge := range node.Outgoing {
+			if edge.Cond == "" || edge.CompiledCond == nil {
+				continue // cond vazia ou que já falhou no compile sem tipo
+			}
+			compiled, err := eval.Compile(edge.Cond, opts...)
+			if err != nil {
+				errs.add(edge.Pos, CompileError{
+					Node:    id,
+					Edge:    &EdgeRef{From: id, To: edge.To},
+					Attr:    "cond",
+					Message: fmt.Sprintf("edge %s -> %s cond %q type error: %v", id, edge.To, edge.Cond, err),
+				})
+				continue
+			}
+			node.Outgoing[i].CompiledCond = compiled
+		}
+	}
+}
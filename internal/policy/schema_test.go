@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const schemaPolicyDOT = `digraph {
+	input_age="int, min=18, max=120";
+	input_score="number, min=300, max=850";
+	input_segment="string, optional, enum=prime|standard";
+	input_vip="bool, optional";
+	start -> ok [cond="age>=18"];
+	ok [result="approved=true"];
+}`
+
+func TestCompiler_ParsesInputSchema(t *testing.T) {
+	p, err := NewCompiler().Compile(schemaPolicyDOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Inputs) != 4 {
+		t.Fatalf("expected 4 input fields, got %#v", p.Inputs)
+	}
+	age := p.Inputs[0]
+	if age.Name != "age" || age.Type != "int" || !age.Required || *age.Min != 18 || *age.Max != 120 {
+		t.Fatalf("unexpected age field: %#v", age)
+	}
+	seg := p.Inputs[2]
+	if seg.Name != "segment" || seg.Required || len(seg.Enum) != 2 || seg.Enum[0] != "prime" {
+		t.Fatalf("unexpected segment field: %#v", seg)
+	}
+}
+
+func TestInputSchema_ValidateAggregatesAllErrors(t *testing.T) {
+	p, err := NewCompiler().Compile(schemaPolicyDOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Inputs.Validate(map[string]any{"age": 30.0, "score": 720.0, "extra": "ok"}); err != nil {
+		t.Fatalf("expected valid input, got %v", err)
+	}
+
+	err = p.Inputs.Validate(map[string]any{"age": 17.5, "score": "720", "segment": "gold", "vip": nil})
+	var inputErrs InputErrors
+	if !errors.As(err, &inputErrs) || len(inputErrs) != 3 {
+		t.Fatalf("expected 3 input errors, got %v", err)
+	}
+	want := []string{
+		"age: expected int, got number",
+		"score: expected number, got string",
+		"segment: must be one of [prime, standard], got gold",
+	}
+	for i, fe := range inputErrs {
+		if got := fe.Field + ": " + fe.Message; got != want[i] {
+			t.Fatalf("error %d: expected %q, got %q", i, want[i], got)
+		}
+	}
+
+	err = p.Inputs.Validate(map[string]any{"age": 10, "score": 900})
+	if err == nil || !strings.Contains(err.Error(), "age: must be >= 18, got 10; score: must be <= 850, got 900") {
+		t.Fatalf("unexpected range errors: %v", err)
+	}
+}
+
+func TestInputSchema_DottedNameIsReadLiterally(t *testing.T) {
+	schema := InputSchema{{Name: "applicant.age", Type: "number", Required: true}}
+
+	if err := schema.Validate(map[string]any{"applicant.age": 30.0}); err != nil {
+		t.Fatalf("expected literal key to satisfy the schema, got %v", err)
+	}
+	err := schema.Validate(map[string]any{"applicant": map[string]any{"age": 30.0}})
+	if err == nil || err.Error() != "invalid input: applicant.age: is required" {
+		t.Fatalf("nested map must not satisfy a literal input field, got %v", err)
+	}
+}
+
+func TestCompiler_RejectsInvalidInputSchema(t *testing.T) {
+	_, err := NewCompiler().Compile(`digraph {
+		input_a="decimal";
+		input_b="string, min=1";
+		input_c="int, enum=1|x";
+		input_d="number, min=5, max=1";
+		input_e="bool, nullable";
+		start [result="ok=true"];
+	}`)
+	var errs CompileErrors
+	if !errors.As(err, &errs) || len(errs) != 5 {
+		t.Fatalf("expected 5 compile errors, got %v", err)
+	}
+	if errs[0].Attr != "input_a" || errs[0].Line != 2 || !strings.Contains(errs[0].Message, `unknown type "decimal"`) {
+		t.Fatalf("unexpected first error: %#v", errs[0])
+	}
+}
+
+func TestCompiler_TypeChecksCondsAgainstDeclaredInputs(t *testing.T) {
+	_, err := NewCompiler().Compile(`digraph {
+	input_age="int";
+	input_approved="bool";
+	start -> adult [cond="age >= \"eighteen\""];
+	start -> ok [cond="approved > 3"];
+	start -> other [cond="flag == true"];
+}`)
+	var errs CompileErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected 2 compile errors, got %v", err)
+	}
+	first := errs[0]
+	if first.Attr != "cond" || first.Edge == nil || first.Edge.To != "adult" || first.Line != 4 || first.Column != 2 {
+		t.Fatalf("unexpected first error: %#v", first)
+	}
+	if !strings.Contains(first.Message, "mismatched types number and string") {
+		t.Fatalf("unexpected message: %s", first.Message)
+	}
+	if errs[1].Edge.To != "ok" || !strings.Contains(errs[1].Message, "mismatched types bool and int") {
+		t.Fatalf("unexpected second error: %#v", errs[1])
+	}
+}
@@ -0,0 +1,451 @@
+package policy
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Pos é linha/coluna (1-based) no texto da policy. Zero quer dizer desconhecido.
+type Pos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+// stmtLoc guarda onde um node/edge stmt aparece e onde está cada atributo dele.
+// Pra edge, hops[i] é a posição do nó de origem do i-esimo salto da chain.
+// id é o texto cru do primeiro operando (nó, origem da aresta ou nome do subgraph; "" pra subgraph anonimo).
+type stmtLoc struct {
+	id    string
+	pos   Pos
+	hops  []Pos
+	attrs map[string]Pos
+}
+
+// sourceIndex é um indice de posições do DOT.
+// O gographviz nao expõe posição no AST, entao aqui tem um scanner minimo que segue a mesma gramatica
+// e registra os stmts na mesma ordem em que o walkStmtList visita o AST.
+// O casamento é pela ordem, mas cada acesso confere o ID do stmt do AST com o que o scanner leu: se o
+// scanner se perdeu (construção que ele nao modela), o stmt fica sem posição em vez de herdar a de outro.
+// Nunca quebra o compile. Um desvio que por acaso caia num stmt com o mesmo ID passa batido.
+//
+// Atenção na manutenção: o scanner é uma cópia à mão da gramatica do gographviz (a versão do go.mod).
+// Subiu o gographviz, mudou a gramatica ou mudou a
+// ordem do walkStmtList (subgraph, chain de aresta, attr_stmt)? Tem que mexer aqui junto; o source_test
+// cobre subgraph, comentario, operando {a b} e chain, e quebra se a ordem sair de sincronia.
+type sourceIndex struct {
+	nodes      []stmtLoc
+	edges      []stmtLoc
+	subgraphs  []stmtLoc // pos do subgraph e, em attrs, os atributos de grafo de dentro dele (namespace, guard...)
+	graphAttrs map[string]Pos
+}
+
+// node, edge e subgraph devolvem o i-esimo stmt do tipo, ou stmtLoc{} se o ID nao bate com o do AST.
+func (ix *sourceIndex) node(i int, id string) stmtLoc {
+	if ix == nil {
+		return stmtLoc{}
+	}
+	return pick(ix.nodes, i, id)
+}
+
+func (ix *sourceIndex) edge(i int, id string) stmtLoc {
+	if ix == nil {
+		return stmtLoc{}
+	}
+	return pick(ix.edges, i, id)
+}
+
+func (ix *sourceIndex) subgraph(i int, id string) stmtLoc {
+	if ix == nil {
+		return stmtLoc{}
+	}
+	return pick(ix.subgraphs, i, id)
+}
+
+func pick(locs []stmtLoc, i int, id string) stmtLoc {
+	if i >= len(locs) {
+		return stmtLoc{}
+	}
+	l := locs[i]
+	// subgraph anonimo: o gographviz inventa um "anon<n>" que nao existe no texto
+	if l.id != id && (l.id != "" || !strings.HasPrefix(id, "anon")) {
+		return stmtLoc{}
+	}
+	return l
+}
+
+func (ix *sourceIndex) graphAttr(name string) Pos {
+	if ix == nil {
+		return Pos{}
+	}
+	return ix.graphAttrs[name]
+}
+
+func (l stmtLoc) attr(name string) Pos {
+	if p, ok := l.attrs[name]; ok {
+		return p
+	}
+	return l.pos
+}
+
+func (l stmtLoc) hop(i int) Pos {
+	if i < len(l.hops) {
+		return l.hops[i]
+	}
+	return l.pos
+}
+
+var parseErrPosRe = regexp.MustCompile(`line=(\d+), column=(\d+)`)
+
+// parseErrorPos extrai a posição da mensagem de erro do gographviz ("Pos(offset=.., line=.., column=..)").
+func parseErrorPos(err error) Pos {
+	m := parseErrPosRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return Pos{}
+	}
+	line, _ := strconv.Atoi(m[1])
+	col, _ := strconv.Atoi(m[2])
+	return Pos{Line: line, Column: col}
+}
+
+const (
+	tokID byte = iota + 1
+	tokEdgeOp
+	tokPunct
+)
+
+type dotToken struct {
+	kind byte
+	text string
+	pos  Pos
+}
+
+func indexSource(src string) *sourceIndex {
+	ix := &sourceIndex{graphAttrs: map[string]Pos{}}
+	s := &sourceScanner{toks: lexDOT(src), ix: ix}
+	s.graph()
+	return ix
+}
+
+type sourceScanner struct {
+	toks []dotToken
+	i    int
+	ix   *sourceIndex
+	open []int // subgraphs abertos (indice em ix.subgraphs), do de fora pro de dentro
+}
+
+// subgraphAttr registra a posição de um atributo de grafo escrito dentro do subgraph aberto mais de dentro.
+func (s *sourceScanner) subgraphAttr(name string, p Pos) {
+	if len(s.open) == 0 {
+		return
+	}
+	s.ix.subgraphs[s.open[len(s.open)-1]].attrs[name] = p
+}
+
+func (s *sourceScanner) peek(offset int) dotToken {
+	if s.i+offset >= len(s.toks) {
+		return dotToken{}
+	}
+	return s.toks[s.i+offset]
+}
+
+func (s *sourceScanner) next() dotToken {
+	t := s.peek(0)
+	if s.i < len(s.toks) {
+		s.i++
+	}
+	return t
+}
+
+func (s *sourceScanner) isPunct(offset int, p string) bool {
+	t := s.peek(offset)
+	return t.kind == tokPunct && t.text == p
+}
+
+func (s *sourceScanner) isKeyword(offset int, kw string) bool {
+	t := s.peek(offset)
+	return t.kind == tokID && strings.EqualFold(t.text, kw)
+}
+
+func (s *sourceScanner) graph() {
+	if s.isKeyword(0, "strict") {
+		s.next()
+	}
+	s.next() // graph | digraph
+	if s.peek(0).kind == tokID {
+		s.next()
+	}
+	if !s.isPunct(0, "{") {
+		return
+	}
+	s.next()
+	s.stmtList(true, true)
+}
+
+// stmtList consome stmts até o "}" correspondente.
+// record=false é usado pra subgraph dentro de edge stmt, que o walkStmtList nao visita.
+func (s *sourceScanner) stmtList(top, record bool) {
+	for s.peek(0).kind != 0 && !s.isPunct(0, "}") {
+		start := s.i
+		s.stmt(top, record)
+		for s.isPunct(0, ";") || s.isPunct(0, ",") {
+			s.next()
+		}
+		if s.i == start {
+			s.next() // token inesperado, pula pra nao travar
+		}
+	}
+	if s.isPunct(0, "}") {
+		s.next()
+	}
+}
+
+func (s *sourceScanner) stmt(top, record bool) {
+	t := s.peek(0)
+
+	if t.kind == tokID && s.isPunct(1, "[") &&
+		(strings.EqualFold(t.text, "graph") || strings.EqualFold(t.text, "node") || strings.EqualFold(t.text, "edge")) {
+		s.next()
+		attrs := s.attrList()
+		if record && strings.EqualFold(t.text, "graph") {
+			for k, p := range attrs {
+				if top {
+					s.ix.graphAttrs[k] = p
+				} else {
+					s.subgraphAttr(k, p)
+				}
+			}
+		}
+		return
+	}
+
+	if t.kind == tokID && s.isPunct(1, "=") {
+		s.next()
+		s.next()
+		s.next()
+		switch {
+		case top && record:
+			s.ix.graphAttrs[unquote(t.text)] = t.pos
+		case record:
+			s.subgraphAttr(unquote(t.text), t.pos)
+		}
+		return
+	}
+
+	subgraphs := len(s.ix.subgraphs)
+	first, id, isNode, ok := s.operand(record)
+	if !ok {
+		return
+	}
+
+	if s.peek(0).kind != tokEdgeOp {
+		if !isNode {
+			return
+		}
+		attrs := s.attrList()
+		if record {
+			s.ix.nodes = append(s.ix.nodes, stmtLoc{id: id, pos: first, attrs: attrs})
+		}
+		return
+	}
+
+	// subgraph como operando de aresta nao passa pelo enterSubgraph
+	s.ix.subgraphs = s.ix.subgraphs[:subgraphs]
+	loc := stmtLoc{id: id, pos: first, hops: []Pos{first}}
+	for s.peek(0).kind == tokEdgeOp {
+		s.next()
+		p, _, _, ok := s.operand(false)
+		if !ok {
+			break
+		}
+		loc.hops = append(loc.hops, p)
+	}
+	loc.hops = loc.hops[:len(loc.hops)-1]
+	loc.attrs = s.attrList()
+	if record {
+		s.ix.edges = append(s.ix.edges, loc)
+	}
+}
+
+// operand consome um node_id (id[:port[:compass]]) ou um subgraph e devolve a posição e o ID cru dele.
+func (s *sourceScanner) operand(record bool) (pos Pos, id string, isNode bool, ok bool) {
+	t := s.peek(0)
+	if s.isPunct(0, "{") || s.isKeyword(0, "subgraph") {
+		if s.isKeyword(0, "subgraph") {
+			s.next()
+			if s.peek(0).kind == tokID {
+				id = s.next().text
+			}
+		}
+		if !s.isPunct(0, "{") {
+			return t.pos, id, false, true
+		}
+		s.next()
+		if !record {
+			s.stmtList(false, false)
+			return t.pos, id, false, true
+		}
+		s.open = append(s.open, len(s.ix.subgraphs))
+		s.ix.subgraphs = append(s.ix.subgraphs, stmtLoc{id: id, pos: t.pos, attrs: map[string]Pos{}})
+		s.stmtList(false, true)
+		s.open = s.open[:len(s.open)-1]
+		return t.pos, id, false, true
+	}
+
+	if t.kind != tokID {
+		return Pos{}, "", false, false
+	}
+	s.next()
+	for i := 0; i < 2 && s.isPunct(0, ":") && s.peek(1).kind == tokID; i++ {
+		s.next()
+		s.next()
+	}
+	return t.pos, t.text, true, true
+}
+
+func (s *sourceScanner) attrList() map[string]Pos {
+	var attrs map[string]Pos
+	for s.isPunct(0, "[") {
+		s.next()
+		for s.peek(0).kind != 0 && !s.isPunct(0, "]") {
+			t := s.next()
+			if t.kind != tokID {
+				continue
+			}
+			if attrs == nil {
+				attrs = map[string]Pos{}
+			}
+			attrs[unquote(t.text)] = t.pos
+			if s.isPunct(0, "=") {
+				s.next()
+				s.next()
+			}
+		}
+		if s.isPunct(0, "]") {
+			s.next()
+		}
+	}
+	return attrs
+}
+
+// lexDOT quebra o DOT em tokens com posição, ignorando comentarios.
+func lexDOT(src string) []dotToken {
+	rs := []rune(src)
+	var out []dotToken
+	line, col := 1, 1
+	lineStart := true
+
+	advance := func(n int) {
+		for k := 0; k < n; k++ {
+			if rs[0] == '\n' {
+				line++
+				col = 1
+				lineStart = true
+			} else {
+				col++
+			}
+			rs = rs[1:]
+		}
+	}
+
+	for len(rs) > 0 {
+		r := rs[0]
+		pos := Pos{Line: line, Column: col}
+
+		switch {
+		case r == '\n':
+			advance(1)
+			continue
+		case unicode.IsSpace(r):
+			advance(1)
+			continue
+		case r == '#' && lineStart:
+			for len(rs) > 0 && rs[0] != '\n' {
+				advance(1)
+			}
+			continue
+		case r == '/' && len(rs) > 1 && rs[1] == '/':
+			for len(rs) > 0 && rs[0] != '\n' {
+				advance(1)
+			}
+			continue
+		case r == '/' && len(rs) > 1 && rs[1] == '*':
+			advance(2)
+			for len(rs) > 0 && !(rs[0] == '*' && len(rs) > 1 && rs[1] == '/') {
+				advance(1)
+			}
+			advance(min(2, len(rs)))
+			continue
+		}
+		lineStart = false
+
+		switch {
+		case r == '"':
+			n := 1
+			for n < len(rs) && rs[n] != '"' {
+				if rs[n] == '\\' {
+					n++
+				}
+				n++
+			}
+			if n < len(rs) {
+				n++
+			}
+			if n > len(rs) {
+				n = len(rs)
+			}
+			out = append(out, dotToken{kind: tokID, text: string(rs[:n]), pos: pos})
+			advance(n)
+
+		case r == '<':
+			depth, n := 0, 0
+			for n < len(rs) {
+				if rs[n] == '<' {
+					depth++
+				} else if rs[n] == '>' {
+					depth--
+					if depth == 0 {
+						n++
+						break
+					}
+				}
+				n++
+			}
+			out = append(out, dotToken{kind: tokID, text: string(rs[:n]), pos: pos})
+			advance(n)
+
+		case r == '-' && len(rs) > 1 && (rs[1] == '>' || rs[1] == '-'):
+			out = append(out, dotToken{kind: tokEdgeOp, text: string(rs[:2]), pos: pos})
+			advance(2)
+
+		case r == '-' && len(rs) > 1 && (unicode.IsDigit(rs[1]) || rs[1] == '.'):
+			n := 1
+			for n < len(rs) && (unicode.IsDigit(rs[n]) || rs[n] == '.') {
+				n++
+			}
+			out = append(out, dotToken{kind: tokID, text: string(rs[:n]), pos: pos})
+			advance(n)
+
+		case isDOTIDRune(r):
+			n := 0
+			for n < len(rs) && isDOTIDRune(rs[n]) {
+				n++
+			}
+			out = append(out, dotToken{kind: tokID, text: string(rs[:n]), pos: pos})
+			advance(n)
+
+		default:
+			out = append(out, dotToken{kind: tokPunct, text: string(r), pos: pos})
+			advance(1)
+		}
+	}
+
+	return out
+}
+
+func isDOTIDRune(r rune) bool {
+	return r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r) || r > unicode.MaxASCII
+}
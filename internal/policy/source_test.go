@@ -0,0 +1,46 @@
+package policy
+
+import "testing"
+
+func TestIndexSource_FollowsWalkOrderAcrossSubgraphsAndComments(t *testing.T) {
+	ix := indexSource(`digraph {
+  // comentario com -> e [cond]
+  entry="a";
+  subgraph cluster_x {
+    a [result="x=1"]; /* bloco
+    b -> c */
+    a -> b [cond="x==1"]
+  }
+  b -> {c d} [priority=1]
+  c
+}`)
+
+	if got := ix.graphAttr("entry"); got != (Pos{Line: 3, Column: 3}) {
+		t.Fatalf("unexpected entry pos: %#v", got)
+	}
+	if len(ix.nodes) != 2 || ix.nodes[0].pos != (Pos{Line: 5, Column: 5}) || ix.nodes[1].pos != (Pos{Line: 10, Column: 3}) {
+		t.Fatalf("unexpected node locs: %#v", ix.nodes)
+	}
+	if len(ix.edges) != 2 {
+		t.Fatalf("expected 2 edge stmts (subgraph operand content ignored), got %#v", ix.edges)
+	}
+	if ix.edges[0].attr("cond") != (Pos{Line: 7, Column: 13}) {
+		t.Fatalf("unexpected cond pos: %#v", ix.edges[0].attrs)
+	}
+	if ix.edges[1].attr("priority") != (Pos{Line: 9, Column: 15}) {
+		t.Fatalf("unexpected priority pos: %#v", ix.edges[1].attrs)
+	}
+}
+
+func TestIndexSource_EdgeChainRecordsEveryHop(t *testing.T) {
+	ix := indexSource(`digraph {
+  a -> b -> c [cond="x==1"]
+}`)
+
+	if len(ix.edges) != 1 || len(ix.edges[0].hops) != 2 {
+		t.Fatalf("expected one chain stmt with 2 hops, got %#v", ix.edges)
+	}
+	if ix.edges[0].hops[0] != (Pos{Line: 2, Column: 3}) || ix.edges[0].hops[1] != (Pos{Line: 2, Column: 8}) {
+		t.Fatalf("unexpected hop positions: %#v", ix.edges[0].hops)
+	}
+}
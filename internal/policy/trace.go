@@ -1,22 +1,57 @@
 package policy
 
+import "github.com/awmpietro/golang-policy-inference-case/internal/policy/eval"
+
 type ExecutionTrace struct {
-	StartNode   string      `json:"start_node"`
-	VisitedPath []string    `json:"visited_path"`
-	Steps       []TraceStep `json:"steps"`
-	Terminated  string      `json:"terminated"`
+	StartNode   string         `json:"start_node"`
+	Derived     []DerivedTrace `json:"derived,omitempty"`
+	VisitedPath []string       `json:"visited_path"`
+	Steps       []TraceStep    `json:"steps"`
+	Terminated  string         `json:"terminated"`
+	// Ambiguous (modo evaluate-all): em algum nó visitado mais de uma aresta casou; AmbiguousNodes diz quais.
+	Ambiguous      bool     `json:"ambiguous,omitempty"`
+	AmbiguousNodes []string `json:"ambiguous_nodes,omitempty"`
 }
 
 type TraceStep struct {
-	NodeID         string      `json:"node_id"`
-	DurationMicros int64       `json:"duration_micros"`
-	ChosenNext     string      `json:"chosen_next,omitempty"`
-	Edges          []EdgeTrace `json:"edges,omitempty"`
+	NodeID         string        `json:"node_id"`
+	DurationMicros int64         `json:"duration_micros"`
+	ChosenNext     string        `json:"chosen_next,omitempty"`
+	Ambiguous      bool          `json:"ambiguous,omitempty"`
+	Call           *CallTrace    `json:"call,omitempty"`
+	Fanout         *FanoutTrace  `json:"fanout,omitempty"`
+	Results        []ResultTrace `json:"results,omitempty"`
+	Edges          []EdgeTrace   `json:"edges,omitempty"`
+}
+
+// ResultTrace é um assignment aplicado no nó, com o valor antes e depois. Existed/Exists separam
+// chave ausente de chave com null (os dois viram before/after null no JSON).
+type ResultTrace struct {
+	Key     string `json:"key"`
+	Op      string `json:"op"`
+	Before  any    `json:"before"`
+	Existed bool   `json:"existed"`
+	After   any    `json:"after"`
+	Exists  bool   `json:"exists"`
 }
 
 type EdgeTrace struct {
-	To      string `json:"to"`
-	Cond    string `json:"cond"`
-	Matched bool   `json:"matched"`
-	Error   string `json:"error,omitempty"`
+	To       string `json:"to"`
+	Cond     string `json:"cond"`
+	Order    int    `json:"order"`
+	Priority *int   `json:"priority,omitempty"`
+	Matched  bool   `json:"matched"`
+	// AlsoMatched (modo evaluate-all): aresta avaliada depois da escolhida que também casaria.
+	AlsoMatched bool   `json:"also_matched,omitempty"`
+	Default     bool   `json:"default,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// Explain/Why (modo explain): a cond quebrada por comparação e a frase curta do porque.
+	Explain *eval.Explanation `json:"explain,omitempty"`
+	Why     string            `json:"why,omitempty"`
+}
+
+// CallTrace é a execução da sub-policy de um nó call=..., com o trace dela aninhado.
+type CallTrace struct {
+	Ref   string          `json:"ref"`
+	Trace *ExecutionTrace `json:"trace,omitempty"`
 }
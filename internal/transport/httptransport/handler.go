@@ -1,7 +1,9 @@
 package httptransport
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/awmpietro/golang-policy-inference-case/internal/app"
@@ -28,35 +30,118 @@ func (h *Handler) Infer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if in.Debug {
-		out, trace, info, err := h.svc.InferWithTraceAndOptions(in.PolicyDOT, in.Input, in.Options())
+	if in.TraceRequested() {
+		out, trace, info, err := h.svc.InferWithTraceContext(r.Context(), in.PolicySource(), in.Input, in.Options())
 		if err != nil {
-			writeJSON(w, http.StatusBadRequest, inferErrorBody(err, trace, info))
+			var explanations []string
+			if in.Explain {
+				explanations = trace.Explanations()
+			}
+			if !in.Debug {
+				trace = nil
+			}
+			body := inferErrorBody(err, trace, info)
+			if len(explanations) > 0 {
+				body["explanations"] = explanations
+			}
+			writeJSON(w, inferStatus(err), body)
 			return
 		}
-		writeJSON(w, http.StatusOK, inferdto.InferResponse{Output: out, Trace: trace, Policy: info})
+		writeJSON(w, http.StatusOK, inferdto.NewInferResponse(in, out, trace, info))
 		return
 	}
 
-	out, info, err := h.svc.InferWithOptions(in.PolicyDOT, in.Input, in.Options())
+	out, info, err := h.svc.InferContext(r.Context(), in.PolicySource(), in.Input, in.Options())
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, inferErrorBody(err, nil, info))
+		writeJSON(w, inferStatus(err), inferErrorBody(err, nil, info))
 		return
 	}
 	writeJSON(w, http.StatusOK, inferdto.InferResponse{Output: out, Policy: info})
 }
 
+// Introspect devolve as variaveis de input que a policy lê, pra cliente montar form/validação.
+func (h *Handler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var in inferdto.InferRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid json", "details": err.Error()})
+		return
+	}
+
+	req, info, err := h.svc.Introspect(in.PolicySource(), in.Options())
+	if err != nil {
+		body := inferErrorBody(err, nil, info)
+		body["error"] = "introspect failed"
+		writeJSON(w, http.StatusBadRequest, body)
+		return
+	}
+	writeJSON(w, http.StatusOK, inferdto.IntrospectResponse{Inputs: req, Policy: info})
+}
+
+// Counterfactual devolve as menores mudanças de input que levam a execução até o alvo (nó ou output).
+func (h *Handler) Counterfactual(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var in inferdto.CounterfactualRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid json", "details": err.Error()})
+		return
+	}
+
+	res, info, err := h.svc.Counterfactual(r.Context(), in.PolicySource(), in.Input, in.Target, in.Options())
+	if err != nil {
+		body := inferErrorBody(err, nil, info)
+		body["error"] = "counterfactual failed"
+		writeJSON(w, inferStatus(err), body)
+		return
+	}
+	writeJSON(w, http.StatusOK, inferdto.CounterfactualResponse{CounterfactualResult: *res, Policy: info})
+}
+
 func writeJSON(w http.ResponseWriter, status int, body any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(body)
 }
 
+// statusClientClosedRequest é o 499 do nginx: o cliente desistiu (ctx cancelado) antes da resposta.
+const statusClientClosedRequest = 499
+
+// inferStatus: execução que estourou o prazo vira 504, cancelada vira 499; o resto é erro do request.
+func inferStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	}
+	return http.StatusBadRequest
+}
+
 func inferErrorBody(err error, trace *app.InferTrace, info *app.PolicyInfo) map[string]any {
 	body := map[string]any{
 		"error":   "infer failed",
 		"details": err.Error(),
 	}
+	var compileErrs app.CompileErrors
+	if errors.As(err, &compileErrs) {
+		body["compile_errors"] = compileErrs
+	}
+	var inputErrs app.InputErrors
+	if errors.As(err, &inputErrs) {
+		body["input_errors"] = inputErrs
+	}
+	var outputErrs app.OutputErrors
+	if errors.As(err, &outputErrs) {
+		body["output_errors"] = outputErrs
+	}
 	if trace != nil {
 		body["trace"] = trace
 	}
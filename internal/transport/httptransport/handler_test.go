@@ -2,28 +2,42 @@ package httptransport
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/awmpietro/golang-policy-inference-case/internal/app"
+	"github.com/awmpietro/golang-policy-inference-case/internal/policy"
 )
 
 type svcStub struct {
 	inferWithOptionsFn         func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error)
 	inferWithTraceAndOptionsFn func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error)
+	introspectFn               func(policyDOT string, opts app.InferOptions) (*app.InputRequirements, *app.PolicyInfo, error)
+	counterfactualFn           func(policyDOT string, input map[string]any, target app.CounterfactualTarget, opts app.InferOptions) (*app.CounterfactualResult, *app.PolicyInfo, error)
 }
 
-func (s *svcStub) InferWithOptions(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
+func (s *svcStub) InferContext(_ context.Context, policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
 	return s.inferWithOptionsFn(policyDOT, input, opts)
 }
 
-func (s *svcStub) InferWithTraceAndOptions(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error) {
+func (s *svcStub) InferWithTraceContext(_ context.Context, policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error) {
 	return s.inferWithTraceAndOptionsFn(policyDOT, input, opts)
 }
 
+func (s *svcStub) Introspect(policyDOT string, opts app.InferOptions) (*app.InputRequirements, *app.PolicyInfo, error) {
+	return s.introspectFn(policyDOT, opts)
+}
+
+func (s *svcStub) Counterfactual(_ context.Context, policyDOT string, input map[string]any, target app.CounterfactualTarget, opts app.InferOptions) (*app.CounterfactualResult, *app.PolicyInfo, error) {
+	return s.counterfactualFn(policyDOT, input, target, opts)
+}
+
 func TestHandler_Infer_MethodNotAllowed(t *testing.T) {
 	h := NewHandler(&svcStub{
 		inferWithOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
@@ -147,3 +161,272 @@ func TestHandler_Infer_VersionedResponseIncludesPolicyInfo(t *testing.T) {
 		t.Fatalf("unexpected policy info: %#v", policy)
 	}
 }
+
+func TestHandler_Infer_CompileErrorsSerializedAsList(t *testing.T) {
+	h := NewHandler(&svcStub{
+		inferWithOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
+			return nil, nil, app.CompileErrors{
+				{Line: 2, Column: 5, Node: "ok", Attr: "result", Message: "node ok invalid result: boom"},
+				{Line: 3, Column: 9, Message: "edge start invalid cond: boom"},
+			}
+		},
+		inferWithTraceAndOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error) {
+			return nil, nil, nil, fmt.Errorf("unused")
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/infer", bytes.NewBufferString(`{"policy_dot":"digraph{}","input":{}}`))
+	rr := httptest.NewRecorder()
+	h.Infer(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rr.Code)
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	list, ok := out["compile_errors"].([]any)
+	if !ok || len(list) != 2 {
+		t.Fatalf("expected 2 compile errors, got %#v", out["compile_errors"])
+	}
+	first := list[0].(map[string]any)
+	if first["line"] != float64(2) || first["column"] != float64(5) || first["node"] != "ok" || first["attr"] != "result" {
+		t.Fatalf("unexpected compile error: %#v", first)
+	}
+}
+
+func TestHandler_Infer_InputErrorsSerializedAsList(t *testing.T) {
+	h := NewHandler(&svcStub{
+		inferWithOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
+			return nil, nil, app.InputErrors{
+				{Field: "score", Message: "is required"},
+				{Field: "segment", Message: "expected string, got number"},
+			}
+		},
+		inferWithTraceAndOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error) {
+			return nil, nil, nil, fmt.Errorf("unused")
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/infer", bytes.NewBufferString(`{"policy_dot":"digraph{}","input":{"segment":1}}`))
+	rr := httptest.NewRecorder()
+	h.Infer(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rr.Code)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	list, ok := out["input_errors"].([]any)
+	if !ok || len(list) != 2 || list[0].(map[string]any)["field"] != "score" {
+		t.Fatalf("expected 2 input errors, got %#v", out["input_errors"])
+	}
+}
+
+func TestHandler_Introspect_ReturnsRequirements(t *testing.T) {
+	var gotOpts app.InferOptions
+	h := NewHandler(&svcStub{
+		introspectFn: func(policyDOT string, opts app.InferOptions) (*app.InputRequirements, *app.PolicyInfo, error) {
+			gotOpts = opts
+			return &app.InputRequirements{All: []string{"age"}, Always: []string{"age"}, Sometimes: []string{}}, nil, nil
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/introspect", bytes.NewBufferString(`{"policy_dot":"digraph{}","entry":"renewal"}`))
+	rr := httptest.NewRecorder()
+	h.Introspect(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if gotOpts.Entry != "renewal" {
+		t.Fatalf("expected entry to be forwarded, got %+v", gotOpts)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	inputs, ok := out["inputs"].(map[string]any)
+	if !ok || fmt.Sprint(inputs["always"]) != "[age]" {
+		t.Fatalf("unexpected body: %s", rr.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/introspect", nil)
+	rr = httptest.NewRecorder()
+	h.Introspect(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", rr.Code)
+	}
+}
+
+func TestHandler_Infer_DeadlineExceededReturns504(t *testing.T) {
+	var gotTimeout time.Duration
+	h := NewHandler(&svcStub{
+		inferWithOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
+			gotTimeout = opts.Timeout
+			return nil, nil, fmt.Errorf("execution stopped before node %q: %w", "start", context.DeadlineExceeded)
+		},
+	})
+
+	body := `{"policy_dot":"digraph {}","input":{},"timeout_ms":50}`
+	req := httptest.NewRequest(http.MethodPost, "/infer", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	h.Infer(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status 504, got %d", rr.Code)
+	}
+	if gotTimeout != 50*time.Millisecond {
+		t.Fatalf("expected timeout_ms forwarded as 50ms, got %v", gotTimeout)
+	}
+}
+
+func TestHandler_Infer_CanceledIsNotAGatewayTimeout(t *testing.T) {
+	h := NewHandler(&svcStub{
+		inferWithOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
+			return nil, nil, fmt.Errorf("execution stopped before node %q: %w", "start", context.Canceled)
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/infer", bytes.NewBufferString(`{"policy_dot":"digraph {}","input":{}}`))
+	rr := httptest.NewRecorder()
+	h.Infer(rr, req)
+
+	if rr.Code != 499 {
+		t.Fatalf("expected status 499, got %d", rr.Code)
+	}
+}
+
+func TestHandler_Infer_EvaluateAllReturnsAmbiguousWithoutTrace(t *testing.T) {
+	var gotOpts app.InferOptions
+	h := NewHandler(&svcStub{
+		inferWithTraceAndOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error) {
+			gotOpts = opts
+			return map[string]any{"segment": "prime"}, &app.InferTrace{Ambiguous: true, AmbiguousNodes: []string{"start"}}, nil, nil
+		},
+	})
+
+	body := `{"policy_dot":"digraph {}","input":{},"evaluate_all":true}`
+	req := httptest.NewRequest(http.MethodPost, "/infer", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	h.Infer(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if !gotOpts.EvaluateAll {
+		t.Fatalf("expected evaluate_all forwarded to the service")
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["ambiguous"] != true || fmt.Sprint(resp["ambiguous_nodes"]) != "[start]" {
+		t.Fatalf("expected ambiguous decision in response, got %v", resp)
+	}
+	if _, ok := resp["trace"]; ok {
+		t.Fatalf("trace should only be returned with debug")
+	}
+}
+
+func TestHandler_Infer_ExplainReturnsSentencesWithoutTrace(t *testing.T) {
+	var gotOpts app.InferOptions
+	h := NewHandler(&svcStub{
+		inferWithTraceAndOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error) {
+			gotOpts = opts
+			trace := &app.InferTrace{Steps: []policy.TraceStep{{
+				NodeID: "start",
+				Edges: []policy.EdgeTrace{
+					{To: "approved", Cond: "score > 700", Why: "start -> approved not taken: score > 700 was false (score=650)"},
+					{To: "rejected", Default: true, Matched: true, Why: "start -> rejected taken: default edge"},
+				},
+			}}}
+			return map[string]any{"decision": "rejected"}, trace, nil, nil
+		},
+	})
+
+	body := `{"policy_dot":"digraph {}","input":{"score":650},"explain":true}`
+	req := httptest.NewRequest(http.MethodPost, "/infer", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	h.Infer(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if !gotOpts.Explain {
+		t.Fatalf("expected explain forwarded to the service")
+	}
+	var resp struct {
+		Explanations []string       `json:"explanations"`
+		Trace        map[string]any `json:"trace"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Explanations) != 2 || resp.Explanations[0] != "start -> approved not taken: score > 700 was false (score=650)" {
+		t.Fatalf("unexpected explanations: %v", resp.Explanations)
+	}
+	if resp.Trace != nil {
+		t.Fatalf("trace should only be returned with debug")
+	}
+}
+
+func TestHandler_Counterfactual_ForwardsTarget(t *testing.T) {
+	var gotTarget app.CounterfactualTarget
+	h := NewHandler(&svcStub{
+		counterfactualFn: func(policyDOT string, input map[string]any, target app.CounterfactualTarget, opts app.InferOptions) (*app.CounterfactualResult, *app.PolicyInfo, error) {
+			gotTarget = target
+			return &app.CounterfactualResult{
+				Target: target,
+				Options: []policy.Counterfactual{{
+					Path:     []string{"start", "approved"},
+					Changes:  []policy.InputChange{{Var: "score", Current: 650.0, Suggested: 701.0, Constraint: "score > 700"}},
+					Verified: true,
+				}},
+			}, nil, nil
+		},
+	})
+
+	body := `{"policy_dot":"digraph {}","input":{"score":650},"target":{"output":{"approved":true}}}`
+	req := httptest.NewRequest(http.MethodPost, "/counterfactual", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	h.Counterfactual(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if gotTarget.Output["approved"] != true {
+		t.Fatalf("expected target forwarded, got %+v", gotTarget)
+	}
+	var resp struct {
+		Options []struct {
+			Changes []map[string]any `json:"changes"`
+		} `json:"options"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Options) != 1 || resp.Options[0].Changes[0]["suggested"] != 701.0 {
+		t.Fatalf("unexpected body: %s", rr.Body.String())
+	}
+}
+
+func TestHandler_Counterfactual_InvalidTargetIsBadRequest(t *testing.T) {
+	h := NewHandler(&svcStub{
+		counterfactualFn: func(policyDOT string, input map[string]any, target app.CounterfactualTarget, opts app.InferOptions) (*app.CounterfactualResult, *app.PolicyInfo, error) {
+			return nil, nil, errors.New("counterfactual target requires node or output")
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/counterfactual", bytes.NewBufferString(`{"policy_dot":"digraph {}","input":{}}`))
+	rr := httptest.NewRecorder()
+	h.Counterfactual(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rr.Code)
+	}
+}
@@ -1,24 +1,101 @@
 package inferdto
 
-import "github.com/awmpietro/golang-policy-inference-case/internal/app"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/awmpietro/golang-policy-inference-case/internal/app"
+)
 
 type InferRequest struct {
-	PolicyDOT string         `json:"policy_dot"`
-	Input     map[string]any `json:"input"`
-	PolicyID  string         `json:"policy_id,omitempty"`
-	Version   string         `json:"policy_version,omitempty"`
-	Debug     bool           `json:"debug,omitempty"`
+	PolicyDOT    string          `json:"policy_dot"`
+	Policy       json.RawMessage `json:"policy,omitempty"`
+	PolicyFormat string          `json:"policy_format,omitempty"`
+	Input        map[string]any  `json:"input"`
+	PolicyID     string          `json:"policy_id,omitempty"`
+	Version      string          `json:"policy_version,omitempty"`
+	Entry        string          `json:"entry,omitempty"`
+	Debug        bool            `json:"debug,omitempty"`
+	// TimeoutMS é o orçamento de tempo da execução em milissegundos (0 = sem limite do request).
+	TimeoutMS int `json:"timeout_ms,omitempty"`
+	// EvaluateAll avalia todas as arestas dos nós visitados e devolve ambiguous na resposta.
+	EvaluateAll bool `json:"evaluate_all,omitempty"`
+	// Explain devolve, pra cada aresta avaliada, uma frase dizendo porque foi ou nao foi seguida.
+	Explain bool `json:"explain,omitempty"`
+}
+
+// PolicySource devolve o texto da policy no formato pedido.
+// No formato json o documento vem como objeto em "policy" (ou como string em "policy_dot").
+func (r InferRequest) PolicySource() string {
+	if r.PolicyFormat == app.PolicyFormatJSON && len(r.Policy) > 0 {
+		return string(r.Policy)
+	}
+	return r.PolicyDOT
 }
 
 func (r InferRequest) Options() app.InferOptions {
 	return app.InferOptions{
 		PolicyID:      r.PolicyID,
 		PolicyVersion: r.Version,
+		Entry:         r.Entry,
+		Format:        r.PolicyFormat,
+		Timeout:       time.Duration(r.TimeoutMS) * time.Millisecond,
+		EvaluateAll:   r.EvaluateAll,
+		Explain:       r.Explain,
 	}
 }
 
+// IntrospectResponse é a resposta do /introspect. O request é o mesmo InferRequest (input e debug sao ignorados).
+type IntrospectResponse struct {
+	Inputs *app.InputRequirements `json:"inputs"`
+	Policy *app.PolicyInfo        `json:"policy,omitempty"`
+}
+
+// CounterfactualRequest é o InferRequest com o alvo da busca (debug, evaluate_all e explain sao ignorados).
+type CounterfactualRequest struct {
+	InferRequest
+	Target app.CounterfactualTarget `json:"target"`
+}
+
+// CounterfactualResponse é a resposta do /counterfactual: o resultado da busca mais o PolicyInfo.
+type CounterfactualResponse struct {
+	app.CounterfactualResult
+	Policy *app.PolicyInfo `json:"policy,omitempty"`
+}
+
 type InferResponse struct {
 	Output map[string]any  `json:"output"`
 	Trace  *app.InferTrace `json:"trace,omitempty"`
 	Policy *app.PolicyInfo `json:"policy,omitempty"`
+	// Ambiguous só vem com evaluate_all: true se algum nó visitado tinha mais de uma aresta casando.
+	Ambiguous      *bool    `json:"ambiguous,omitempty"`
+	AmbiguousNodes []string `json:"ambiguous_nodes,omitempty"`
+	// Explanations só vem com explain: a frase de cada aresta avaliada, em ordem de execução
+	// (a quebra completa por comparação fica no trace, com debug).
+	Explanations []string `json:"explanations,omitempty"`
+}
+
+// NewInferResponse monta a resposta; com evaluate_all/explain o trace (que carrega a ambiguidade e as
+// explicações) roda sempre, mas só volta no corpo com debug.
+func NewInferResponse(in InferRequest, out map[string]any, trace *app.InferTrace, info *app.PolicyInfo) InferResponse {
+	resp := InferResponse{Output: out, Policy: info}
+	if in.EvaluateAll {
+		ambiguous := trace != nil && trace.Ambiguous
+		resp.Ambiguous = &ambiguous
+		if trace != nil {
+			resp.AmbiguousNodes = trace.AmbiguousNodes
+		}
+	}
+	if in.Explain {
+		resp.Explanations = trace.Explanations()
+	}
+	if in.Debug {
+		resp.Trace = trace
+	}
+	return resp
+}
+
+// TraceRequested diz se o request precisa da execução com trace (debug, evaluate_all ou explain).
+func (r InferRequest) TraceRequested() bool {
+	return r.Debug || r.EvaluateAll || r.Explain
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 
@@ -31,21 +33,85 @@ func (h *Handler) Infer(ctx context.Context, req events.APIGatewayV2HTTPRequest)
 		return jsonResp(http.StatusBadRequest, map[string]any{"error": "invalid json", "details": err.Error()}), nil
 	}
 
-	if in.Debug {
-		out, trace, info, err := h.svc.InferWithTraceAndOptions(in.PolicyDOT, in.Input, in.Options())
+	if in.TraceRequested() {
+		out, trace, info, err := h.svc.InferWithTraceContext(ctx, in.PolicySource(), in.Input, in.Options())
 		if err != nil {
-			return jsonResp(http.StatusBadRequest, inferErrorBody(err, trace, info)), nil
+			var explanations []string
+			if in.Explain {
+				explanations = trace.Explanations()
+			}
+			if !in.Debug {
+				trace = nil
+			}
+			body := inferErrorBody(err, trace, info)
+			if len(explanations) > 0 {
+				body["explanations"] = explanations
+			}
+			return jsonResp(inferStatus(err), body), nil
 		}
-		return jsonResp(http.StatusOK, inferdto.InferResponse{Output: out, Trace: trace, Policy: info}), nil
+		return jsonResp(http.StatusOK, inferdto.NewInferResponse(in, out, trace, info)), nil
 	}
 
-	out, info, err := h.svc.InferWithOptions(in.PolicyDOT, in.Input, in.Options())
+	out, info, err := h.svc.InferContext(ctx, in.PolicySource(), in.Input, in.Options())
 	if err != nil {
-		return jsonResp(http.StatusBadRequest, inferErrorBody(err, nil, info)), nil
+		return jsonResp(inferStatus(err), inferErrorBody(err, nil, info)), nil
 	}
 	return jsonResp(http.StatusOK, inferdto.InferResponse{Output: out, Policy: info}), nil
 }
 
+// Route despacha pelo path do API Gateway: /introspect e /counterfactual vao pros handlers deles, o resto pro Infer.
+func (h *Handler) Route(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	switch {
+	case strings.HasSuffix(req.RawPath, "/introspect"):
+		return h.Introspect(ctx, req)
+	case strings.HasSuffix(req.RawPath, "/counterfactual"):
+		return h.Counterfactual(ctx, req)
+	}
+	return h.Infer(ctx, req)
+}
+
+// Introspect devolve as variaveis de input que a policy lê, igual ao /introspect do HTTP.
+func (h *Handler) Introspect(_ context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return jsonResp(http.StatusBadRequest, map[string]any{"error": "invalid body", "details": err.Error()}), nil
+	}
+
+	var in inferdto.InferRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return jsonResp(http.StatusBadRequest, map[string]any{"error": "invalid json", "details": err.Error()}), nil
+	}
+
+	inputs, info, err := h.svc.Introspect(in.PolicySource(), in.Options())
+	if err != nil {
+		out := inferErrorBody(err, nil, info)
+		out["error"] = "introspect failed"
+		return jsonResp(http.StatusBadRequest, out), nil
+	}
+	return jsonResp(http.StatusOK, inferdto.IntrospectResponse{Inputs: inputs, Policy: info}), nil
+}
+
+// Counterfactual devolve as menores mudanças de input que levam a execução até o alvo, igual ao /counterfactual do HTTP.
+func (h *Handler) Counterfactual(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return jsonResp(http.StatusBadRequest, map[string]any{"error": "invalid body", "details": err.Error()}), nil
+	}
+
+	var in inferdto.CounterfactualRequest
+	if err := json.Unmarshal(body, &in); err != nil {
+		return jsonResp(http.StatusBadRequest, map[string]any{"error": "invalid json", "details": err.Error()}), nil
+	}
+
+	res, info, err := h.svc.Counterfactual(ctx, in.PolicySource(), in.Input, in.Target, in.Options())
+	if err != nil {
+		out := inferErrorBody(err, nil, info)
+		out["error"] = "counterfactual failed"
+		return jsonResp(inferStatus(err), out), nil
+	}
+	return jsonResp(http.StatusOK, inferdto.CounterfactualResponse{CounterfactualResult: *res, Policy: info}), nil
+}
+
 func readBody(req events.APIGatewayV2HTTPRequest) ([]byte, error) {
 	if req.IsBase64Encoded {
 		return base64.StdEncoding.DecodeString(req.Body)
@@ -62,11 +128,37 @@ func jsonResp(status int, body any) events.APIGatewayV2HTTPResponse {
 	}
 }
 
+// statusClientClosedRequest é o 499 do nginx: o cliente desistiu (ctx cancelado) antes da resposta.
+const statusClientClosedRequest = 499
+
+// inferStatus: execução que estourou o prazo vira 504, cancelada vira 499; o resto é erro do request.
+func inferStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	}
+	return http.StatusBadRequest
+}
+
 func inferErrorBody(err error, trace *app.InferTrace, info *app.PolicyInfo) map[string]any {
 	body := map[string]any{
 		"error":   "infer failed",
 		"details": err.Error(),
 	}
+	var compileErrs app.CompileErrors
+	if errors.As(err, &compileErrs) {
+		body["compile_errors"] = compileErrs
+	}
+	var inputErrs app.InputErrors
+	if errors.As(err, &inputErrs) {
+		body["input_errors"] = inputErrs
+	}
+	var outputErrs app.OutputErrors
+	if errors.As(err, &outputErrs) {
+		body["output_errors"] = outputErrs
+	}
 	if trace != nil {
 		body["trace"] = trace
 	}
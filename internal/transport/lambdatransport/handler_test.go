@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -14,16 +15,26 @@ import (
 type svcStub struct {
 	inferWithOptionsFn         func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error)
 	inferWithTraceAndOptionsFn func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error)
+	introspectFn               func(policyDOT string, opts app.InferOptions) (*app.InputRequirements, *app.PolicyInfo, error)
+	counterfactualFn           func(policyDOT string, input map[string]any, target app.CounterfactualTarget, opts app.InferOptions) (*app.CounterfactualResult, *app.PolicyInfo, error)
 }
 
-func (s *svcStub) InferWithOptions(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
+func (s *svcStub) InferContext(_ context.Context, policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
 	return s.inferWithOptionsFn(policyDOT, input, opts)
 }
 
-func (s *svcStub) InferWithTraceAndOptions(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error) {
+func (s *svcStub) InferWithTraceContext(_ context.Context, policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error) {
 	return s.inferWithTraceAndOptionsFn(policyDOT, input, opts)
 }
 
+func (s *svcStub) Introspect(policyDOT string, opts app.InferOptions) (*app.InputRequirements, *app.PolicyInfo, error) {
+	return s.introspectFn(policyDOT, opts)
+}
+
+func (s *svcStub) Counterfactual(_ context.Context, policyDOT string, input map[string]any, target app.CounterfactualTarget, opts app.InferOptions) (*app.CounterfactualResult, *app.PolicyInfo, error) {
+	return s.counterfactualFn(policyDOT, input, target, opts)
+}
+
 func TestHandler_Infer_InvalidJSON(t *testing.T) {
 	h := NewHandler(&svcStub{
 		inferWithOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
@@ -105,3 +116,132 @@ func TestHandler_Infer_VersionedResponseIncludesPolicyInfo(t *testing.T) {
 		t.Fatalf("unexpected policy info: %#v", policy)
 	}
 }
+
+func TestHandler_Infer_CompileErrorsSerializedAsList(t *testing.T) {
+	h := NewHandler(&svcStub{
+		inferWithOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
+			return nil, nil, app.CompileErrors{
+				{Line: 2, Column: 5, Node: "ok", Attr: "result", Message: "node ok invalid result: boom"},
+				{Line: 3, Column: 9, Message: "edge start invalid cond: boom"},
+			}
+		},
+		inferWithTraceAndOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.InferTrace, *app.PolicyInfo, error) {
+			return nil, nil, nil, fmt.Errorf("unused")
+		},
+	})
+
+	resp, err := h.Infer(context.Background(), events.APIGatewayV2HTTPRequest{Body: `{"policy_dot":"digraph{}","input":{}}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected status 400, got %d", resp.StatusCode)
+	}
+
+	var out map[string]any
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+		t.Fatal(err)
+	}
+	list, ok := out["compile_errors"].([]any)
+	if !ok || len(list) != 2 {
+		t.Fatalf("expected 2 compile errors, got %#v", out["compile_errors"])
+	}
+	first := list[0].(map[string]any)
+	if first["line"] != float64(2) || first["column"] != float64(5) || first["node"] != "ok" || first["attr"] != "result" {
+		t.Fatalf("unexpected compile error: %#v", first)
+	}
+}
+
+func TestHandler_Route_Introspect(t *testing.T) {
+	h := NewHandler(&svcStub{
+		introspectFn: func(policyDOT string, opts app.InferOptions) (*app.InputRequirements, *app.PolicyInfo, error) {
+			if opts.Entry != "renewal" {
+				t.Fatalf("expected entry forwarded, got %+v", opts)
+			}
+			return &app.InputRequirements{All: []string{"age"}, Always: []string{"age"}, Sometimes: []string{}}, &app.PolicyInfo{Hash: "h"}, nil
+		},
+	})
+
+	resp, err := h.Route(context.Background(), events.APIGatewayV2HTTPRequest{
+		RawPath: "/introspect",
+		Body:    `{"policy_dot":"digraph { start -> a [cond=\"age > 1\"]; }","entry":"renewal"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status 200, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	var out map[string]any
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+		t.Fatal(err)
+	}
+	inputs, ok := out["inputs"].(map[string]any)
+	if !ok || fmt.Sprint(inputs["always"]) != "[age]" {
+		t.Fatalf("unexpected introspect response: %s", resp.Body)
+	}
+}
+
+func TestHandler_Infer_ContextErrorsMapToStatus(t *testing.T) {
+	for cause, want := range map[error]int{context.DeadlineExceeded: 504, context.Canceled: 499} {
+		h := NewHandler(&svcStub{
+			inferWithOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
+				return nil, nil, fmt.Errorf("execution stopped before node %q: %w", "start", cause)
+			},
+		})
+
+		resp, err := h.Infer(context.Background(), events.APIGatewayV2HTTPRequest{Body: `{"policy_dot":"digraph {}","input":{},"timeout_ms":50}`})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("%v: expected status %d, got %d", cause, want, resp.StatusCode)
+		}
+	}
+}
+
+func TestHandler_Route_Counterfactual(t *testing.T) {
+	var gotTarget app.CounterfactualTarget
+	h := NewHandler(&svcStub{
+		inferWithOptionsFn: func(policyDOT string, input map[string]any, opts app.InferOptions) (map[string]any, *app.PolicyInfo, error) {
+			t.Fatalf("counterfactual request must not run inference")
+			return nil, nil, nil
+		},
+		counterfactualFn: func(policyDOT string, input map[string]any, target app.CounterfactualTarget, opts app.InferOptions) (*app.CounterfactualResult, *app.PolicyInfo, error) {
+			gotTarget = target
+			if target.Node == "missing" {
+				return nil, nil, fmt.Errorf("unknown target node %q", target.Node)
+			}
+			return &app.CounterfactualResult{Target: target, AlreadyReached: true}, nil, nil
+		},
+	})
+
+	resp, err := h.Route(context.Background(), events.APIGatewayV2HTTPRequest{
+		RawPath: "/counterfactual",
+		Body:    `{"policy_dot":"digraph {}","input":{"score":650},"target":{"node":"approved"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || gotTarget.Node != "approved" {
+		t.Fatalf("expected counterfactual handled, got %d %s (target %+v)", resp.StatusCode, resp.Body, gotTarget)
+	}
+	var out map[string]any
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["already_reached"] != true {
+		t.Fatalf("unexpected counterfactual response: %s", resp.Body)
+	}
+
+	resp, err = h.Route(context.Background(), events.APIGatewayV2HTTPRequest{
+		RawPath: "/counterfactual",
+		Body:    `{"policy_dot":"digraph {}","input":{},"target":{"node":"missing"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 || !strings.Contains(resp.Body, `"error":"counterfactual failed"`) {
+		t.Fatalf("expected 400 counterfactual failure, got %d %s", resp.StatusCode, resp.Body)
+	}
+}